@@ -0,0 +1,180 @@
+// Command websocket-gateway runs the gateway with the configuration loaded from a file, the environment
+// and the command line, in this order of precedence from lowest to highest.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/config"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "websocket-gateway: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// overrides collects the repeated `-set` flags
+type overrides []string
+
+func (o *overrides) String() string {
+	return strings.Join(*o, " ")
+}
+
+func (o *overrides) Set(value string) error {
+	*o = append(*o, value)
+	return nil
+}
+
+func parseFlags(args []string) (config.Sources, time.Duration, bool, error) {
+	flags := flag.NewFlagSet("websocket-gateway", flag.ContinueOnError)
+	file := flags.String("config", os.Getenv(config.FileEnvVar), "path of the YAML or TOML configuration file (env "+config.FileEnvVar+")")
+	host := flags.String("host", "", "host to listen at (ServerHost)")
+	port := flags.Int("port", config.DefaultServerPort, "port to listen at (ServerPort)")
+	appBaseUrl := flags.String("app-base-url", "", "base URL of the default application (AppBaseUrl)")
+	drainPeriod := flags.Duration("drain-period", 0, "how long to report not ready before stopping on SIGINT or SIGTERM")
+	check := flags.Bool("check", false, "validate the configuration and exit")
+	var sets overrides
+	flags.Var(&sets, "set", "sets an option, e.g. -set Apps.0.MaxConnections=1000 (repeatable)")
+
+	if parseErr := flags.Parse(args); parseErr != nil {
+		return config.Sources{}, 0, false, parseErr
+	}
+
+	// The dedicated flags only override the other sources when they are given explicitly
+	var explicit overrides
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "host":
+			explicit = append(explicit, "ServerHost="+*host)
+		case "port":
+			explicit = append(explicit, "ServerPort="+strconv.Itoa(*port))
+		case "app-base-url":
+			explicit = append(explicit, "AppBaseUrl="+*appBaseUrl)
+		}
+	})
+
+	return config.Sources{
+		File:      *file,
+		Environ:   os.Environ(),
+		Overrides: append(explicit, sets...),
+	}, *drainPeriod, *check, nil
+}
+
+// reload reloads the configuration from its sources and applies it to the server, keeping the current
+// configuration if the new one is invalid
+func reload(server *wsgw.Server, sources config.Sources, trigger string, logger zerolog.Logger) {
+	logger.Info().Str("trigger", trigger).Msg("reloading the configuration")
+	conf, loadErr := config.Load(sources)
+	if loadErr == nil {
+		_, loadErr = server.Reload(conf)
+	}
+	if loadErr != nil {
+		logger.Error().Err(loadErr).Msg("rejected the configuration, keeping the current one")
+	}
+}
+
+func run(args []string) error {
+	sources, drainPeriod, check, flagsErr := parseFlags(args)
+	if flagsErr != nil {
+		if errors.Is(flagsErr, flag.ErrHelp) {
+			return nil
+		}
+		return flagsErr
+	}
+
+	conf, loadErr := config.Load(sources)
+	if loadErr != nil {
+		return loadErr
+	}
+	if check {
+		fmt.Println("configuration OK")
+		return nil
+	}
+
+	if loggingErr := logging.Configure(conf.Logging); loggingErr != nil {
+		return fmt.Errorf("failed to set up logging: %w", loggingErr)
+	}
+	logger := logging.Get().With().Str(logging.ServiceLogger, "websocket-gateway").Logger()
+	server := wsgw.CreateServer(conf, logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	ready := make(chan struct{})
+	stopped := make(chan error, 1)
+	go func() {
+		defer func() {
+			if panicVal := recover(); panicVal != nil {
+				stopped <- fmt.Errorf("%v", panicVal)
+			}
+		}()
+		server.SetupAndStart(func(port int, stop func()) {
+			close(ready)
+		})
+		stopped <- errors.New("the server stopped unexpectedly")
+	}()
+
+	select {
+	case serverErr := <-stopped:
+		return serverErr
+	case <-ready:
+	}
+
+	fileChanges := make(chan struct{}, 1)
+	if sources.File != "" {
+		watchErr := config.Watch(ctx, sources.File, func() {
+			select {
+			case fileChanges <- struct{}{}:
+			default:
+			}
+		})
+		if watchErr != nil {
+			logger.Error().Err(watchErr).Str("file", sources.File).Msg("failed to watch the configuration file, reload with SIGHUP")
+		}
+	}
+
+	for ctx.Err() == nil {
+		select {
+		case serverErr := <-stopped:
+			return serverErr
+		case <-hangups:
+			reload(server, sources, "SIGHUP", logger)
+		case <-fileChanges:
+			reload(server, sources, "file change", logger)
+		case <-ctx.Done():
+		}
+	}
+	stop()
+
+	logger.Info().Dur("drain_period", drainPeriod).Msg("shutting down")
+	server.Drain()
+	if drainPeriod > 0 {
+		// A second signal stops the server right away
+		drainCtx, stopDraining := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		select {
+		case <-time.After(drainPeriod):
+		case <-drainCtx.Done():
+		}
+		stopDraining()
+	}
+	server.Stop()
+	logger.Info().Msg("stopped")
+	return nil
+}
@@ -0,0 +1,236 @@
+package wsgw
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"runtime/debug"
+	runtimepprof "runtime/pprof"
+	"slices"
+	"strings"
+	logging "websocket-gateway/internal/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// AdminConfig sets up the admin listener serving the debugging endpoints. It must be bound to
+// an address, which can't be reached from the outside, as profiling can affect the performance.
+type AdminConfig struct {
+	// ServerHost and ServerPort are the address of the admin listener, which is disabled if ServerPort is 0
+	ServerHost string
+	ServerPort int
+	// APIKeys are the bearer tokens accepted by the admin endpoints. At least one is required.
+	APIKeys []string
+}
+
+var errMissingAdminAPIKeys = errors.New("the admin listener requires at least one API key")
+
+// redactedSecret replaces the secrets in the effective configuration
+const redactedSecret = "REDACTED"
+
+// startAdmin starts the admin listener if it is configured
+func (s *Server) startAdmin() error {
+	conf := s.configuration.Admin
+	if conf.ServerPort == 0 {
+		return nil
+	}
+	if len(conf.APIKeys) == 0 {
+		return errMissingAdminAPIKeys
+	}
+
+	listener, listenErr := net.Listen("tcp", fmt.Sprintf("%s:%d", conf.ServerHost, conf.ServerPort))
+	if listenErr != nil {
+		return listenErr
+	}
+	s.adminListener = listener
+	s.logger.Info().Str("address", listener.Addr().String()).Msg("admin listener is listening")
+
+	go http.Serve(listener, createAdminRequestHandler(conf.APIKeys, s.currentConfig))
+	return nil
+}
+
+func createAdminRequestHandler(apiKeys []string, currentConfig func() Config) *gin.Engine {
+	rootEngine := gin.Default()
+
+	rootEngine.Use(RequestLogger)
+
+	admin := rootEngine.Group("", adminAuthenticator(apiKeys))
+	admin.GET("/debug/pprof/*profile", pprofHandler())
+	admin.GET("/debug/goroutines", goroutineDumpHandler())
+	admin.GET("/config", effectiveConfigHandler(currentConfig))
+	admin.GET("/build-info", buildInfoHandler())
+	admin.GET("/log-level", logLevelHandler())
+	admin.PUT("/log-level", setLogLevelHandler())
+
+	return rootEngine
+}
+
+func adminAuthenticator(apiKeys []string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		if authErr := authenticateBearer(apiKeys, g); authErr != nil {
+			zerolog.Ctx(g.Request.Context()).Info().Err(authErr).Msg("failed to authenticate admin")
+			g.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		g.Next()
+	}
+}
+
+// pprofHandler serves the profiles of the `net/http/pprof` package at `/debug/pprof/`
+func pprofHandler() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		switch g.Param("profile") {
+		case "/cmdline":
+			pprof.Cmdline(g.Writer, g.Request)
+		case "/profile":
+			pprof.Profile(g.Writer, g.Request)
+		case "/symbol":
+			pprof.Symbol(g.Writer, g.Request)
+		case "/trace":
+			pprof.Trace(g.Writer, g.Request)
+		default:
+			pprof.Index(g.Writer, g.Request)
+		}
+	}
+}
+
+// goroutineDumpHandler dumps the stacks of all goroutines in the format of unrecovered panics
+func goroutineDumpHandler() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		g.Header("Content-Type", "text/plain; charset=utf-8")
+		if dumpErr := runtimepprof.Lookup("goroutine").WriteTo(g.Writer, 2); dumpErr != nil {
+			zerolog.Ctx(g.Request.Context()).Error().Err(dumpErr).Msg("failed to dump the goroutines")
+		}
+	}
+}
+
+// effectiveConfigHandler serves the configuration including the reloaded settings
+func effectiveConfigHandler(currentConfig func() Config) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		g.JSON(http.StatusOK, currentConfig().redacted())
+	}
+}
+
+func buildInfoHandler() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		buildInfo, ok := debug.ReadBuildInfo()
+		if !ok {
+			g.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		g.JSON(http.StatusOK, buildInfo)
+	}
+}
+
+type logLevelBody struct {
+	Level string `json:"level"`
+}
+
+func logLevelHandler() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		g.JSON(http.StatusOK, logLevelBody{Level: logging.Level().String()})
+	}
+}
+
+// setLogLevelHandler changes the log level of the process, e.g. with `{"level":"debug"}`
+func setLogLevelHandler() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		logger := zerolog.Ctx(g.Request.Context())
+
+		var body logLevelBody
+		if bindErr := g.ShouldBindJSON(&body); bindErr != nil {
+			g.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		level, parseErr := logging.ParseLevel(body.Level)
+		if parseErr != nil {
+			logger.Info().Str("level", body.Level).Msg("invalid log level")
+			g.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+
+		previous := logging.Level()
+		logging.SetLevel(level)
+		logger.WithLevel(zerolog.NoLevel).Str("previous_level", previous.String()).Str("level", level.String()).Msg("log level changed")
+		g.JSON(http.StatusOK, logLevelBody{Level: level.String()})
+	}
+}
+
+// redacted returns a copy of the configuration with the secrets replaced
+func (c Config) redacted() Config {
+	c.AppBaseUrl = redactURL(c.AppBaseUrl)
+	c.Apps = slices.Clone(c.Apps)
+	for i := range c.Apps {
+		c.Apps[i].BaseUrl = redactURL(c.Apps[i].BaseUrl)
+		c.Apps[i].BackendAPIKeys = redactAll(c.Apps[i].BackendAPIKeys)
+	}
+	if c.Cluster.Peers != nil {
+		peers := make(map[string]string, len(c.Cluster.Peers))
+		for nodeID, baseUrl := range c.Cluster.Peers {
+			peers[nodeID] = redactURL(baseUrl)
+		}
+		c.Cluster.Peers = peers
+	}
+	if c.Cluster.SharedKey != "" {
+		c.Cluster.SharedKey = redactedSecret
+	}
+	if c.Registry.RedisPassword != "" {
+		c.Registry.RedisPassword = redactedSecret
+	}
+	c.ConnectionIDs.SigningKeys = redactAll(c.ConnectionIDs.SigningKeys)
+	c.Tracing.OTLPEndpoint = redactURL(c.Tracing.OTLPEndpoint)
+	c.Broker.URL = redactBrokerURLs(c.Broker.URL)
+	c.Admin.APIKeys = redactAll(c.Admin.APIKeys)
+	return c
+}
+
+func redactAll(secrets []string) []string {
+	if secrets == nil {
+		return nil
+	}
+	redacted := make([]string, len(secrets))
+	for i := range redacted {
+		redacted[i] = redactedSecret
+	}
+	return redacted
+}
+
+// redactBrokerURLs hides the credentials of the comma-separated NATS URLs, whose user info without
+// a password is a token. The URLs, which can't be parsed, are hidden as a whole.
+func redactBrokerURLs(rawUrls string) string {
+	urls := strings.Split(rawUrls, ",")
+	for i, rawUrl := range urls {
+		parsed, parseErr := url.Parse(strings.TrimSpace(rawUrl))
+		if parseErr != nil {
+			urls[i] = redactedSecret
+			continue
+		}
+		if parsed.User == nil {
+			continue
+		}
+		if _, hasPassword := parsed.User.Password(); hasPassword {
+			urls[i] = redactURL(parsed.String())
+			continue
+		}
+		parsed.User = url.User(redactedSecret)
+		urls[i] = parsed.String()
+	}
+	return strings.Join(urls, ",")
+}
+
+// redactURL hides the password of URLs with user info, and the URLs, which can't be parsed, as a whole
+func redactURL(rawUrl string) string {
+	parsed, parseErr := url.Parse(rawUrl)
+	if parseErr != nil {
+		return redactedSecret
+	}
+	if _, hasPassword := parsed.User.Password(); !hasPassword {
+		return rawUrl
+	}
+	parsed.User = url.UserPassword(parsed.User.Username(), redactedSecret)
+	return parsed.String()
+}
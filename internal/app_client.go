@@ -0,0 +1,181 @@
+package wsgw
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AppTransportConfig configures the HTTP transport shared by all callbacks to an application
+type AppTransportConfig struct {
+	// UnixSocket, if set, is the path of the unix domain socket the application listens on (e.g. a sidecar).
+	// The host part of AppBaseUrl is then only used for the `Host` header.
+	UnixSocket string
+	// RequestTimeout limits the duration of a single callback. Defaults to 15 seconds.
+	RequestTimeout time.Duration
+	// KeepAlive is the TCP keep-alive period. Defaults to 30 seconds, a negative value disables
+	// HTTP keep-alives altogether.
+	KeepAlive time.Duration
+	// MaxIdleConns defaults to 100
+	MaxIdleConns int
+	// IdleConnTimeout defaults to 90 seconds
+	IdleConnTimeout time.Duration
+	// EnableHTTP2 makes the callbacks use HTTP/2: negotiated via ALPN for https, with prior knowledge (h2c) otherwise
+	EnableHTTP2 bool
+}
+
+const (
+	defaultCallbackTimeout = 15 * time.Second
+	defaultKeepAlive       = 30 * time.Second
+	defaultMaxIdleConns    = 100
+	defaultIdleConnTimeout = 90 * time.Second
+)
+
+// appClient sends the callbacks to an application over a single, pooled transport
+type appClient struct {
+	appName    string
+	httpClient *http.Client
+	breaker    *circuitBreaker
+	metrics    *metrics
+	tracing    *tracing
+}
+
+func newAppClient(appName string, baseUrl string, conf AppTransportConfig, breaker *circuitBreaker, m *metrics, t *tracing) *appClient {
+	keepAlive := conf.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = defaultKeepAlive
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: keepAlive,
+	}
+
+	maxIdleConns := conf.MaxIdleConns
+	if maxIdleConns == 0 {
+		maxIdleConns = defaultMaxIdleConns
+	}
+	idleConnTimeout := conf.IdleConnTimeout
+	if idleConnTimeout == 0 {
+		idleConnTimeout = defaultIdleConnTimeout
+	}
+
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		DisableKeepAlives:   keepAlive < 0,
+		MaxIdleConns:        maxIdleConns,
+		MaxIdleConnsPerHost: maxIdleConns, // all callbacks go to the same host
+		IdleConnTimeout:     idleConnTimeout,
+		ForceAttemptHTTP2:   conf.EnableHTTP2,
+	}
+
+	if conf.UnixSocket != "" {
+		socketPath := conf.UnixSocket
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+	}
+
+	if conf.EnableHTTP2 {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP2(true)
+		if urlScheme(baseUrl) == "http" {
+			protocols.SetUnencryptedHTTP2(true)
+		} else {
+			protocols.SetHTTP1(true)
+		}
+		transport.Protocols = protocols
+	}
+
+	timeout := conf.RequestTimeout
+	if timeout == 0 {
+		timeout = defaultCallbackTimeout
+	}
+
+	return &appClient{
+		appName: appName,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+		breaker: breaker,
+		metrics: m,
+		tracing: t,
+	}
+}
+
+// post sends a callback request to the application and returns the status code and the header
+// of the response. The response body is drained and closed, so that the underlying connection can be reused.
+// The callback is traced as a child of the span in `ctx`, if any, and the trace context passed on to the application.
+// While the circuit of the application is open, errCircuitOpen is returned without sending the callback,
+// unless it is a `/ws/disconnected` one.
+func (c *appClient) post(ctx context.Context, endpoint string, url string, header http.Header, body io.Reader) (int, http.Header, error) {
+	ctx, span := c.tracing.tracer.Start(ctx, "wsgw.callback."+endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("wsgw.app", c.appName)),
+	)
+	defer span.End()
+
+	// The disconnections are notified whatever the state of the circuit, as the application would miss them
+	// otherwise, and they don't decide on the state either
+	breaker := c.breaker
+	if endpoint == disconnectedEndpoint {
+		breaker = nil
+	}
+	if !breaker.allow() {
+		span.SetStatus(codes.Error, errCircuitOpen.Error())
+		return 0, nil, errCircuitOpen
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		breaker.record(false)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, nil, err
+	}
+	if header != nil {
+		request.Header = header.Clone()
+	}
+	c.tracing.inject(ctx, request.Header)
+	if requestID := requestIDFromContext(ctx); requestID != "" {
+		request.Header.Set(RequestIDHeaderKey, requestID)
+	}
+
+	start := time.Now()
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		c.metrics.callbackDuration.WithLabelValues(c.appName, endpoint, "error").Observe(time.Since(start).Seconds())
+		breaker.record(false)
+		span.SetStatus(codes.Error, err.Error())
+		return 0, nil, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	c.metrics.callbackDuration.WithLabelValues(c.appName, endpoint, strconv.Itoa(response.StatusCode)).Observe(time.Since(start).Seconds())
+	span.SetAttributes(semconv.HTTPResponseStatusCode(response.StatusCode))
+	breaker.record(response.StatusCode < http.StatusInternalServerError)
+	if response.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(response.StatusCode))
+	}
+	return response.StatusCode, response.Header, nil
+}
+
+// failed counts a callback relaying messages of the clients, which the application didn't take
+func (c *appClient) failed(endpoint string) {
+	c.metrics.callbackFailures.WithLabelValues(c.appName, endpoint).Inc()
+}
+
+// close releases the idle connections of the pool
+func (c *appClient) close() {
+	c.httpClient.CloseIdleConnections()
+}
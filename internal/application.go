@@ -0,0 +1,371 @@
+package wsgw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"golang.org/x/time/rate"
+)
+
+// DefaultAppName is the name of the application defined by the top-level `Config.AppBaseUrl`
+const DefaultAppName = "default"
+
+// reservedAppNames can't name applications, as the paths of their connections would be those of the
+// SSE and long-polling connections of the default application
+var reservedAppNames = []string{"sse", "poll"}
+
+// AppConfig defines an application served by the gateway
+type AppConfig struct {
+	Name    string
+	BaseUrl string
+	// Hosts lists the host names for which `GET /connect` is routed to this application
+	Hosts []string
+
+	// The paths of the callback endpoints relative to BaseUrl. Default to `/ws/connecting`,
+	// `/ws/disconnected` and `/ws/message-received` respectively.
+	ConnectingPath      string
+	DisconnectedPath    string
+	MessageReceivedPath string
+
+	// OriginPatterns are the host patterns authorized as origins of WS connection requests
+	OriginPatterns []string
+	// BackendAPIKeys, if not empty, are the bearer tokens the application backend
+	// must authenticate with to use the push and broadcast endpoints
+	BackendAPIKeys []string
+
+	// MaxConnections limits the number of concurrent connections to the application, 0 means no limit
+	MaxConnections int
+	// MessageBufferSize is the number of pushed messages queued per connection. Defaults to 16.
+	MessageBufferSize int
+	// PushRateLimit is the number of pushes per second allowed for the application with a burst of PushBurst.
+	// Defaults to one push every 100ms with a burst of 8.
+	PushRateLimit float64
+	PushBurst     int
+	// MessageFormat is the format of the messages sent to the clients: `raw` (the default) or `json-envelope`
+	MessageFormat string
+	// ReplayBufferSize is the number of recently sent messages kept per connection for replaying them to
+	// resumed sessions. 0 disables replay, which requires the `json-envelope` message format.
+	ReplayBufferSize int
+	// ResumeWindow is how long the session of a lost connection can be resumed. Defaults to 2 minutes.
+	ResumeWindow time.Duration
+	// DisconnectGracePeriod is how long a connection, which lost its socket, is held for the client to rebind to it
+	// with its resume token, before the application is notified of the disconnection. 0 disables holding connections.
+	DisconnectGracePeriod time.Duration
+	// OfflineQueue configures the queueing of the messages pushed to recently disconnected connections and users
+	OfflineQueue OfflineQueueConfig
+	// PayloadLogging configures the logging of the payloads of the messages for debugging
+	PayloadLogging PayloadLoggingConfig
+	// MessageBatching configures the batching of the `/ws/message-received` callbacks
+	MessageBatching MessageBatchingConfig
+	// CallbackDispatch configures the pool of workers making the `/ws/message-received` callbacks
+	CallbackDispatch CallbackDispatchConfig
+
+	Transport      AppTransportConfig
+	CircuitBreaker CircuitBreakerConfig
+}
+
+var errAppNotFound = errors.New("application not found")
+
+// appSettings are the settings of an application, which are replaced as a whole when the configuration is reloaded
+type appSettings struct {
+	originPatterns []string
+	backendAPIKeys []string
+	maxConnections int
+}
+
+type application struct {
+	name     string
+	urls     *appURLs
+	client   *appClient
+	conns    *wsConnections
+	settings atomic.Pointer[appSettings]
+	metrics  *metrics
+	tracing  *tracing
+	audit    *auditLog
+	// events are the gRPC streams, which replace the callbacks while the backends are subscribed
+	events *eventStreams
+	broker *broker
+	// batcher batches the `/ws/message-received` callbacks, if enabled
+	batcher *messageBatcher
+
+	onMessageReceived onMgsReceivedFunc
+}
+
+type applications struct {
+	byName map[string]*application
+	byHost map[string]*application
+	// defaultApp is the application named `default`, if any. The requests not addressing any application
+	// are routed to it.
+	defaultApp *application
+}
+
+// appConfigs returns the application definitions including the one defined by the top-level configuration options
+func (c Config) appConfigs() []AppConfig {
+	if c.AppBaseUrl == "" {
+		return c.Apps
+	}
+	return append(
+		[]AppConfig{
+			{
+				Name:           DefaultAppName,
+				BaseUrl:        c.AppBaseUrl,
+				OriginPatterns: []string{c.LoadBalancerAddress},
+				Transport:      c.AppTransport,
+			},
+		},
+		c.Apps...,
+	)
+}
+
+func newApplications(conf Config, nodeID string, registry ConnectionRegistry, m *metrics, t *tracing, a *auditLog, b *broker, logger zerolog.Logger) (*applications, error) {
+	apps := &applications{
+		byName: make(map[string]*application),
+		byHost: make(map[string]*application),
+	}
+
+	for _, appConf := range conf.appConfigs() {
+		if appConf.Name == "" {
+			return nil, errors.New("application name must not be empty")
+		}
+		if appConf.BaseUrl == "" {
+			return nil, fmt.Errorf("missing base URL for application %s", appConf.Name)
+		}
+		if _, exists := apps.byName[appConf.Name]; exists {
+			return nil, fmt.Errorf("duplicate application name: %s", appConf.Name)
+		}
+
+		app, appErr := newApplication(appConf, nodeID, registry, m, t, a, b, logger)
+		if appErr != nil {
+			return nil, fmt.Errorf("invalid configuration for application %s: %w", appConf.Name, appErr)
+		}
+		apps.byName[app.name] = app
+		for _, host := range appConf.Hosts {
+			if _, exists := apps.byHost[strings.ToLower(host)]; exists {
+				return nil, fmt.Errorf("host %s is assigned to more than one application", host)
+			}
+			apps.byHost[strings.ToLower(host)] = app
+		}
+		if app.name == DefaultAppName {
+			apps.defaultApp = app
+		}
+	}
+
+	return apps, nil
+}
+
+func newApplication(conf AppConfig, nodeID string, registry ConnectionRegistry, m *metrics, t *tracing, a *auditLog, b *broker, logger zerolog.Logger) (*application, error) {
+	urls := &appURLs{}
+	urls.update(conf)
+
+	conns, connsErr := newWsConnections(wsConnectionsConfig{
+		appName:           conf.Name,
+		nodeID:            nodeID,
+		registry:          registry,
+		messageBufferSize: messageBufferSize(conf),
+		pushLimiter:       rate.NewLimiter(pushRateLimit(conf)),
+		messageFormat:     conf.MessageFormat,
+		replayBufferSize:  conf.ReplayBufferSize,
+		resumeWindow:      conf.ResumeWindow,
+		gracePeriod:       conf.DisconnectGracePeriod,
+		offlineQueue:      conf.OfflineQueue,
+		payloadLogging:    conf.PayloadLogging,
+		callbackDispatch:  conf.CallbackDispatch,
+		metrics:           m,
+		tracing:           t,
+		audit:             a,
+	})
+	if connsErr != nil {
+		return nil, connsErr
+	}
+
+	client := newAppClient(conf.Name, conf.BaseUrl, conf.Transport, newCircuitBreaker(conf.CircuitBreaker), m, t)
+
+	events := newEventStreams(conf.Transport.RequestTimeout)
+	appLogger := logger.With().Str("app", conf.Name).Logger()
+	notifyAppOfMessageReceived := messageReceivedNotifier(urls, client, appLogger)
+	batcher := newMessageBatcher(conf.MessageBatching, client.httpClient.Timeout, messageBatchNotifier(urls, client, appLogger), func() {
+		client.failed(messageReceivedEndpoint)
+	})
+	if batcher != nil {
+		notifyAppOfMessageReceived = batcher.add
+	}
+
+	app := &application{
+		name:    conf.Name,
+		urls:    urls,
+		client:  client,
+		conns:   conns,
+		metrics: m,
+		tracing: t,
+		audit:   a,
+		events:  events,
+		broker:  b,
+		batcher: batcher,
+		onMessageReceived: func(msg inboundMessage) error {
+			publishErr := b.messageReceived(conf.Name, msg)
+			if events.subscribed() {
+				return events.messageReceived(msg)
+			}
+			if b.replacesCallbacks() {
+				return publishErr
+			}
+			return notifyAppOfMessageReceived(msg)
+		},
+	}
+	app.settings.Store(newAppSettings(conf))
+	return app, nil
+}
+
+// notifyConnectionChange tells the application of a connecting or disconnected client over the event streams of
+// its backends, if any, with the callback otherwise. Disconnections are published to the message broker besides.
+// It returns the same as notifyAppOfWsConnectionChange.
+func (app *application) notifyConnectionChange(ctx context.Context, endpoint string, connId connectionID, header http.Header, logger zerolog.Logger) (bool, http.Header, int) {
+	if endpoint == disconnectedEndpoint {
+		app.broker.disconnected(ctx, app.name, connId)
+		if app.broker.replacesCallbacks() && !app.events.subscribed() {
+			return true, nil, 0
+		}
+	}
+	if app.events.subscribed() {
+		return app.events.notifyConnectionChange(ctx, endpoint, connId, header, logger)
+	}
+	notificationUrl := app.urls.connecting()
+	if endpoint == disconnectedEndpoint {
+		notificationUrl = app.urls.disconnected()
+	}
+	return notifyAppOfWsConnectionChange(ctx, app.client, endpoint, notificationUrl, connId, header, logger)
+}
+
+func newAppSettings(conf AppConfig) *appSettings {
+	return &appSettings{
+		originPatterns: conf.OriginPatterns,
+		backendAPIKeys: conf.BackendAPIKeys,
+		maxConnections: conf.MaxConnections,
+	}
+}
+
+// reload applies the reloadable settings of `conf` to the application
+func (app *application) reload(conf AppConfig) {
+	app.urls.update(conf)
+	app.settings.Store(newAppSettings(conf))
+	app.conns.reload(conf)
+}
+
+func (apps *applications) get(name string) (*application, error) {
+	app, ok := apps.byName[name]
+	if !ok {
+		return nil, errAppNotFound
+	}
+	return app, nil
+}
+
+// forHost returns the application assigned to the host in the request's `Host` header or
+// the default application
+func (apps *applications) forHost(hostHeader string) (*application, error) {
+	host := hostHeader
+	if h, _, splitErr := net.SplitHostPort(hostHeader); splitErr == nil {
+		host = h
+	}
+	if app, ok := apps.byHost[strings.ToLower(host)]; ok {
+		return app, nil
+	}
+	if apps.defaultApp == nil {
+		return nil, errAppNotFound
+	}
+	return apps.defaultApp, nil
+}
+
+// names returns the names of the applications in order
+func (apps *applications) names() []string {
+	names := make([]string, 0, len(apps.byName))
+	for name := range apps.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (apps *applications) close() {
+	for _, app := range apps.byName {
+		app.conns.callbacks.close()
+		app.batcher.close()
+		app.client.close()
+	}
+}
+
+const appContextKey = "wsgw-application"
+
+// appSelector selects the application by the path param `appPathParamName` if it is not empty,
+// by the `Host` header otherwise, and makes it available to the handlers down the chain
+func appSelector(apps *applications, appPathParamName string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		var app *application
+		var err error
+		if appPathParamName != "" {
+			app, err = apps.get(g.Param(appPathParamName))
+		} else {
+			app, err = apps.forHost(g.Request.Host)
+		}
+		if err != nil {
+			zerolog.Ctx(g.Request.Context()).Info().Str("path", g.Request.URL.Path).Err(err).Msg("no application to route to")
+			g.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		g.Set(appContextKey, app)
+		g.Next()
+	}
+}
+
+func appFromContext(g *gin.Context) *application {
+	return g.MustGet(appContextKey).(*application)
+}
+
+// appURLs resolves the callback endpoints of an application
+type appURLs struct {
+	mu                  sync.RWMutex
+	baseUrl             string
+	connectingPath      string
+	disconnectedPath    string
+	messageReceivedPath string
+}
+
+func (u *appURLs) update(conf AppConfig) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.baseUrl = conf.BaseUrl
+	u.connectingPath = conf.ConnectingPath
+	u.disconnectedPath = conf.DisconnectedPath
+	u.messageReceivedPath = conf.MessageReceivedPath
+}
+
+func (u *appURLs) connecting() string {
+	return u.resolve(func() string { return u.connectingPath }, "/ws/connecting")
+}
+
+func (u *appURLs) disconnected() string {
+	return u.resolve(func() string { return u.disconnectedPath }, "/ws/disconnected")
+}
+
+func (u *appURLs) messageReceived() string {
+	return u.resolve(func() string { return u.messageReceivedPath }, "/ws/message-received")
+}
+
+func (u *appURLs) resolve(configuredPath func() string, defaultPath string) string {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	path := configuredPath()
+	if path == "" {
+		path = defaultPath
+	}
+	return fmt.Sprintf("%s%s", strings.TrimSuffix(u.baseUrl, "/"), path)
+}
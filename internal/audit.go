@@ -0,0 +1,241 @@
+package wsgw
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+	"websocket-gateway/internal/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"nhooyr.io/websocket"
+)
+
+// AuditConfig configures the audit log: a stream of JSON lines separate from the logs with a record
+// per event in the lifecycle of the connections
+type AuditConfig struct {
+	// Outputs are the destinations of the records as for `Logging.Outputs`: `stdout`, `stderr`, `file` or `syslog`.
+	// The audit log is disabled without outputs.
+	Outputs []string
+	// File.Path defaults to `websocket-gateway-audit.log`
+	File logging.FileConfig
+	// Syslog.Tag defaults to `websocket-gateway-audit`
+	Syslog logging.SyslogConfig
+}
+
+const (
+	defaultAuditFile      = "websocket-gateway-audit.log"
+	defaultAuditSyslogTag = "websocket-gateway-audit"
+)
+
+// The events recorded in the audit log
+const (
+	connectAttemptedAuditEvent = "connect_attempted"
+	// connectRejectedAuditEvent is recorded for the connections rejected by the gateway without asking the application
+	connectRejectedAuditEvent = "connect_rejected"
+	appDecisionAuditEvent     = "app_decision"
+	upgradedAuditEvent        = "upgraded"
+	upgradeFailedAuditEvent   = "upgrade_failed"
+	closedAuditEvent          = "closed"
+)
+
+// The parties closing connections
+const (
+	closedByClient  = "client"
+	closedByBackend = "backend"
+	closedByGateway = "gateway"
+	// closedByNetwork is recorded for connections lost without a close handshake
+	closedByNetwork = "network"
+)
+
+// auditLog records the lifecycle events of the connections.
+// A nil auditLog is a disabled one, its methods do nothing.
+type auditLog struct {
+	logger zerolog.Logger
+}
+
+func newAuditLog(conf AuditConfig) (*auditLog, error) {
+	if len(conf.Outputs) == 0 {
+		return nil, nil
+	}
+
+	file := conf.File
+	if file.Path == "" {
+		file.Path = defaultAuditFile
+	}
+	syslog := conf.Syslog
+	if syslog.Tag == "" {
+		syslog.Tag = defaultAuditSyslogTag
+	}
+	writer, writerErr := logging.NewWriter(conf.Outputs, file, syslog)
+	if writerErr != nil {
+		return nil, writerErr
+	}
+	return &auditLog{logger: zerolog.New(writer).With().Timestamp().Logger()}, nil
+}
+
+// record starts the record of `event` of a connection to `app`. The records have no level, so that they
+// are written whatever the log level.
+func (a *auditLog) record(event string, app string) *zerolog.Event {
+	return a.logger.Log().Str("event", event).Str("app", app)
+}
+
+// connectAttempted records the request of a client to connect
+func (a *auditLog) connectAttempted(app string, g *gin.Context, resuming bool) {
+	if a == nil {
+		return
+	}
+	a.record(connectAttemptedAuditEvent, app).
+		Str("request_id", requestIDFromContext(g.Request.Context())).
+		Str("remote_addr", g.Request.RemoteAddr).
+		Str("origin", g.GetHeader("Origin")).
+		Str("user_agent", g.GetHeader("User-Agent")).
+		Bool("resuming", resuming).
+		Send()
+}
+
+// connectRejected records the rejection of a connection by the gateway, e.g. for being over capacity
+func (a *auditLog) connectRejected(app string, requestID string, reason string, status int) {
+	if a == nil {
+		return
+	}
+	a.record(connectRejectedAuditEvent, app).
+		Str("request_id", requestID).
+		Str("reason", reason).
+		Int("status_code", status).
+		Send()
+}
+
+// appDecision records whether the application accepted the connection with `connId` and, if it did not,
+// the status code the client was rejected with
+func (a *auditLog) appDecision(app string, requestID string, connId connectionID, accepted bool, userID string, status int) {
+	if a == nil {
+		return
+	}
+	record := a.record(appDecisionAuditEvent, app).
+		Str("request_id", requestID).
+		Str("connection_id", string(connId)).
+		Bool("accepted", accepted)
+	if accepted {
+		record = record.Str("user_id", userID)
+	} else {
+		record = record.Int("status_code", status)
+	}
+	record.Send()
+}
+
+// upgraded records the upgrade of the request to a socket of the `transport` bound to the connection,
+// which is either `accepted`, `resumed` or `rebound`
+func (a *auditLog) upgraded(app string, conn *connection, requestID string, transport string, outcome string) {
+	if a == nil {
+		return
+	}
+	a.record(upgradedAuditEvent, app).
+		Str("request_id", requestID).
+		Str("connection_id", string(conn.id)).
+		Str("user_id", conn.userID).
+		Str("transport", transport).
+		Str("outcome", outcome).
+		Send()
+}
+
+// upgradeFailed records the failure of the handshake of the transport
+func (a *auditLog) upgradeFailed(app string, conn *connection, requestID string, err error) {
+	if a == nil {
+		return
+	}
+	a.record(upgradeFailedAuditEvent, app).
+		Str("request_id", requestID).
+		Str("connection_id", string(conn.id)).
+		Str("user_id", conn.userID).
+		Str("error", err.Error()).
+		Send()
+}
+
+// closed records the end of the connection lost with `err` along with its duration and traffic
+func (a *auditLog) closed(app string, conn *connection, err error) {
+	if a == nil {
+		return
+	}
+	code, reason, closedBy := closeStatus(conn, err)
+	record := a.record(closedAuditEvent, app).
+		Str("request_id", conn.requestID).
+		Str("connection_id", string(conn.id)).
+		Str("user_id", conn.userID).
+		Int("close_code", int(code)).
+		Str("close_reason", reason).
+		Str("closed_by", closedBy).
+		Int64("duration_ms", time.Since(conn.connectedAt).Milliseconds()).
+		Int64("messages_received", conn.stats.messagesReceived.Load()).
+		Int64("messages_sent", conn.stats.messagesSent.Load()).
+		Int64("bytes_received", conn.stats.bytesReceived.Load()).
+		Int64("bytes_sent", conn.stats.bytesSent.Load())
+	if caller := conn.closedBy.Load(); caller != nil {
+		record = record.Dict("backend_caller", zerolog.Dict().
+			Str("remote_addr", caller.remoteAddr).
+			Str("forwarded_by", caller.forwardedBy).
+			Str("request_id", caller.requestID).
+			Str("api_key_id", caller.apiKeyID),
+		)
+	}
+	record.Send()
+}
+
+// closeStatus returns the close code and reason of the connection lost with `err` and who closed it
+func closeStatus(conn *connection, err error) (websocket.StatusCode, string, string) {
+	var closeErr websocket.CloseError
+	switch {
+	case err == errClosedByBackend:
+		return websocket.StatusNormalClosure, err.Error(), closedByBackend
+	case conn.tooSlow.Load():
+		return websocket.StatusPolicyViolation, tooSlowCloseReason, closedByGateway
+	case conn.overloaded.Load():
+		return websocket.StatusTryAgainLater, callbackQueueFullCloseReason, closedByGateway
+	case errors.As(err, &closeErr):
+		return closeErr.Code, closeErr.Reason, closedByClient
+	case err == nil:
+		return websocket.StatusNormalClosure, "", closedByGateway
+	default:
+		return websocket.StatusAbnormalClosure, err.Error(), closedByNetwork
+	}
+}
+
+// connectionStats counts the traffic of a connection across its sockets
+type connectionStats struct {
+	messagesReceived atomic.Int64
+	messagesSent     atomic.Int64
+	bytesReceived    atomic.Int64
+	bytesSent        atomic.Int64
+}
+
+// backendCaller identifies the backend, which asked for a connection to be closed
+type backendCaller struct {
+	remoteAddr string
+	// forwardedBy is the node, which forwarded the request, if any
+	forwardedBy string
+	requestID   string
+	// apiKeyID is a fingerprint of the API key the backend authenticated with, if any
+	apiKeyID string
+}
+
+func newBackendCaller(g *gin.Context) *backendCaller {
+	return &backendCaller{
+		remoteAddr:  g.Request.RemoteAddr,
+		forwardedBy: g.GetHeader(ForwardedByHeaderKey),
+		requestID:   requestIDFromContext(g.Request.Context()),
+		apiKeyID:    apiKeyID(g.GetHeader("Authorization")),
+	}
+}
+
+// apiKeyID fingerprints the API key of the bearer `authorization`, if any
+func apiKeyID(authorization string) string {
+	token, hasBearer := strings.CutPrefix(authorization, "Bearer ")
+	if !hasBearer {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,237 @@
+package wsgw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+)
+
+// MessageBatchingConfig configures the batching of the messages received from the clients into
+// fewer `/ws/message-received` callbacks
+type MessageBatchingConfig struct {
+	// MaxMessages is the number of messages a callback carries at most. 0 disables batching.
+	MaxMessages int
+	// MaxDelay is how long the first message of a batch waits for further ones. Defaults to 100ms.
+	MaxDelay time.Duration
+}
+
+const defaultBatchMaxDelay = 100 * time.Millisecond
+
+// batcherCloseTimeout is how long the pending messages are given to be delivered when the batcher is closed
+const batcherCloseTimeout = 5 * time.Second
+
+var errBatcherClosed = errors.New("message batcher closed")
+
+// batchedMessage is an element of the JSON array sent to `/ws/message-received` by batches
+type batchedMessage struct {
+	ConnectionID string    `json:"connectionId"`
+	MessageID    string    `json:"messageId"`
+	RequestID    string    `json:"requestId,omitempty"`
+	ReceivedAt   time.Time `json:"receivedAt"`
+	Message      string    `json:"message"`
+}
+
+// batchEntry is either a message to batch or a notification waiting for the messages of a connection
+type batchEntry struct {
+	msg inboundMessage
+	// then is called once the messages of the connection `msg.connectionId` queued before are delivered
+	then func()
+}
+
+// messageBatcher accumulates the messages received from the clients of an application and delivers them
+// by batches. The batches are delivered one after the other, so that the messages of each connection stay
+// in order. A nil messageBatcher is a disabled one.
+type messageBatcher struct {
+	maxMessages int
+	maxDelay    time.Duration
+	timeout     time.Duration
+	deliver     func(ctx context.Context, batch []inboundMessage) error
+	failed      func()
+
+	// ctx is that of the deliveries, cancelled once the batcher is closed and the delivery of the pending
+	// messages timed out
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	entries  chan batchEntry
+	stopping chan struct{}
+	done     chan struct{}
+}
+
+// newMessageBatcher creates the batcher, which delivers each batch within `timeout` and reports those it
+// failed to deliver to `failed`
+func newMessageBatcher(conf MessageBatchingConfig, timeout time.Duration, deliver func(ctx context.Context, batch []inboundMessage) error, failed func()) *messageBatcher {
+	if conf.MaxMessages <= 0 {
+		return nil
+	}
+	maxDelay := conf.MaxDelay
+	if maxDelay == 0 {
+		maxDelay = defaultBatchMaxDelay
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &messageBatcher{
+		maxMessages: conf.MaxMessages,
+		maxDelay:    maxDelay,
+		timeout:     timeout,
+		deliver:     deliver,
+		failed:      failed,
+		ctx:         ctx,
+		cancel:      cancel,
+		entries:     make(chan batchEntry, conf.MaxMessages),
+		stopping:    make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// add queues the message for the next batch. It blocks while a batch is delivered and the next one is
+// full already, so that chatty clients are slowed down rather than the messages piling up.
+func (b *messageBatcher) add(msg inboundMessage) error {
+	select {
+	case b.entries <- batchEntry{msg: msg}:
+		return nil
+	case <-b.stopping:
+		return errBatcherClosed
+	}
+}
+
+// afterMessagesOf calls `f` once the messages of the connection added so far are delivered, right away if
+// the batcher is disabled or closed
+func (b *messageBatcher) afterMessagesOf(connId connectionID, f func()) {
+	if b == nil {
+		f()
+		return
+	}
+	select {
+	case b.entries <- batchEntry{msg: inboundMessage{connectionId: connId}, then: f}:
+	case <-b.stopping:
+		f()
+	}
+}
+
+func (b *messageBatcher) run() {
+	defer close(b.done)
+
+	batch := make([]inboundMessage, 0, b.maxMessages)
+	// afterBatch are the notifications waiting for the messages of the batch
+	var afterBatch []func()
+	timer := time.NewTimer(b.maxDelay)
+	timer.Stop()
+	flush := func() {
+		timer.Stop()
+		if len(batch) > 0 {
+			b.deliverBatch(batch)
+			batch = make([]inboundMessage, 0, b.maxMessages)
+		}
+		for _, f := range afterBatch {
+			go f()
+		}
+		afterBatch = nil
+	}
+	collect := func(entry batchEntry) {
+		if entry.then != nil {
+			if slices.ContainsFunc(batch, func(msg inboundMessage) bool { return msg.connectionId == entry.msg.connectionId }) {
+				afterBatch = append(afterBatch, entry.then)
+			} else {
+				go entry.then()
+			}
+			return
+		}
+		batch = append(batch, entry.msg)
+		if len(batch) == 1 {
+			timer.Reset(b.maxDelay)
+		}
+		if len(batch) >= b.maxMessages {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case entry := <-b.entries:
+			collect(entry)
+		case <-timer.C:
+			flush()
+		case <-b.stopping:
+			// The messages queued already are delivered
+			for {
+				select {
+				case entry := <-b.entries:
+					collect(entry)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *messageBatcher) deliverBatch(batch []inboundMessage) {
+	ctx, cancel := context.WithTimeout(b.ctx, b.timeout)
+	defer cancel()
+	if err := b.deliver(ctx, batch); err != nil {
+		b.failed()
+	}
+}
+
+// close delivers the pending messages and stops batching. The deliveries are cancelled if the pending
+// messages aren't delivered within batcherCloseTimeout.
+func (b *messageBatcher) close() {
+	if b == nil {
+		return
+	}
+	close(b.stopping)
+	select {
+	case <-b.done:
+	case <-time.After(batcherCloseTimeout):
+		b.cancel()
+		<-b.done
+	}
+	b.cancel()
+}
+
+// messageBatchNotifier posts the batches of messages to the `/ws/message-received` endpoint of the application
+// as a JSON array. The messages carry their connection, message and request IDs.
+func messageBatchNotifier(appUrls applicationURLs, client *appClient, parentLogger zerolog.Logger) func(ctx context.Context, batch []inboundMessage) error {
+	logger := parentLogger.With().Str(logging.MethodLogger, "notifyAppOfMessageBatch").Logger()
+
+	return func(ctx context.Context, batch []inboundMessage) error {
+		messages := make([]batchedMessage, len(batch))
+		for i, msg := range batch {
+			messages[i] = batchedMessage{
+				ConnectionID: string(msg.connectionId),
+				MessageID:    msg.id,
+				RequestID:    msg.requestID,
+				ReceivedAt:   msg.receivedAt.UTC(),
+				Message:      msg.data,
+			}
+		}
+		body, marshalErr := json.Marshal(messages)
+		if marshalErr != nil {
+			return marshalErr
+		}
+		header := http.Header{}
+		header.Set("Content-Type", "application/json")
+
+		statusCode, _, err := client.post(ctx, messageReceivedEndpoint, appUrls.messageReceived(), header, bytes.NewReader(body))
+		if err != nil {
+			logger.Error().Err(err).Int("batch_size", len(batch)).Msg("failed to send request")
+			return err
+		}
+		if statusCode != http.StatusOK {
+			logger.Info().Int("status_code", statusCode).Int("batch_size", len(batch)).Msg("unexpected status code")
+			return fmt.Errorf("unexpected status code: %d", statusCode)
+		}
+		return nil
+	}
+}
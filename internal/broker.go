@@ -0,0 +1,395 @@
+package wsgw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"time"
+	"websocket-gateway/internal/logging"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+)
+
+// BrokerConfig configures the message broker the gateway publishes the connection events and the messages
+// received from the clients to, and consumes the push commands of the backends from
+type BrokerConfig struct {
+	// Type is `nats`. The broker is disabled without a type.
+	Type string
+	// URL is that of the NATS server, several URLs of a cluster are separated by commas. Defaults to `nats://127.0.0.1:4222`.
+	URL string
+	// SubjectPrefix prefixes the subjects, which are `<SubjectPrefix>.<app>.<event or commands>`. Defaults to `wsgw`.
+	SubjectPrefix string
+	// ReplaceCallbacks stops the `disconnected` and `message-received` callbacks, which are sent in addition to
+	// the events otherwise. The `connecting` callback is still sent to authenticate the clients.
+	ReplaceCallbacks bool
+}
+
+// NATSBrokerType selects the NATS message broker
+const NATSBrokerType = "nats"
+
+const defaultBrokerSubjectPrefix = "wsgw"
+
+// The events published to the broker
+const (
+	connectedBrokerEvent       = "connected"
+	disconnectedBrokerEvent    = "disconnected"
+	messageReceivedBrokerEvent = "message-received"
+)
+
+// The push commands consumed from the broker
+const (
+	pushBrokerCommand       = "push"
+	pushToUserBrokerCommand = "push-to-user"
+	publishBrokerCommand    = "publish"
+	broadcastBrokerCommand  = "broadcast"
+	closeBrokerCommand      = "close"
+)
+
+// commandLanes is the number of goroutines applying the commands of an application. The commands
+// addressing the same connection, user or topic take the same lane, so that they are applied in order,
+// while a push waiting for the rate limiter holds up the commands of its lane only.
+const commandLanes = 16
+
+// commandLaneSize is the number of commands waiting in a lane at most before the subscription waits
+const commandLaneSize = 64
+
+// brokerCloseTimeout is how long the commands already consumed and the events already published are
+// given to be handled when the broker is closed
+const brokerCloseTimeout = 5 * time.Second
+
+var (
+	errUnknownBrokerType    = errors.New("unknown message broker type")
+	errUnknownBrokerCommand = errors.New("unknown command")
+)
+
+// brokerEvent is published to `<prefix>.<app>.<type>`
+type brokerEvent struct {
+	Type         string    `json:"type"`
+	App          string    `json:"app"`
+	Node         string    `json:"node,omitempty"`
+	ConnectionID string    `json:"connectionId"`
+	UserID       string    `json:"userId,omitempty"`
+	RequestID    string    `json:"requestId,omitempty"`
+	MessageID    string    `json:"messageId,omitempty"`
+	Message      *string   `json:"message,omitempty"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// brokerCommand is consumed from `<prefix>.<app>.commands`
+type brokerCommand struct {
+	Type         string `json:"type"`
+	ConnectionID string `json:"connectionId"`
+	UserID       string `json:"userId"`
+	Topic        string `json:"topic"`
+	Message      string `json:"message"`
+}
+
+// lane returns the lane of the command among `lanes`
+func (cmd brokerCommand) lane(lanes int) int {
+	h := fnv.New32a()
+	h.Write([]byte(cmd.ConnectionID))
+	h.Write([]byte{0})
+	h.Write([]byte(cmd.UserID))
+	h.Write([]byte{0})
+	h.Write([]byte(cmd.Topic))
+	return int(h.Sum32() % uint32(lanes))
+}
+
+// brokerReply answers the commands sent as requests, which target a single connection
+type brokerReply struct {
+	Queued bool   `json:"queued,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// broker publishes the events of the applications to NATS and applies the commands consumed from it.
+// Every node subscribes to the commands and applies them to its own connections, hence no forwarding.
+// A nil broker is a disabled one, its methods do nothing.
+type broker struct {
+	conn             *nats.Conn
+	subjectPrefix    string
+	nodeID           string
+	replaceCallbacks bool
+	logger           zerolog.Logger
+
+	subscriptions []*nats.Subscription
+	// drained is done once every subscription delivered its last command
+	drained  sync.WaitGroup
+	stopping chan struct{}
+	lanes    sync.WaitGroup
+}
+
+func newBroker(conf BrokerConfig, nodeID string, parentLogger zerolog.Logger) (*broker, error) {
+	if conf.Type == "" {
+		return nil, nil
+	}
+	if conf.Type != NATSBrokerType {
+		return nil, errUnknownBrokerType
+	}
+
+	logger := parentLogger.With().Str(logging.UnitLogger, "broker").Logger()
+	url := conf.URL
+	if url == "" {
+		url = nats.DefaultURL
+	}
+	conn, connErr := nats.Connect(url,
+		nats.Name("websocket-gateway"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			logger.Warn().Err(err).Msg("disconnected from the message broker")
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			logger.Info().Str("url", c.ConnectedUrlRedacted()).Msg("reconnected to the message broker")
+		}),
+	)
+	if connErr != nil {
+		return nil, connErr
+	}
+
+	subjectPrefix := conf.SubjectPrefix
+	if subjectPrefix == "" {
+		subjectPrefix = defaultBrokerSubjectPrefix
+	}
+	return &broker{
+		conn:             conn,
+		subjectPrefix:    subjectPrefix,
+		nodeID:           nodeID,
+		replaceCallbacks: conf.ReplaceCallbacks,
+		logger:           logger,
+		stopping:         make(chan struct{}),
+	}, nil
+}
+
+func (b *broker) subject(app string, name string) string {
+	return fmt.Sprintf("%s.%s.%s", b.subjectPrefix, app, name)
+}
+
+// replacesCallbacks reports whether the events are published instead of being sent to the callbacks
+func (b *broker) replacesCallbacks() bool {
+	return b != nil && b.replaceCallbacks
+}
+
+func (b *broker) publish(event brokerEvent) error {
+	event.Node = b.nodeID
+	event.Timestamp = time.Now().UTC()
+	data, marshalErr := json.Marshal(event)
+	if marshalErr != nil {
+		return marshalErr
+	}
+	msg := nats.NewMsg(b.subject(event.App, event.Type))
+	msg.Data = data
+	if event.RequestID != "" {
+		msg.Header.Set(RequestIDHeaderKey, event.RequestID)
+	}
+	if publishErr := b.conn.PublishMsg(msg); publishErr != nil {
+		b.logger.Error().Err(publishErr).Str("app", event.App).Str("event", event.Type).Str("connection_id", event.ConnectionID).Msg("failed to publish event")
+		return publishErr
+	}
+	return nil
+}
+
+// connected publishes the connection accepted by the application
+func (b *broker) connected(app string, conn *connection) {
+	if b == nil {
+		return
+	}
+	b.publish(brokerEvent{
+		Type:         connectedBrokerEvent,
+		App:          app,
+		ConnectionID: string(conn.id),
+		UserID:       conn.userID,
+		RequestID:    conn.requestID,
+	})
+}
+
+// disconnected publishes the disconnection the application is notified of
+func (b *broker) disconnected(ctx context.Context, app string, connId connectionID) {
+	if b == nil {
+		return
+	}
+	b.publish(brokerEvent{
+		Type:         disconnectedBrokerEvent,
+		App:          app,
+		ConnectionID: string(connId),
+		RequestID:    requestIDFromContext(ctx),
+	})
+}
+
+// messageReceived publishes the message received from a client
+func (b *broker) messageReceived(app string, msg inboundMessage) error {
+	if b == nil {
+		return nil
+	}
+	return b.publish(brokerEvent{
+		Type:         messageReceivedBrokerEvent,
+		App:          app,
+		ConnectionID: string(msg.connectionId),
+		RequestID:    msg.requestID,
+		MessageID:    msg.id,
+		Message:      &msg.data,
+	})
+}
+
+// subscribe consumes the commands of the applications. The commands addressing the same connection, user
+// or topic are applied in order.
+func (b *broker) subscribe(apps *applications, ids *connectionIDs) error {
+	if b == nil {
+		return nil
+	}
+	for _, name := range apps.names() {
+		app := apps.byName[name]
+		lanes := b.startLanes()
+		sub, subErr := b.conn.Subscribe(b.subject(name, "commands"), func(msg *nats.Msg) {
+			b.handleCommand(app, ids, lanes, msg)
+		})
+		if subErr != nil {
+			return subErr
+		}
+		b.drained.Add(1)
+		sub.SetClosedHandler(func(string) { b.drained.Done() })
+		b.subscriptions = append(b.subscriptions, sub)
+	}
+	return b.conn.Flush()
+}
+
+// startLanes starts the goroutines applying the commands of an application off the subscription.
+// Once stopping, they apply the commands left in their lane before returning.
+func (b *broker) startLanes() []chan func() {
+	lanes := make([]chan func(), commandLanes)
+	b.lanes.Add(commandLanes)
+	for i := range lanes {
+		lanes[i] = make(chan func(), commandLaneSize)
+		go func() {
+			defer b.lanes.Done()
+			for {
+				select {
+				case apply := <-lanes[i]:
+					apply()
+				case <-b.stopping:
+					for {
+						select {
+						case apply := <-lanes[i]:
+							apply()
+						default:
+							return
+						}
+					}
+				}
+			}
+		}()
+	}
+	return lanes
+}
+
+// handleCommand decodes the command and hands it over to its lane
+func (b *broker) handleCommand(app *application, ids *connectionIDs, lanes []chan func(), msg *nats.Msg) {
+	// The commands bear request IDs like the requests to the backend API
+	header := http.Header{}
+	header.Set(RequestIDHeaderKey, msg.Header.Get(RequestIDHeaderKey))
+	commandRequestID := requestID(header)
+	logger := b.logger.With().Str(logging.MethodLogger, "handleCommand").Str("app", app.name).Str("request_id", commandRequestID).Logger()
+	ctx := withRequestID(logger.WithContext(context.Background()), commandRequestID)
+
+	var cmd brokerCommand
+	if decodeErr := json.Unmarshal(msg.Data, &cmd); decodeErr != nil {
+		logger.Info().Err(decodeErr).Msg("failed to decode command")
+		b.reply(msg, brokerReply{Error: decodeErr.Error()})
+		return
+	}
+	logger = logger.With().Str("command", cmd.Type).Logger()
+
+	select {
+	case lanes[cmd.lane(len(lanes))] <- func() { b.applyCommand(ctx, app, ids, msg, cmd, commandRequestID, logger) }:
+	case <-b.stopping:
+	}
+}
+
+func (b *broker) applyCommand(ctx context.Context, app *application, ids *connectionIDs, msg *nats.Msg, cmd brokerCommand, commandRequestID string, logger zerolog.Logger) {
+	switch cmd.Type {
+	case pushBrokerCommand, closeBrokerCommand:
+		connId := connectionID(cmd.ConnectionID)
+		if !ids.verify(app.name, connId) {
+			b.reply(msg, brokerReply{Error: ErrConnectionNotFound.Error()})
+			return
+		}
+		if owner := connId.node(); owner != "" && owner != b.nodeID {
+			// The owner applies and answers it, the queue for an offline connection being that of the owner too
+			return
+		}
+		var queued bool
+		var err error
+		if cmd.Type == pushBrokerCommand {
+			queued, err = app.conns.pushOrQueue(ctx, cmd.Message, connId)
+		} else {
+			err = app.conns.close(connId, &backendCaller{remoteAddr: "broker", requestID: commandRequestID})
+		}
+		if err != nil {
+			logger.Info().Err(err).Str("connection_id", cmd.ConnectionID).Msg("failed to apply command")
+			b.reply(msg, brokerReply{Error: err.Error()})
+			return
+		}
+		b.reply(msg, brokerReply{Queued: queued})
+	case pushToUserBrokerCommand:
+		if _, _, err := app.conns.pushToUser(ctx, cmd.UserID, cmd.Message); err != nil {
+			logger.Info().Err(err).Str("user_id", cmd.UserID).Msg("failed to apply command")
+		}
+	case publishBrokerCommand:
+		if _, err := app.conns.publishToTopic(ctx, cmd.Topic, cmd.Message); err != nil {
+			logger.Info().Err(err).Str("topic", cmd.Topic).Msg("failed to apply command")
+		}
+	case broadcastBrokerCommand:
+		if _, err := app.conns.broadcast(ctx, cmd.Message); err != nil {
+			logger.Info().Err(err).Msg("failed to apply command")
+		}
+	default:
+		logger.Info().Msg("unknown command")
+		b.reply(msg, brokerReply{Error: errUnknownBrokerCommand.Error()})
+	}
+}
+
+// reply answers the command if it was sent as a request
+func (b *broker) reply(msg *nats.Msg, reply brokerReply) {
+	if msg.Reply == "" {
+		return
+	}
+	data, _ := json.Marshal(reply)
+	if respondErr := msg.Respond(data); respondErr != nil {
+		b.logger.Info().Err(respondErr).Msg("failed to reply to command")
+	}
+}
+
+// close stops consuming the commands, applies those already consumed, and flushes the events published
+// so far before closing the connection. It is to be called once the applications are closed, so that
+// their last events are published.
+func (b *broker) close() {
+	if b == nil {
+		return
+	}
+	for _, sub := range b.subscriptions {
+		if drainErr := sub.Drain(); drainErr != nil {
+			b.logger.Warn().Err(drainErr).Str("subject", sub.Subject).Msg("failed to drain subscription")
+			sub.Unsubscribe()
+		}
+	}
+	drained := make(chan struct{})
+	go func() {
+		b.drained.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(brokerCloseTimeout):
+		b.logger.Warn().Msg("subscriptions not drained in time")
+	}
+
+	close(b.stopping)
+	b.lanes.Wait()
+	if flushErr := b.conn.FlushTimeout(brokerCloseTimeout); flushErr != nil {
+		b.logger.Warn().Err(flushErr).Msg("failed to flush the events")
+	}
+	b.conn.Close()
+}
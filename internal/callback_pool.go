@@ -0,0 +1,214 @@
+package wsgw
+
+import (
+	"errors"
+	"sync"
+)
+
+// CallbackDispatchConfig configures the dispatch of the `/ws/message-received` callbacks to a pool of workers,
+// so that the pushes to a connection keep flowing while the callbacks for its messages are in flight
+type CallbackDispatchConfig struct {
+	// Workers is the number of callbacks in flight at most. 0 disables the pool: the callbacks are made
+	// one after the other by the connections, which relay no pushes meanwhile.
+	Workers int
+	// QueueSize is the number of messages per connection waiting for their callbacks at most. Defaults to 64.
+	QueueSize int
+	// WhenFull is what happens to the messages of a connection, whose queue is full: `pause` (the default)
+	// stops reading from the client until the queue has room, `drop` drops the messages and `close` closes
+	// the connection.
+	WhenFull string
+}
+
+const (
+	PauseOnFullQueue = "pause"
+	DropOnFullQueue  = "drop"
+	CloseOnFullQueue = "close"
+)
+
+const defaultCallbackQueueSize = 64
+
+// callbackQueueFullCloseReason is the reason connections are closed with when their callback queue is full
+const callbackQueueFullCloseReason = "too many messages waiting for the application"
+
+var errCallbackQueueFull = errors.New("callback queue full")
+
+// callbackPool runs the callbacks queued by the connections with a bounded number of workers. The callbacks
+// of a connection are run one after the other, in order, while the connections take turns.
+// A nil callbackPool is a disabled one.
+type callbackPool struct {
+	queueSize int
+	whenFull  string
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	ready  []*callbackQueue
+	closed bool
+
+	workers sync.WaitGroup
+}
+
+func newCallbackPool(conf CallbackDispatchConfig) *callbackPool {
+	if conf.Workers <= 0 {
+		return nil
+	}
+	queueSize := conf.QueueSize
+	if queueSize == 0 {
+		queueSize = defaultCallbackQueueSize
+	}
+	whenFull := conf.WhenFull
+	if whenFull == "" {
+		whenFull = PauseOnFullQueue
+	}
+	p := &callbackPool{
+		queueSize: queueSize,
+		whenFull:  whenFull,
+	}
+	p.cond = sync.NewCond(&p.mu)
+	p.workers.Add(conf.Workers)
+	for range conf.Workers {
+		go p.work()
+	}
+	return p
+}
+
+// newQueue returns the callback queue of a connection, nil if the pool is disabled
+func (p *callbackPool) newQueue() *callbackQueue {
+	if p == nil {
+		return nil
+	}
+	return &callbackQueue{
+		pool:  p,
+		space: make(chan struct{}, 1),
+	}
+}
+
+// schedule makes the queue take its turn
+func (p *callbackPool) schedule(q *callbackQueue) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		// The connections outliving the pool are served until they are gone
+		go q.runNext()
+		return
+	}
+	p.ready = append(p.ready, q)
+	p.cond.Signal()
+}
+
+func (p *callbackPool) work() {
+	defer p.workers.Done()
+	for {
+		p.mu.Lock()
+		for len(p.ready) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if len(p.ready) == 0 {
+			p.mu.Unlock()
+			return
+		}
+		q := p.ready[0]
+		p.ready = p.ready[1:]
+		p.mu.Unlock()
+
+		q.runNext()
+	}
+}
+
+// close stops the workers once the callbacks queued are run
+func (p *callbackPool) close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	p.workers.Wait()
+}
+
+// callbackQueue holds the callbacks of a connection. It is scheduled in the pool while it isn't empty.
+// A nil callbackQueue runs the callbacks right away.
+type callbackQueue struct {
+	pool *callbackPool
+
+	mu        sync.Mutex
+	callbacks []func()
+	scheduled bool
+	// onIdle are called once the callbacks queued are run
+	onIdle []func()
+
+	// space is signaled when a callback is taken from the queue
+	space chan struct{}
+}
+
+// tryAdd queues the callback unless the queue is full
+func (q *callbackQueue) tryAdd(callback func()) bool {
+	return q.enqueue(callback, false)
+}
+
+// add queues the callback even if the queue is full
+func (q *callbackQueue) add(callback func()) {
+	q.enqueue(callback, true)
+}
+
+func (q *callbackQueue) enqueue(callback func(), evenIfFull bool) bool {
+	q.mu.Lock()
+	if !evenIfFull && len(q.callbacks) >= q.pool.queueSize {
+		q.mu.Unlock()
+		return false
+	}
+	q.callbacks = append(q.callbacks, callback)
+	schedule := !q.scheduled
+	q.scheduled = true
+	q.mu.Unlock()
+
+	if schedule {
+		q.pool.schedule(q)
+	}
+	return true
+}
+
+// runNext runs the next callback, then lets the queue take its next turn if more are queued
+func (q *callbackQueue) runNext() {
+	q.mu.Lock()
+	callback := q.callbacks[0]
+	q.callbacks = q.callbacks[1:]
+	q.mu.Unlock()
+
+	select {
+	case q.space <- struct{}{}:
+	default:
+	}
+	callback()
+
+	q.mu.Lock()
+	if len(q.callbacks) > 0 {
+		q.mu.Unlock()
+		q.pool.schedule(q)
+		return
+	}
+	q.scheduled = false
+	onIdle := q.onIdle
+	q.onIdle = nil
+	q.mu.Unlock()
+
+	for _, f := range onIdle {
+		f()
+	}
+}
+
+// whenIdle calls `f` once the callbacks queued are run, right away if there are none
+func (q *callbackQueue) whenIdle(f func()) {
+	if q == nil {
+		f()
+		return
+	}
+	q.mu.Lock()
+	if !q.scheduled {
+		q.mu.Unlock()
+		f()
+		return
+	}
+	q.onIdle = append(q.onIdle, f)
+	q.mu.Unlock()
+}
@@ -0,0 +1,100 @@
+package wsgw
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// CircuitBreakerConfig configures the circuit breaker of the callbacks to an application
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed callbacks opening the circuit. 0 disables the breaker.
+	// Callbacks fail if they can't be sent or the application responds with a 5xx status code.
+	FailureThreshold int
+	// OpenDuration is how long the callbacks fail fast once the circuit is open, before a single callback
+	// is let through to probe the application. Defaults to 30 seconds.
+	OpenDuration time.Duration
+}
+
+const defaultCircuitOpenDuration = 30 * time.Second
+
+var errCircuitOpen = errors.New("callback circuit open")
+
+// circuitBreaker stops the callbacks to an application, which keeps failing, for a while. A nil breaker
+// lets all callbacks through.
+type circuitBreaker struct {
+	failureThreshold int
+	openDuration     time.Duration
+
+	mu       sync.Mutex
+	failures int
+	// openedAt is zero while the circuit is closed
+	openedAt time.Time
+	// probing is set while the callback probing the application after the open duration is in flight
+	probing bool
+}
+
+func newCircuitBreaker(conf CircuitBreakerConfig) *circuitBreaker {
+	if conf.FailureThreshold <= 0 {
+		return nil
+	}
+	openDuration := conf.OpenDuration
+	if openDuration <= 0 {
+		openDuration = defaultCircuitOpenDuration
+	}
+	return &circuitBreaker{
+		failureThreshold: conf.FailureThreshold,
+		openDuration:     openDuration,
+	}
+}
+
+// allow reports whether a callback may be sent. Its outcome must then be recorded with `record`.
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if time.Since(b.openedAt) < b.openDuration || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *circuitBreaker) record(success bool) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.failures = 0
+		b.openedAt = time.Time{}
+		return
+	}
+	b.failures++
+	if b.failures >= b.failureThreshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// isOpen reports whether the callbacks currently fail fast
+func (b *circuitBreaker) isOpen() bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return !b.openedAt.IsZero() && time.Since(b.openedAt) < b.openDuration
+}
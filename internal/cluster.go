@@ -0,0 +1,266 @@
+package wsgw
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"websocket-gateway/internal/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// ClusterConfig makes several gateway instances cooperate, so that backends can address
+// any connection through any of the instances
+type ClusterConfig struct {
+	// NodeID identifies this instance among the nodes of the cluster. It is encoded in the IDs
+	// of the connections owned by this instance and must not contain dots.
+	NodeID string
+	// Peers maps the IDs of the other nodes to the base URLs this instance can reach them at
+	Peers map[string]string
+	// SharedKey authenticates the requests forwarded between the nodes of the cluster. It is required with
+	// peers and must be the same on all nodes.
+	SharedKey string
+}
+
+// ForwardedByHeaderKey marks the requests forwarded between the nodes of the cluster with the ID of the forwarding node
+const ForwardedByHeaderKey = "X-WSGW-FORWARDED-BY"
+
+// ClusterKeyHeaderKey carries the shared key of the cluster in the requests forwarded between its nodes
+const ClusterKeyHeaderKey = "X-WSGW-CLUSTER-KEY"
+
+type clusterPeer struct {
+	nodeID  string
+	baseUrl *url.URL
+	proxy   *httputil.ReverseProxy
+}
+
+type cluster struct {
+	nodeID     string
+	sharedKey  string
+	peers      map[string]*clusterPeer
+	httpClient *http.Client
+	logger     zerolog.Logger
+}
+
+func newCluster(conf ClusterConfig, logger zerolog.Logger) (*cluster, error) {
+	if strings.Contains(conf.NodeID, nodeSeparator) {
+		return nil, fmt.Errorf("node ID %s contains '%s'", conf.NodeID, nodeSeparator)
+	}
+	if conf.NodeID == "" && len(conf.Peers) > 0 {
+		return nil, errors.New("node ID is required in clustered mode")
+	}
+	if conf.SharedKey == "" && len(conf.Peers) > 0 {
+		return nil, errors.New("shared key is required in clustered mode")
+	}
+
+	c := &cluster{
+		nodeID:    conf.NodeID,
+		sharedKey: conf.SharedKey,
+		peers:     make(map[string]*clusterPeer),
+		httpClient: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+		logger: logger.With().Str(logging.UnitLogger, "cluster").Str("node_id", conf.NodeID).Logger(),
+	}
+
+	for nodeID, peerUrl := range conf.Peers {
+		if nodeID == conf.NodeID {
+			continue
+		}
+		if strings.Contains(nodeID, nodeSeparator) {
+			return nil, fmt.Errorf("node ID %s contains '%s'", nodeID, nodeSeparator)
+		}
+		parsedUrl, parseErr := url.Parse(peerUrl)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid URL for peer %s: %w", nodeID, parseErr)
+		}
+		c.peers[nodeID] = &clusterPeer{
+			nodeID:  nodeID,
+			baseUrl: parsedUrl,
+			proxy:   httputil.NewSingleHostReverseProxy(parsedUrl),
+		}
+	}
+
+	return c, nil
+}
+
+func isForwarded(g *gin.Context) bool {
+	return g.GetHeader(ForwardedByHeaderKey) != ""
+}
+
+// markForwarded marks the request forwarded by this node to a peer
+func (c *cluster) markForwarded(header http.Header) {
+	header.Set(ForwardedByHeaderKey, c.nodeID)
+	header.Set(ClusterKeyHeaderKey, c.sharedKey)
+}
+
+// forwardedAuthenticator removes the mark of forwarded requests from the requests, which don't bear the shared
+// key of the cluster, so that callers can't pass their requests off as forwarded by a node
+func (c *cluster) forwardedAuthenticator() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		header := g.Request.Header
+		if header.Get(ForwardedByHeaderKey) != "" {
+			key := header.Get(ClusterKeyHeaderKey)
+			if c.sharedKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(c.sharedKey)) != 1 {
+				zerolog.Ctx(g.Request.Context()).Info().Str("forwarded_by", header.Get(ForwardedByHeaderKey)).Msg("unauthenticated forwarded request")
+				header.Del(ForwardedByHeaderKey)
+			}
+		}
+		header.Del(ClusterKeyHeaderKey)
+		g.Next()
+	}
+}
+
+// connectionRouter forwards the requests addressing connections owned by other nodes of the cluster
+// to the owning node
+func (c *cluster) connectionRouter(connIdPathParamName string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		connId := connectionID(g.Param(connIdPathParamName))
+		owner := connId.node()
+		if owner == "" || owner == c.nodeID {
+			g.Next()
+			return
+		}
+
+		logger := c.logger.With().Str(logging.MethodLogger, "connectionRouter").Str("connection_id", string(connId)).Str("owner", owner).Logger()
+
+		if isForwarded(g) {
+			// Requests are forwarded only to the owning node, so something is off with the configuration of the cluster
+			logger.Error().Str("forwarded_by", g.GetHeader(ForwardedByHeaderKey)).Msg("connection not owned by the node it was forwarded to")
+			g.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		peer, ok := c.peers[owner]
+		if !ok {
+			logger.Info().Msg("unknown owner node")
+			g.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		logger.Debug().Msg("forwarding request to owner node")
+		c.markForwarded(g.Request.Header)
+		peer.proxy.ServeHTTP(g.Writer, g.Request)
+		g.Abort()
+	}
+}
+
+// resumeRouter forwards the requests resuming a session retained by another node of the cluster
+// to that node, which then takes over the connection
+func (c *cluster) resumeRouter() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		owner := resumeTokenNode(g.Query(resumeTokenQueryParam))
+		if owner == "" || owner == c.nodeID || isForwarded(g) {
+			g.Next()
+			return
+		}
+
+		peer, ok := c.peers[owner]
+		if !ok {
+			// the session can't be resumed, but the client still gets a new one
+			g.Next()
+			return
+		}
+
+		c.logger.Debug().Str(logging.MethodLogger, "resumeRouter").Str("owner", owner).Msg("forwarding request to owner node")
+		c.markForwarded(g.Request.Header)
+		peer.proxy.ServeHTTP(g.Writer, g.Request)
+		g.Abort()
+	}
+}
+
+// broadcastToPeers forwards a broadcast request to all other nodes of the cluster
+// and returns the number of recipients reached and of messages queued there
+func (c *cluster) broadcastToPeers(ctx context.Context, path string, header http.Header, message string) broadcastResponse {
+	logger := c.logger.With().Str(logging.MethodLogger, "broadcastToPeers").Logger()
+
+	body, marshalErr := json.Marshal(message)
+	if marshalErr != nil {
+		logger.Error().Err(marshalErr).Msg("failed to marshal message")
+		return broadcastResponse{}
+	}
+
+	var totalMu sync.Mutex
+	total := broadcastResponse{}
+
+	var wg sync.WaitGroup
+	for _, peer := range c.peers {
+		wg.Add(1)
+		go func(peer *clusterPeer) {
+			defer wg.Done()
+
+			peerResult, err := c.broadcastToPeer(ctx, peer, path, header, body)
+			if err != nil {
+				logger.Error().Str("peer", peer.nodeID).Err(err).Msg("failed to forward broadcast")
+				return
+			}
+			totalMu.Lock()
+			total.add(peerResult)
+			totalMu.Unlock()
+		}(peer)
+	}
+	wg.Wait()
+
+	return total
+}
+
+func (c *cluster) broadcastToPeer(ctx context.Context, peer *clusterPeer, path string, header http.Header, body []byte) (broadcastResponse, error) {
+	request, createErr := http.NewRequestWithContext(ctx, http.MethodPost, peer.baseUrl.JoinPath(path).String(), bytes.NewReader(body))
+	if createErr != nil {
+		return broadcastResponse{}, createErr
+	}
+	request.Header = header.Clone()
+	c.markForwarded(request.Header)
+
+	response, requestErr := c.httpClient.Do(request)
+	if requestErr != nil {
+		return broadcastResponse{}, requestErr
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, response.Body)
+		return broadcastResponse{}, fmt.Errorf("unexpected status code: %d", response.StatusCode)
+	}
+
+	var result broadcastResponse
+	if decodeErr := json.NewDecoder(response.Body).Decode(&result); decodeErr != nil {
+		return broadcastResponse{}, decodeErr
+	}
+	return result, nil
+}
+
+// forward sends a request of the backend API at `path` to the node `owner` of the connection it addresses and returns
+// the status code of the response. Connections of unknown nodes are not found.
+func (c *cluster) forward(ctx context.Context, owner string, method string, path string, header http.Header, body []byte) (int, error) {
+	peer, ok := c.peers[owner]
+	if !ok {
+		return 0, ErrConnectionNotFound
+	}
+
+	request, createErr := http.NewRequestWithContext(ctx, method, peer.baseUrl.JoinPath(path).String(), bytes.NewReader(body))
+	if createErr != nil {
+		return 0, createErr
+	}
+	request.Header = header.Clone()
+	c.markForwarded(request.Header)
+
+	response, requestErr := c.httpClient.Do(request)
+	if requestErr != nil {
+		return 0, requestErr
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+	return response.StatusCode, nil
+}
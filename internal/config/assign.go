@@ -0,0 +1,226 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+var errUnknownOption = errors.New("unknown option")
+
+// normalizeName makes the option names of the different sources comparable: `BackendAPIKeys`,
+// `backendApiKeys`, `backend_api_keys` and `BACKEND-API-KEYS` all name the same option
+func normalizeName(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// field returns the field of the struct `target` named `name` in any of the forms accepted by normalizeName
+func field(target reflect.Value, name string) (reflect.Value, bool) {
+	normalized := normalizeName(name)
+	for i := 0; i < target.NumField(); i++ {
+		if target.Type().Field(i).IsExported() && normalizeName(target.Type().Field(i).Name) == normalized {
+			return target.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// setPath sets the option at `path` below `target` to the string `value`
+func setPath(target reflect.Value, path []string, value string, at string) error {
+	if len(path) == 0 {
+		return assign(target, value, at)
+	}
+
+	switch target.Kind() {
+	case reflect.Struct:
+		f, ok := field(target, path[0])
+		if !ok {
+			return fmt.Errorf("%w: %s", errUnknownOption, joinPath(at, path[0]))
+		}
+		return setPath(f, path[1:], value, joinPath(at, path[0]))
+	case reflect.Slice:
+		index, indexErr := strconv.Atoi(path[0])
+		if indexErr != nil || index < 0 {
+			return fmt.Errorf("%s: %q is not an index", at, path[0])
+		}
+		if index >= target.Len() {
+			grown := reflect.MakeSlice(target.Type(), index+1, index+1)
+			reflect.Copy(grown, target)
+			target.Set(grown)
+		}
+		return setPath(target.Index(index), path[1:], value, joinPath(at, path[0]))
+	case reflect.Map:
+		if len(path) > 1 {
+			return fmt.Errorf("%w: %s", errUnknownOption, joinPath(at, strings.Join(path, ".")))
+		}
+		if target.IsNil() {
+			target.Set(reflect.MakeMap(target.Type()))
+		}
+		entry := reflect.New(target.Type().Elem()).Elem()
+		if assignErr := assign(entry, value, joinPath(at, path[0])); assignErr != nil {
+			return assignErr
+		}
+		target.SetMapIndex(reflect.ValueOf(path[0]), entry)
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", errUnknownOption, joinPath(at, strings.Join(path, ".")))
+	}
+}
+
+// assign sets `target` to `value` as decoded from a configuration file or, for the environment
+// variables and overrides, as a string. In strings, list items are separated by commas and map
+// entries are given as `key=value`.
+func assign(target reflect.Value, value any, at string) error {
+	if target.Type() == durationType {
+		text, isText := value.(string)
+		if !isText {
+			return fmt.Errorf("%s: expected a duration like 30s or 500ms", at)
+		}
+		duration, parseErr := time.ParseDuration(text)
+		if parseErr != nil {
+			return fmt.Errorf("%s: %w", at, parseErr)
+		}
+		target.SetInt(int64(duration))
+		return nil
+	}
+
+	switch target.Kind() {
+	case reflect.Struct:
+		settings, isMap := value.(map[string]any)
+		if !isMap {
+			return fmt.Errorf("%s: expected a table of options", at)
+		}
+		for name, setting := range settings {
+			f, ok := field(target, name)
+			if !ok {
+				return fmt.Errorf("%w: %s", errUnknownOption, joinPath(at, name))
+			}
+			if assignErr := assign(f, setting, joinPath(at, name)); assignErr != nil {
+				return assignErr
+			}
+		}
+		return nil
+
+	case reflect.Slice:
+		items := reflect.ValueOf(value)
+		if text, isText := value.(string); isText {
+			if text == "" {
+				items = reflect.ValueOf([]string{})
+			} else {
+				items = reflect.ValueOf(strings.Split(text, ","))
+			}
+		}
+		if items.Kind() != reflect.Slice {
+			return fmt.Errorf("%s: expected a list", at)
+		}
+		list := reflect.MakeSlice(target.Type(), items.Len(), items.Len())
+		for i := 0; i < items.Len(); i++ {
+			if assignErr := assign(list.Index(i), items.Index(i).Interface(), joinPath(at, strconv.Itoa(i))); assignErr != nil {
+				return assignErr
+			}
+		}
+		target.Set(list)
+		return nil
+
+	case reflect.Map:
+		entries := map[string]any{}
+		switch v := value.(type) {
+		case map[string]any:
+			entries = v
+		case string:
+			for _, entry := range strings.Split(v, ",") {
+				key, entryValue, ok := strings.Cut(entry, "=")
+				if !ok {
+					return fmt.Errorf("%s: expected key=value entries, got %q", at, entry)
+				}
+				entries[key] = entryValue
+			}
+		default:
+			return fmt.Errorf("%s: expected a table", at)
+		}
+		m := reflect.MakeMapWithSize(target.Type(), len(entries))
+		for key, entryValue := range entries {
+			entry := reflect.New(target.Type().Elem()).Elem()
+			if assignErr := assign(entry, entryValue, joinPath(at, key)); assignErr != nil {
+				return assignErr
+			}
+			m.SetMapIndex(reflect.ValueOf(key), entry)
+		}
+		target.Set(m)
+		return nil
+	}
+
+	return assignScalar(target, value, at)
+}
+
+func assignScalar(target reflect.Value, value any, at string) error {
+	v := reflect.ValueOf(value)
+	text, isText := value.(string)
+	text = strings.TrimSpace(text)
+
+	switch target.Kind() {
+	case reflect.String:
+		switch v.Kind() {
+		case reflect.String, reflect.Int, reflect.Int64, reflect.Float64, reflect.Bool:
+			target.SetString(fmt.Sprint(value))
+			return nil
+		}
+	case reflect.Int, reflect.Int64:
+		switch {
+		case isText:
+			i, parseErr := strconv.ParseInt(text, 10, 64)
+			if parseErr != nil {
+				return fmt.Errorf("%s: %q is not an integer", at, text)
+			}
+			target.SetInt(i)
+			return nil
+		case v.CanInt():
+			target.SetInt(v.Int())
+			return nil
+		}
+	case reflect.Float64:
+		switch {
+		case isText:
+			f, parseErr := strconv.ParseFloat(text, 64)
+			if parseErr != nil {
+				return fmt.Errorf("%s: %q is not a number", at, text)
+			}
+			target.SetFloat(f)
+			return nil
+		case v.CanInt():
+			target.SetFloat(float64(v.Int()))
+			return nil
+		case v.CanFloat():
+			target.SetFloat(v.Float())
+			return nil
+		}
+	case reflect.Bool:
+		switch {
+		case isText:
+			b, parseErr := strconv.ParseBool(text)
+			if parseErr != nil {
+				return fmt.Errorf("%s: %q is not a boolean", at, text)
+			}
+			target.SetBool(b)
+			return nil
+		case v.Kind() == reflect.Bool:
+			target.SetBool(v.Bool())
+			return nil
+		}
+	default:
+		return fmt.Errorf("%s: options of type %s are not supported", at, target.Type())
+	}
+	return fmt.Errorf("%s: unexpected value %v for an option of type %s", at, value, target.Type())
+}
@@ -0,0 +1,118 @@
+// Package config loads the configuration of the gateway from a file, the environment and command line overrides
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	wsgw "websocket-gateway/internal"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variables setting configuration options, e.g. `WSGW_SERVER_PORT`.
+// Nested options are separated by a double underscore, e.g. `WSGW_REGISTRY__REDIS_ADDRESS` or
+// `WSGW_APPS__0__BACKEND_API_KEYS`.
+const EnvPrefix = "WSGW_"
+
+// FileEnvVar names the configuration file, unless it is given on the command line
+const FileEnvVar = EnvPrefix + "CONFIG"
+
+const (
+	envPathSeparator      = "__"
+	overridePathSeparator = "."
+)
+
+// DefaultServerPort is the port the gateway listens at unless configured otherwise
+const DefaultServerPort = 8080
+
+// Sources are where the configuration is loaded from. Each source takes precedence over the previous one:
+// the defaults, the file, the environment variables and the overrides.
+type Sources struct {
+	// File is the path of a YAML (`.yaml`, `.yml`) or TOML (`.toml`) file. Optional.
+	File string
+	// Environ are the environment variables in the `key=value` form of `os.Environ`. Those with the
+	// EnvPrefix set configuration options.
+	Environ []string
+	// Overrides are options in the `Path.To.Option=value` form, e.g. `Apps.0.BaseUrl=http://app`,
+	// applied in order.
+	Overrides []string
+}
+
+var errUnknownFileFormat = errors.New("unknown configuration file format, expected .yaml, .yml or .toml")
+
+// Defaults returns the configuration the sources are applied to
+func Defaults() wsgw.Config {
+	return wsgw.Config{
+		ServerPort: DefaultServerPort,
+	}
+}
+
+// Load loads and validates the configuration
+func Load(sources Sources) (wsgw.Config, error) {
+	conf := Defaults()
+	target := reflect.ValueOf(&conf).Elem()
+
+	if sources.File != "" {
+		settings, readErr := readFile(sources.File)
+		if readErr != nil {
+			return wsgw.Config{}, fmt.Errorf("failed to read %s: %w", sources.File, readErr)
+		}
+		if assignErr := assign(target, settings, ""); assignErr != nil {
+			return wsgw.Config{}, fmt.Errorf("invalid configuration in %s: %w", sources.File, assignErr)
+		}
+	}
+
+	for _, variable := range sources.Environ {
+		key, value, _ := strings.Cut(variable, "=")
+		name, hasPrefix := strings.CutPrefix(key, EnvPrefix)
+		if !hasPrefix || key == FileEnvVar {
+			continue
+		}
+		if setErr := setPath(target, strings.Split(name, envPathSeparator), value, ""); setErr != nil {
+			return wsgw.Config{}, fmt.Errorf("invalid environment variable %s: %w", key, setErr)
+		}
+	}
+
+	for _, override := range sources.Overrides {
+		path, value, hasValue := strings.Cut(override, "=")
+		if !hasValue {
+			return wsgw.Config{}, fmt.Errorf("invalid override %q, expected Path.To.Option=value", override)
+		}
+		if setErr := setPath(target, strings.Split(path, overridePathSeparator), value, ""); setErr != nil {
+			return wsgw.Config{}, fmt.Errorf("invalid override %s: %w", path, setErr)
+		}
+	}
+
+	if validationErr := conf.Validate(); validationErr != nil {
+		return wsgw.Config{}, fmt.Errorf("invalid configuration: %w", validationErr)
+	}
+	return conf, nil
+}
+
+// readFile reads the settings of the configuration file in the format indicated by its extension
+func readFile(path string) (map[string]any, error) {
+	content, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	settings := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if unmarshalErr := yaml.Unmarshal(content, &settings); unmarshalErr != nil {
+			return nil, unmarshalErr
+		}
+	case ".toml":
+		if unmarshalErr := toml.Unmarshal(content, &settings); unmarshalErr != nil {
+			return nil, unmarshalErr
+		}
+	default:
+		return nil, errUnknownFileFormat
+	}
+	return settings, nil
+}
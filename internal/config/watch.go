@@ -0,0 +1,58 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce lets editors and deployment tools finish writing the file before it is read
+const watchDebounce = 200 * time.Millisecond
+
+// Watch calls `onChange` whenever the content of the file at `path` changes, until `ctx` is done.
+// The directory of the file is watched, so that files replaced by renaming (e.g. by editors or
+// as Kubernetes ConfigMap volumes) are followed.
+func Watch(ctx context.Context, path string, onChange func()) error {
+	watcher, watcherErr := fsnotify.NewWatcher()
+	if watcherErr != nil {
+		return watcherErr
+	}
+	if addErr := watcher.Add(filepath.Dir(path)); addErr != nil {
+		watcher.Close()
+		return addErr
+	}
+
+	lastContent, _ := os.ReadFile(path)
+	go func() {
+		defer watcher.Close()
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				debounce = time.After(watchDebounce)
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			case <-debounce:
+				content, readErr := os.ReadFile(path)
+				if readErr != nil || bytes.Equal(content, lastContent) {
+					continue
+				}
+				lastContent = content
+				onChange()
+			}
+		}
+	}()
+	return nil
+}
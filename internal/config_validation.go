@@ -0,0 +1,126 @@
+package wsgw
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"websocket-gateway/internal/logging"
+)
+
+// Validate reports the problems of the configuration, which can be found without setting up the server
+func (c Config) Validate() error {
+	var problems []error
+	check := func(problem error) {
+		if problem != nil {
+			problems = append(problems, problem)
+		}
+	}
+
+	check(validatePort("ServerPort", c.ServerPort))
+	check(validatePort("Admin.ServerPort", c.Admin.ServerPort))
+	if c.Admin.ServerPort != 0 && c.Admin.ServerPort == c.ServerPort {
+		problems = append(problems, errors.New("Admin.ServerPort must differ from ServerPort"))
+	}
+	check(validatePort("GRPC.ServerPort", c.GRPC.ServerPort))
+	if c.GRPC.ServerPort != 0 && (c.GRPC.ServerPort == c.ServerPort || c.GRPC.ServerPort == c.Admin.ServerPort) {
+		problems = append(problems, errors.New("GRPC.ServerPort must differ from ServerPort and Admin.ServerPort"))
+	}
+	if (c.GRPC.CertFile == "") != (c.GRPC.KeyFile == "") {
+		problems = append(problems, errors.New("GRPC.CertFile and GRPC.KeyFile must be set together"))
+	}
+	if c.GRPC.ServerPort != 0 && !c.GRPC.tls() && !c.GRPC.loopback() &&
+		slices.ContainsFunc(c.Apps, func(app AppConfig) bool { return len(app.BackendAPIKeys) > 0 }) {
+		problems = append(problems, errors.New("GRPC.CertFile and GRPC.KeyFile are required for the backend API keys not to be sent in plaintext to a non-loopback GRPC.ServerHost"))
+	}
+	if c.Admin.ServerPort != 0 && len(c.Admin.APIKeys) == 0 {
+		problems = append(problems, errMissingAdminAPIKeys)
+	}
+
+	if c.AppBaseUrl != "" {
+		check(validateURL("AppBaseUrl", c.AppBaseUrl))
+	}
+	for i, app := range c.Apps {
+		check(validateURL(fmt.Sprintf("Apps[%d].BaseUrl", i), app.BaseUrl))
+		if slices.Contains(reservedAppNames, app.Name) {
+			problems = append(problems, fmt.Errorf("Apps[%d].Name: %q is reserved for the paths of the other transports", i, app.Name))
+		}
+		if app.MessageFormat != "" && !slices.Contains([]string{RawMessageFormat, JSONEnvelopeMessageFormat}, app.MessageFormat) {
+			problems = append(problems, fmt.Errorf("Apps[%d].MessageFormat: unknown message format %q", i, app.MessageFormat))
+		}
+		if app.OfflineQueue.Eviction != "" && !slices.Contains([]string{DropOldestEviction, RejectEviction}, app.OfflineQueue.Eviction) {
+			problems = append(problems, fmt.Errorf("Apps[%d].OfflineQueue.Eviction: unknown eviction policy %q", i, app.OfflineQueue.Eviction))
+		}
+		if app.MaxConnections < 0 || app.MessageBufferSize < 0 || app.ReplayBufferSize < 0 || app.PushRateLimit < 0 || app.PushBurst < 0 {
+			problems = append(problems, fmt.Errorf("Apps[%d]: limits and buffer sizes must not be negative", i))
+		}
+		if app.MessageBatching.MaxMessages < 0 || app.MessageBatching.MaxDelay < 0 {
+			problems = append(problems, fmt.Errorf("Apps[%d].MessageBatching: limits must not be negative", i))
+		}
+		if app.CallbackDispatch.Workers < 0 || app.CallbackDispatch.QueueSize < 0 {
+			problems = append(problems, fmt.Errorf("Apps[%d].CallbackDispatch: limits must not be negative", i))
+		}
+		if app.CallbackDispatch.WhenFull != "" && !slices.Contains([]string{PauseOnFullQueue, DropOnFullQueue, CloseOnFullQueue}, app.CallbackDispatch.WhenFull) {
+			problems = append(problems, fmt.Errorf("Apps[%d].CallbackDispatch.WhenFull: unknown policy %q", i, app.CallbackDispatch.WhenFull))
+		}
+		if payloadLoggingErr := app.PayloadLogging.validate(); payloadLoggingErr != nil {
+			problems = append(problems, fmt.Errorf("Apps[%d].PayloadLogging.%w", i, payloadLoggingErr))
+		}
+	}
+	for nodeID, baseUrl := range c.Cluster.Peers {
+		check(validateURL(fmt.Sprintf("Cluster.Peers[%s]", nodeID), baseUrl))
+	}
+	if c.LongPolling.Wait < 0 || c.LongPolling.Timeout < 0 {
+		problems = append(problems, errors.New("LongPolling: durations must not be negative"))
+	}
+	if c.Tracing.OTLPEndpoint != "" {
+		check(validateURL("Tracing.OTLPEndpoint", c.Tracing.OTLPEndpoint))
+	}
+
+	if !slices.Contains([]string{"", MemoryRegistryType, RedisRegistryType}, c.Registry.Type) {
+		problems = append(problems, fmt.Errorf("Registry.Type: %w: %q", errUnknownRegistryType, c.Registry.Type))
+	}
+	if c.Registry.Type == RedisRegistryType && c.Registry.RedisAddress == "" {
+		problems = append(problems, errors.New("Registry.RedisAddress is required by the redis registry"))
+	}
+	if c.Registry.Type == RedisRegistryType && c.Cluster.NodeID == "" {
+		problems = append(problems, errors.New("Cluster.NodeID is required by the redis registry, so that the nodes remove the connections of the lapsed ones"))
+	}
+	if !slices.Contains([]string{"", NATSBrokerType}, c.Broker.Type) {
+		problems = append(problems, fmt.Errorf("Broker.Type: %w: %q", errUnknownBrokerType, c.Broker.Type))
+	}
+	if c.Broker.Type != "" && c.Cluster.NodeID == "" {
+		problems = append(problems, errors.New("Cluster.NodeID is required by the message broker, so that only the node owning a connection answers its commands"))
+	}
+	if !slices.Contains([]string{"", XidGenerator, UUIDv7Generator, ULIDGenerator}, c.ConnectionIDs.Generator) {
+		problems = append(problems, fmt.Errorf("ConnectionIDs.Generator: unknown connection ID generator %q", c.ConnectionIDs.Generator))
+	}
+
+	if loggingErr := c.Logging.Validate(); loggingErr != nil {
+		problems = append(problems, fmt.Errorf("Logging: %w", loggingErr))
+	}
+	if auditErr := (logging.Config{Outputs: c.Audit.Outputs}).Validate(); auditErr != nil {
+		problems = append(problems, fmt.Errorf("Audit: %w", auditErr))
+	}
+
+	return errors.Join(problems...)
+}
+
+func validatePort(name string, port int) error {
+	if port < 0 || port > 65535 {
+		return fmt.Errorf("%s: %d is not a valid port", name, port)
+	}
+	return nil
+}
+
+// validateURL verifies that `rawUrl` is an absolute HTTP(S) URL
+func validateURL(name string, rawUrl string) error {
+	parsed, parseErr := url.Parse(rawUrl)
+	if parseErr != nil {
+		return fmt.Errorf("%s: %w", name, parseErr)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%s: %q is not an absolute http(s) URL", name, rawUrl)
+	}
+	return nil
+}
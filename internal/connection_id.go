@@ -1,9 +1,142 @@
 package wsgw
 
-import "github.com/rs/xid"
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
 
 type connectionID string
 
-func createID() connectionID {
-	return connectionID(xid.New().String())
+// ConnectionIDConfig configures the format of the connection IDs
+type ConnectionIDConfig struct {
+	// Generator generates the unique part of the IDs: `xid` (the default), `uuidv7` or `ulid`
+	Generator string
+	// SigningKeys, if not empty, make the connection IDs signed with the first key, so that they can't be
+	// forged or used with any other application than the one they were issued for. All keys are accepted
+	// when verifying the IDs, which allows for rotating the keys. All nodes of a cluster must share the keys.
+	SigningKeys []string
+}
+
+const (
+	XidGenerator    = "xid"
+	UUIDv7Generator = "uuidv7"
+	ULIDGenerator   = "ulid"
+)
+
+// nodeSeparator separates the parts of a connection ID: `${uniqueId}[.${nodeId}]` or, if signed,
+// `${uniqueId}.${nodeId}.${signature}` where `nodeId` may be empty
+const nodeSeparator = "."
+
+// signatureLength is the number of bytes of the HMAC kept in the signed IDs
+const signatureLength = 16
+
+// connectionIDs creates and verifies the connection IDs of a node
+type connectionIDs struct {
+	nodeID      string
+	generate    func() string
+	signingKeys [][]byte
+}
+
+func newConnectionIDs(conf ConnectionIDConfig, nodeID string) (*connectionIDs, error) {
+	ids := &connectionIDs{
+		nodeID: nodeID,
+	}
+
+	switch conf.Generator {
+	case "", XidGenerator:
+		ids.generate = func() string { return xid.New().String() }
+	case UUIDv7Generator:
+		ids.generate = func() string { return uuid.Must(uuid.NewV7()).String() }
+	case ULIDGenerator:
+		ids.generate = func() string { return ulid.Make().String() }
+	default:
+		return nil, fmt.Errorf("unknown connection ID generator: %s", conf.Generator)
+	}
+
+	for _, key := range conf.SigningKeys {
+		if key == "" {
+			return nil, errors.New("empty connection ID signing key")
+		}
+		ids.signingKeys = append(ids.signingKeys, []byte(key))
+	}
+
+	return ids, nil
+}
+
+// create creates a new connection ID for a connection of the application `app` owned by this node.
+// The ID of the node is encoded in the connection ID if not empty.
+func (ids *connectionIDs) create(app string) connectionID {
+	id := ids.generate()
+	if len(ids.signingKeys) > 0 {
+		unsigned := id + nodeSeparator + ids.nodeID
+		return connectionID(unsigned + nodeSeparator + sign(ids.signingKeys[0], app, unsigned))
+	}
+	if ids.nodeID == "" {
+		return connectionID(id)
+	}
+	return connectionID(id + nodeSeparator + ids.nodeID)
+}
+
+// verify checks the signature of `connId` for the application `app`. IDs are not checked when
+// signing is disabled.
+func (ids *connectionIDs) verify(app string, connId connectionID) bool {
+	if len(ids.signingKeys) == 0 {
+		return true
+	}
+
+	parts := strings.Split(string(connId), nodeSeparator)
+	if len(parts) != 3 {
+		return false
+	}
+	unsigned := parts[0] + nodeSeparator + parts[1]
+	for _, key := range ids.signingKeys {
+		if hmac.Equal([]byte(parts[2]), []byte(sign(key, app, unsigned))) {
+			return true
+		}
+	}
+	return false
+}
+
+func sign(key []byte, app string, unsigned string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(app))
+	mac.Write([]byte{0})
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureLength])
+}
+
+// node returns the ID of the gateway node owning the connection
+func (id connectionID) node() string {
+	parts := strings.Split(string(id), nodeSeparator)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// connectionIDVerifier rejects the requests addressing a connection by an ID not issued by the gateway
+// for the application selected for the request. Such IDs are reported as not found,
+// so that they can't be told apart from the IDs of closed connections.
+func connectionIDVerifier(ids *connectionIDs, connIdPathParamName string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		app := appFromContext(g)
+		connId := connectionID(g.Param(connIdPathParamName))
+		if !ids.verify(app.name, connId) {
+			zerolog.Ctx(g.Request.Context()).Info().Str("app", app.name).Str("connection_id", string(connId)).Msg("invalid connection ID")
+			g.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		g.Next()
+	}
 }
@@ -0,0 +1,93 @@
+package wsgw
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/xid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The formats of the messages sent to the clients
+const (
+	// RawMessageFormat sends the pushed messages as they are
+	RawMessageFormat = "raw"
+	// JSONEnvelopeMessageFormat wraps the pushed messages in a JSON envelope (see outboundMessage)
+	JSONEnvelopeMessageFormat = "json-envelope"
+)
+
+// The types of the outbound messages reflecting how the backend addressed them
+const (
+	directMessageType    = "message"
+	broadcastMessageType = "broadcast"
+	userMessageType      = "user"
+	topicMessageType     = "topic"
+)
+
+// outboundMessage is a message to be sent to a client. In the `json-envelope` format, it is sent as is:
+//
+//	{"type":"message","id":"cn0ljd4lsl9k8ug6n2ng","seq":42,"timestamp":"2023-06-01T12:00:00.123Z","data":"..."}
+//
+// `seq` increases by one with each message sent over the connection, so that clients can detect gaps,
+// while `id` lets them deduplicate messages.
+//
+// With replay enabled, the first message over each connection is of type `session` conveying the
+// connection ID and the resume token, its `seq` being that of the last message sent in the session so far.
+type outboundMessage struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Seq       uint64    `json:"seq"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      string    `json:"data"`
+
+	ConnectionID string `json:"connectionId,omitempty"`
+	ResumeToken  string `json:"resumeToken,omitempty"`
+	Resumed      bool   `json:"resumed,omitempty"`
+
+	// traceContext is that of the push, the write of the message is traced as part of
+	traceContext trace.SpanContext
+}
+
+// inboundMessage is a message received from a client
+type inboundMessage struct {
+	// id is assigned by the gateway
+	id           string
+	connectionId connectionID
+	data         string
+	receivedAt   time.Time
+	// requestID is that of the request, which opened the connection
+	requestID string
+	// traceContext is that of the connection, the callback is traced as part of
+	traceContext trace.SpanContext
+}
+
+// newInboundMessage creates the message received from the client of the connection
+func newInboundMessage(conn *connection, data string) inboundMessage {
+	return inboundMessage{
+		id:           xid.New().String(),
+		connectionId: conn.id,
+		data:         data,
+		receivedAt:   time.Now(),
+		requestID:    conn.requestID,
+		traceContext: conn.traceContext,
+	}
+}
+
+type messageEncoder func(msg outboundMessage) (string, error)
+
+func newMessageEncoder(format string) (messageEncoder, error) {
+	switch format {
+	case "", RawMessageFormat:
+		return func(msg outboundMessage) (string, error) {
+			return msg.Data, nil
+		}, nil
+	case JSONEnvelopeMessageFormat:
+		return func(msg outboundMessage) (string, error) {
+			encoded, err := json.Marshal(msg)
+			return string(encoded), err
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown message format: %s", format)
+	}
+}
@@ -0,0 +1,130 @@
+package wsgw
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// heldConnection is a connection, which lost its socket, held for the grace period
+type heldConnection struct {
+	conn   *connection
+	expiry *time.Timer
+	// onGone is called when the connection is gone for good
+	onGone func()
+}
+
+// resumable reports whether the clients are issued resume tokens
+func (wsconn *wsConnections) resumable() bool {
+	return wsconn.replayEnabled() || wsconn.gracePeriod > 0
+}
+
+// connectionLost handles the loss of the socket of the connection with `err`. Unless it was closed by the backend
+// or the client, the connection is held for the grace period, so that the client can rebind to it, and `onGone` is
+// only called once it is gone for good.
+func (wsconn *wsConnections) connectionLost(conn *connection, err error, onGone func()) {
+	if wsconn.gracePeriod == 0 || err == errClosedByBackend || websocket.CloseStatus(err) == websocket.StatusNormalClosure {
+		wsconn.connectionGone(conn, err, onGone)
+		return
+	}
+
+	wsconn.sessionsMu.Lock()
+	defer wsconn.sessionsMu.Unlock()
+
+	held := &heldConnection{
+		conn:   conn,
+		onGone: onGone,
+	}
+	held.expiry = time.AfterFunc(wsconn.gracePeriod, func() {
+		wsconn.sessionsMu.Lock()
+		if wsconn.held[conn.resumeToken] != held {
+			wsconn.sessionsMu.Unlock()
+			return // claimed in the meantime
+		}
+		delete(wsconn.held, conn.resumeToken)
+		wsconn.sessionsMu.Unlock()
+
+		conn.logger.Debug().Msg("grace period expired")
+		wsconn.connectionGone(conn, err, onGone)
+	})
+	wsconn.held[conn.resumeToken] = held
+}
+
+// connectionGone deletes the connection. Unless it was closed by the backend, its session is retained for replay
+// and the messages for it and its user are queued.
+func (wsconn *wsConnections) connectionGone(conn *connection, err error, onGone func()) {
+	wsconn.deleteConnection(conn)
+	wsconn.metrics.disconnects.WithLabelValues(wsconn.appName, disconnectReason(conn, err)).Inc()
+	wsconn.audit.closed(wsconn.appName, conn, err)
+	if err != errClosedByBackend {
+		// The messages for the connection are queued only if its session can be resumed to receive them
+		var resumableId connectionID
+		if wsconn.replayEnabled() {
+			wsconn.retainSession(conn)
+			resumableId = conn.id
+		}
+		wsconn.offline.disconnected(resumableId, conn.userID)
+	}
+	// The application learns of the disconnection after the messages received before
+	conn.callbacks.whenIdle(onGone)
+}
+
+// claimHeld takes the connection held for the resume token, if any, so that it doesn't expire
+func (wsconn *wsConnections) claimHeld(token string) *heldConnection {
+	wsconn.sessionsMu.Lock()
+	defer wsconn.sessionsMu.Unlock()
+
+	held, ok := wsconn.held[token]
+	if !ok {
+		return nil
+	}
+	held.expiry.Stop()
+	delete(wsconn.held, token)
+	return held
+}
+
+// rebind prepares the claimed connection for being bound to the new socket of the client.
+// With replay enabled, the messages after `clientLastSeq` are sent again, as those sent over the lost
+// socket may not have reached the client. Otherwise, the messages queued in the meantime are sent.
+func (wsconn *wsConnections) rebind(conn *connection, clientLastSeq uint64) {
+	conn.sendMu.Lock()
+	defer conn.sendMu.Unlock()
+
+	conn.pending = nil
+	if conn.history != nil {
+		for drained := false; !drained; {
+			select {
+			case <-conn.fromBackend:
+			default:
+				drained = true
+			}
+		}
+		conn.pending = conn.history.since(clientLastSeq)
+	}
+
+	if wsconn.messageFormat == JSONEnvelopeMessageFormat {
+		conn.pending = append([]outboundMessage{conn.sessionMessage(true)}, conn.pending...)
+	}
+}
+
+// disconnectReason classifies the error the connection was lost with for the metrics
+func disconnectReason(conn *connection, err error) string {
+	switch {
+	case err == errClosedByBackend:
+		return "closed_by_backend"
+	case conn.tooSlow.Load():
+		return "too_slow"
+	case conn.overloaded.Load():
+		return "callback_queue_full"
+	case websocket.CloseStatus(err) == websocket.StatusNormalClosure:
+		return "client_closed"
+	case websocket.CloseStatus(err) == websocket.StatusGoingAway:
+		return "client_going_away"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,441 @@
+package wsgw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+	"websocket-gateway/internal/grpcapi"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GRPCConfig sets up the listener of the gRPC backend API
+type GRPCConfig struct {
+	// ServerHost and ServerPort are the address of the gRPC listener, which is disabled if ServerPort is 0
+	ServerHost string
+	ServerPort int
+	// CertFile and KeyFile are the PEM files of the certificate and key the listener serves TLS with.
+	// Without them the listener is plaintext, which only a loopback ServerHost is allowed for if
+	// backends authenticate with API keys.
+	CertFile string
+	KeyFile  string
+}
+
+// tls tells whether the listener serves TLS
+func (c GRPCConfig) tls() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// loopback tells whether the listener is only reachable from the host of the gateway
+func (c GRPCConfig) loopback() bool {
+	if c.ServerHost == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(c.ServerHost)
+	return ip != nil && ip.IsLoopback()
+}
+
+// requestIDMetadataKey is the metadata conveying the request IDs of the gRPC calls
+const requestIDMetadataKey = "x-request-id"
+
+// startGRPC starts the listener of the gRPC backend API if it is configured
+func (s *Server) startGRPC(apps *applications, cluster *cluster, ids *connectionIDs) error {
+	conf := s.configuration.GRPC
+	if conf.ServerPort == 0 {
+		return nil
+	}
+
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryRequestLogger),
+		grpc.ChainStreamInterceptor(streamRequestLogger),
+	}
+	if conf.tls() {
+		creds, credsErr := credentials.NewServerTLSFromFile(conf.CertFile, conf.KeyFile)
+		if credsErr != nil {
+			return credsErr
+		}
+		options = append(options, grpc.Creds(creds))
+	}
+
+	listener, listenErr := net.Listen("tcp", fmt.Sprintf("%s:%d", conf.ServerHost, conf.ServerPort))
+	if listenErr != nil {
+		return listenErr
+	}
+	s.logger.Info().Str("address", listener.Addr().String()).Bool("tls", conf.tls()).Msg("gRPC listener is listening")
+
+	s.grpcServer = grpc.NewServer(options...)
+	grpcapi.RegisterGatewayServer(s.grpcServer, &grpcBackendAPI{apps: apps, cluster: cluster, ids: ids})
+
+	go s.grpcServer.Serve(listener)
+	return nil
+}
+
+// unaryRequestLogger is the RequestLogger of the gRPC calls
+func unaryRequestLogger(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, done := logGRPCRequest(ctx, info.FullMethod)
+	resp, err := handler(ctx, req)
+	done(err)
+	return resp, err
+}
+
+// streamRequestLogger is the RequestLogger of the gRPC streams
+func streamRequestLogger(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, done := logGRPCRequest(stream.Context(), info.FullMethod)
+	err := handler(srv, &contextServerStream{ServerStream: stream, ctx: ctx})
+	done(err)
+	return err
+}
+
+// logGRPCRequest sets up the request ID and the logger of a call and returns the function logging its outcome
+func logGRPCRequest(ctx context.Context, method string) (context.Context, func(err error)) {
+	start := time.Now()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	requestID := requestID(http.Header{RequestIDHeaderKey: md.Get(requestIDMetadataKey)})
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadataKey, requestID))
+
+	l := logging.Get().With().Str("request_id", requestID).Logger()
+	ctx = withRequestID(l.WithContext(ctx), requestID)
+
+	return ctx, func(err error) {
+		l.Info().
+			Str("method", method).
+			Str("user_agent", firstMetadata(md, "user-agent")).
+			Str("code", status.Code(err).String()).
+			Dur("elapsed_ms", time.Since(start)).
+			Msg("incoming request")
+	}
+}
+
+// contextServerStream replaces the context of a stream
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func firstMetadata(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// grpcBackendAPI serves the backend API over gRPC. Calls addressing connections owned by other nodes of the
+// cluster are forwarded to their owner over its HTTP backend API, as are the fan-outs.
+type grpcBackendAPI struct {
+	grpcapi.UnimplementedGatewayServer
+	apps    *applications
+	cluster *cluster
+	ids     *connectionIDs
+}
+
+// app returns the application named `name`, the default one if `name` is empty, if the caller authenticates
+// as one of its backends
+func (api *grpcBackendAPI) app(ctx context.Context, name string) (*application, error) {
+	var app *application
+	var appErr error
+	if name == "" {
+		app, appErr = api.apps.forHost("")
+	} else {
+		app, appErr = api.apps.get(name)
+	}
+	if appErr != nil {
+		return nil, status.Error(codes.NotFound, appErr.Error())
+	}
+
+	if keys := app.settings.Load().backendAPIKeys; len(keys) > 0 {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if authErr := verifyBearer(keys, firstMetadata(md, "authorization")); authErr != nil {
+			zerolog.Ctx(ctx).Info().Str("app", app.name).Err(authErr).Msg("failed to authenticate backend")
+			return nil, status.Error(codes.Unauthenticated, authErr.Error())
+		}
+	}
+	return app, nil
+}
+
+// connection returns the ID of the connection addressed by a call and the node owning it, if it isn't this one
+func (api *grpcBackendAPI) connection(app *application, connIdStr string) (connectionID, string, error) {
+	connId := connectionID(connIdStr)
+	if !api.ids.verify(app.name, connId) {
+		return "", "", status.Error(codes.NotFound, "invalid connection ID")
+	}
+	if owner := connId.node(); owner != "" && owner != api.cluster.nodeID {
+		return connId, owner, nil
+	}
+	return connId, "", nil
+}
+
+// peerHeader is the header of the requests the call causes to the other nodes of the cluster
+func (api *grpcBackendAPI) peerHeader(ctx context.Context, app *application) http.Header {
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set(RequestIDHeaderKey, requestIDFromContext(ctx))
+	if authorization := firstMetadata(md, "authorization"); authorization != "" {
+		header.Set("Authorization", authorization)
+	}
+	app.tracing.inject(ctx, header)
+	return header
+}
+
+// forward sends the request of the backend API at `path` to the node `owner` and returns the status code of the
+// response along with its equivalent error
+func (api *grpcBackendAPI) forward(ctx context.Context, app *application, owner string, method string, path string, message *string) (int, error) {
+	var body []byte
+	if message != nil {
+		body, _ = json.Marshal(*message)
+	}
+	statusCode, forwardErr := api.cluster.forward(ctx, owner, method, path, api.peerHeader(ctx, app), body)
+	if forwardErr == ErrConnectionNotFound {
+		return 0, status.Error(codes.NotFound, forwardErr.Error())
+	}
+	if forwardErr != nil {
+		zerolog.Ctx(ctx).Error().Str("owner", owner).Err(forwardErr).Msg("failed to forward request to owner node")
+		return 0, status.Error(codes.Unavailable, forwardErr.Error())
+	}
+	return statusCode, statusCodeError(statusCode)
+}
+
+// statusCodeError is the gRPC equivalent of the status code of a response of the HTTP backend API
+func statusCodeError(statusCode int) error {
+	switch {
+	case statusCode < http.StatusBadRequest:
+		return nil
+	case statusCode == http.StatusNotFound:
+		return status.Error(codes.NotFound, ErrConnectionNotFound.Error())
+	case statusCode == http.StatusUnauthorized:
+		return status.Error(codes.Unauthenticated, http.StatusText(statusCode))
+	case statusCode == http.StatusTooManyRequests:
+		return status.Error(codes.ResourceExhausted, errRateLimited.Error())
+	case statusCode == http.StatusServiceUnavailable:
+		return status.Error(codes.Unavailable, http.StatusText(statusCode))
+	default:
+		return status.Error(codes.Internal, http.StatusText(statusCode))
+	}
+}
+
+// pushError is the gRPC equivalent of the error of a push
+func pushError(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case ErrConnectionNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case errConnectionTooSlow, errOfflineQueueFull:
+		return status.Error(codes.Unavailable, err.Error())
+	case errRateLimited:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func (api *grpcBackendAPI) Push(ctx context.Context, req *grpcapi.PushRequest) (*grpcapi.PushResponse, error) {
+	app, appErr := api.app(ctx, req.App)
+	if appErr != nil {
+		return nil, appErr
+	}
+	connId, owner, connErr := api.connection(app, req.ConnectionId)
+	if connErr != nil {
+		return nil, connErr
+	}
+	if owner != "" {
+		statusCode, forwardErr := api.forward(ctx, app, owner, http.MethodPost, "/apps/"+url.PathEscape(app.name)+"/message/"+url.PathEscape(string(connId)), &req.Message)
+		return &grpcapi.PushResponse{Queued: statusCode == http.StatusAccepted}, forwardErr
+	}
+
+	queued, pushErr := app.conns.pushOrQueue(ctx, req.Message, connId)
+	if pushErr != nil {
+		zerolog.Ctx(ctx).Info().Str("app", app.name).Str("connection_id", string(connId)).Err(pushErr).Msg("failed to push to connection")
+		return nil, pushError(pushErr)
+	}
+	return &grpcapi.PushResponse{Queued: queued}, nil
+}
+
+// fanOut sends the message to the selected recipients on this node with `deliverLocally` and on the other
+// nodes of the cluster with their HTTP backend API at `path`
+func (api *grpcBackendAPI) fanOut(ctx context.Context, app *application, path string, message string, deliverLocally func() (broadcastResponse, error)) (*grpcapi.FanOutResponse, error) {
+	result, deliveryErr := deliverLocally()
+	if deliveryErr == errRateLimited {
+		return nil, status.Error(codes.ResourceExhausted, deliveryErr.Error())
+	}
+	if deliveryErr != nil {
+		zerolog.Ctx(ctx).Error().Str("app", app.name).Err(deliveryErr).Msg("failed to deliver message")
+		return nil, status.Error(codes.Internal, deliveryErr.Error())
+	}
+	result.add(api.cluster.broadcastToPeers(ctx, path, api.peerHeader(ctx, app), message))
+	return &grpcapi.FanOutResponse{Recipients: int32(result.Recipients), Queued: int32(result.Queued)}, nil
+}
+
+func (api *grpcBackendAPI) PushToUser(ctx context.Context, req *grpcapi.PushToUserRequest) (*grpcapi.FanOutResponse, error) {
+	app, appErr := api.app(ctx, req.App)
+	if appErr != nil {
+		return nil, appErr
+	}
+	return api.fanOut(ctx, app, "/apps/"+url.PathEscape(app.name)+"/users/"+url.PathEscape(req.UserId)+"/message", req.Message, func() (broadcastResponse, error) {
+		recipients, queued, err := app.conns.pushToUser(ctx, req.UserId, req.Message)
+		result := broadcastResponse{Recipients: recipients}
+		if queued {
+			result.Queued = 1
+		}
+		return result, err
+	})
+}
+
+func (api *grpcBackendAPI) PublishToTopic(ctx context.Context, req *grpcapi.PublishToTopicRequest) (*grpcapi.FanOutResponse, error) {
+	app, appErr := api.app(ctx, req.App)
+	if appErr != nil {
+		return nil, appErr
+	}
+	return api.fanOut(ctx, app, "/apps/"+url.PathEscape(app.name)+"/topics/"+url.PathEscape(req.Topic)+"/message", req.Message, func() (broadcastResponse, error) {
+		recipients, err := app.conns.publishToTopic(ctx, req.Topic, req.Message)
+		return broadcastResponse{Recipients: recipients}, err
+	})
+}
+
+func (api *grpcBackendAPI) Broadcast(ctx context.Context, req *grpcapi.BroadcastRequest) (*grpcapi.FanOutResponse, error) {
+	app, appErr := api.app(ctx, req.App)
+	if appErr != nil {
+		return nil, appErr
+	}
+	return api.fanOut(ctx, app, "/apps/"+url.PathEscape(app.name)+"/broadcast", req.Message, func() (broadcastResponse, error) {
+		recipients, err := app.conns.broadcast(ctx, req.Message)
+		return broadcastResponse{Recipients: recipients}, err
+	})
+}
+
+func (api *grpcBackendAPI) CloseConnection(ctx context.Context, req *grpcapi.CloseConnectionRequest) (*grpcapi.CloseConnectionResponse, error) {
+	app, appErr := api.app(ctx, req.App)
+	if appErr != nil {
+		return nil, appErr
+	}
+	connId, owner, connErr := api.connection(app, req.ConnectionId)
+	if connErr != nil {
+		return nil, connErr
+	}
+	if owner != "" {
+		_, forwardErr := api.forward(ctx, app, owner, http.MethodDelete, "/apps/"+url.PathEscape(app.name)+"/connections/"+url.PathEscape(string(connId)), nil)
+		return &grpcapi.CloseConnectionResponse{}, forwardErr
+	}
+
+	if closeErr := app.conns.close(connId, newGRPCBackendCaller(ctx)); closeErr != nil {
+		zerolog.Ctx(ctx).Info().Str("app", app.name).Str("connection_id", string(connId)).Msg("connection doesn't exist")
+		return nil, status.Error(codes.NotFound, closeErr.Error())
+	}
+	return &grpcapi.CloseConnectionResponse{}, nil
+}
+
+// newGRPCBackendCaller identifies the backend calling over gRPC
+func newGRPCBackendCaller(ctx context.Context) *backendCaller {
+	md, _ := metadata.FromIncomingContext(ctx)
+	caller := &backendCaller{
+		requestID: requestIDFromContext(ctx),
+		apiKeyID:  apiKeyID(firstMetadata(md, "authorization")),
+	}
+	if p, hasPeer := peer.FromContext(ctx); hasPeer {
+		caller.remoteAddr = p.Addr.String()
+	}
+	return caller
+}
+
+func (api *grpcBackendAPI) ListConnections(ctx context.Context, req *grpcapi.ListConnectionsRequest) (*grpcapi.ListConnectionsResponse, error) {
+	app, appErr := api.app(ctx, req.App)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	entries, listErr := app.conns.registry.Connections(ctx, app.name)
+	if listErr != nil {
+		zerolog.Ctx(ctx).Error().Str("app", app.name).Err(listErr).Msg("failed to list connections")
+		return nil, status.Error(codes.Internal, listErr.Error())
+	}
+
+	response := &grpcapi.ListConnectionsResponse{}
+	for _, entry := range entries {
+		if req.UserId != "" && entry.UserID != req.UserId {
+			continue
+		}
+		response.Connections = append(response.Connections, &grpcapi.Connection{
+			Id:          entry.ID,
+			App:         entry.App,
+			Node:        entry.Node,
+			UserId:      entry.UserID,
+			ConnectedAt: timestamppb.New(entry.ConnectedAt),
+		})
+	}
+	return response, nil
+}
+
+// Events streams the events of the application to the backend, which subscribed to them with its first request,
+// and passes its decisions on the connecting clients on
+func (api *grpcBackendAPI) Events(stream grpc.BidiStreamingServer[grpcapi.EventsRequest, grpcapi.Event]) error {
+	ctx := stream.Context()
+
+	first, recvErr := stream.Recv()
+	if recvErr != nil {
+		return recvErr
+	}
+	subscribe := first.GetSubscribe()
+	if subscribe == nil {
+		return status.Error(codes.InvalidArgument, "the first request must subscribe to the events of an application")
+	}
+	app, appErr := api.app(ctx, subscribe.App)
+	if appErr != nil {
+		return appErr
+	}
+
+	logger := zerolog.Ctx(ctx).With().Str(logging.MethodLogger, "Events").Str("app", app.name).Logger()
+	events := &eventStream{events: make(chan *grpcapi.Event, eventStreamBufferSize), done: ctx.Done()}
+	app.events.add(events)
+	defer app.events.remove(events)
+	logger.Info().Msg("backend subscribed to events")
+
+	received := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				received <- err
+				return
+			}
+			if decision := req.GetDecision(); decision != nil {
+				app.events.decide(decision)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case event := <-events.events:
+			if sendErr := stream.Send(event); sendErr != nil {
+				return sendErr
+			}
+		case err := <-received:
+			logger.Info().Err(err).Msg("backend unsubscribed from events")
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
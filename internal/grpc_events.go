@@ -0,0 +1,195 @@
+package wsgw
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"websocket-gateway/internal/grpcapi"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+)
+
+// eventStreamBufferSize is the number of events queued per stream for being sent to the backend
+const eventStreamBufferSize = 64
+
+var (
+	errNoEventStream     = errors.New("no event stream")
+	errEventStreamClosed = errors.New("event stream closed")
+)
+
+// eventStreams are the gRPC streams the backends of an application receive its events over instead of the callbacks.
+// The events of a connection go to the same stream as long as the streams don't change, so that they are in order.
+type eventStreams struct {
+	// timeout limits the wait for the streams to take the events and for the decisions on the connecting clients
+	timeout time.Duration
+
+	mu      sync.Mutex
+	streams []*eventStream
+	// decisions are awaited for the connecting clients
+	decisions map[connectionID]chan *grpcapi.ConnectingDecision
+}
+
+// eventStream queues the events for a single stream
+type eventStream struct {
+	events chan *grpcapi.Event
+	// done is closed once the stream ends
+	done <-chan struct{}
+}
+
+func newEventStreams(timeout time.Duration) *eventStreams {
+	if timeout == 0 {
+		timeout = defaultCallbackTimeout
+	}
+	return &eventStreams{
+		timeout:   timeout,
+		decisions: make(map[connectionID]chan *grpcapi.ConnectingDecision),
+	}
+}
+
+func (e *eventStreams) add(stream *eventStream) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.streams = append(e.streams, stream)
+}
+
+func (e *eventStreams) remove(stream *eventStream) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, s := range e.streams {
+		if s == stream {
+			e.streams = append(e.streams[:i], e.streams[i+1:]...)
+			return
+		}
+	}
+}
+
+// subscribed reports whether the events go to streams rather than to the callbacks
+func (e *eventStreams) subscribed() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.streams) > 0
+}
+
+// streamFor returns the stream the events of the connection go to, if any
+func (e *eventStreams) streamFor(connId connectionID) *eventStream {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.streams) == 0 {
+		return nil
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(connId))
+	return e.streams[hash.Sum32()%uint32(len(e.streams))]
+}
+
+// send queues the event of the connection for its stream
+func (e *eventStreams) send(ctx context.Context, connId connectionID, event *grpcapi.Event) error {
+	stream := e.streamFor(connId)
+	if stream == nil {
+		return errNoEventStream
+	}
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	select {
+	case stream.events <- event:
+		return nil
+	case <-stream.done:
+		return errEventStreamClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// notifyConnectionChange sends the connecting or disconnected event of the connection and, for the
+// connecting clients, waits for the decision. It returns the same as notifyAppOfWsConnectionChange.
+func (e *eventStreams) notifyConnectionChange(ctx context.Context, endpoint string, connId connectionID, header http.Header, parentLogger zerolog.Logger) (bool, http.Header, int) {
+	logger := parentLogger.With().Str(logging.MethodLogger, "notifyConnectionChange").Str("endpoint", endpoint).Logger()
+	requestID := requestIDFromContext(ctx)
+
+	if endpoint == disconnectedEndpoint {
+		event := &grpcapi.Event{Event: &grpcapi.Event_Disconnected{Disconnected: &grpcapi.Disconnected{
+			ConnectionId: string(connId),
+			RequestId:    requestID,
+		}}}
+		if sendErr := e.send(ctx, connId, event); sendErr != nil {
+			logger.Error().Err(sendErr).Msg("failed to send event")
+			return false, nil, http.StatusInternalServerError
+		}
+		return true, nil, 0
+	}
+
+	decision := make(chan *grpcapi.ConnectingDecision, 1)
+	e.mu.Lock()
+	e.decisions[connId] = decision
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		delete(e.decisions, connId)
+		e.mu.Unlock()
+	}()
+
+	// The same headers are relayed as by the connecting callback, the resumption being conveyed by its own field
+	relayed := relayedHeader(header)
+	headers := make(map[string]string, len(relayed))
+	for name, values := range relayed {
+		headers[name] = strings.Join(values, ", ")
+	}
+	event := &grpcapi.Event{Event: &grpcapi.Event_Connecting{Connecting: &grpcapi.Connecting{
+		ConnectionId: string(connId),
+		RequestId:    requestID,
+		Headers:      headers,
+		Resumed:      header.Get(ResumedHeaderKey) == "true",
+	}}}
+	if sendErr := e.send(ctx, connId, event); sendErr != nil {
+		logger.Error().Err(sendErr).Msg("failed to send event")
+		return false, nil, http.StatusServiceUnavailable
+	}
+
+	timer := time.NewTimer(e.timeout)
+	defer timer.Stop()
+	select {
+	case d := <-decision:
+		if !d.Accept {
+			logger.Info().Msg("Authentication failed")
+			return false, nil, http.StatusUnauthorized
+		}
+		// The decision is passed on as the response of the callback would be
+		responseHeader := http.Header{}
+		responseHeader.Set(UserIDHeaderKey, d.UserId)
+		return true, responseHeader, 0
+	case <-timer.C:
+		logger.Info().Msg("no decision in time")
+		return false, nil, http.StatusServiceUnavailable
+	case <-ctx.Done():
+		return false, nil, http.StatusServiceUnavailable
+	}
+}
+
+// messageReceived sends the message received from a client
+func (e *eventStreams) messageReceived(msg inboundMessage) error {
+	return e.send(context.Background(), msg.connectionId, &grpcapi.Event{Event: &grpcapi.Event_MessageReceived{MessageReceived: &grpcapi.MessageReceived{
+		ConnectionId: string(msg.connectionId),
+		RequestId:    msg.requestID,
+		MessageId:    msg.id,
+		Message:      msg.data,
+	}}})
+}
+
+// decide passes the decision of a backend on to the connecting client awaiting it. Late decisions are ignored.
+func (e *eventStreams) decide(d *grpcapi.ConnectingDecision) {
+	e.mu.Lock()
+	decision, awaited := e.decisions[connectionID(d.ConnectionId)]
+	e.mu.Unlock()
+	if !awaited {
+		return
+	}
+	select {
+	case decision <- d:
+	default: // decided already
+	}
+}
@@ -0,0 +1,1280 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: wsgw/v1/gateway.proto
+
+package grpcapi
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type PushRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	App           string                 `protobuf:"bytes,1,opt,name=app,proto3" json:"app,omitempty"`
+	ConnectionId  string                 `protobuf:"bytes,2,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PushRequest) Reset() {
+	*x = PushRequest{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PushRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushRequest) ProtoMessage() {}
+
+func (x *PushRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushRequest.ProtoReflect.Descriptor instead.
+func (*PushRequest) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PushRequest) GetApp() string {
+	if x != nil {
+		return x.App
+	}
+	return ""
+}
+
+func (x *PushRequest) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+func (x *PushRequest) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type PushResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// queued is set if the connection was offline and the message was queued
+	Queued        bool `protobuf:"varint,1,opt,name=queued,proto3" json:"queued,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PushResponse) Reset() {
+	*x = PushResponse{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PushResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushResponse) ProtoMessage() {}
+
+func (x *PushResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushResponse.ProtoReflect.Descriptor instead.
+func (*PushResponse) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PushResponse) GetQueued() bool {
+	if x != nil {
+		return x.Queued
+	}
+	return false
+}
+
+type PushToUserRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	App           string                 `protobuf:"bytes,1,opt,name=app,proto3" json:"app,omitempty"`
+	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PushToUserRequest) Reset() {
+	*x = PushToUserRequest{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PushToUserRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushToUserRequest) ProtoMessage() {}
+
+func (x *PushToUserRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushToUserRequest.ProtoReflect.Descriptor instead.
+func (*PushToUserRequest) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PushToUserRequest) GetApp() string {
+	if x != nil {
+		return x.App
+	}
+	return ""
+}
+
+func (x *PushToUserRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *PushToUserRequest) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type PublishToTopicRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	App           string                 `protobuf:"bytes,1,opt,name=app,proto3" json:"app,omitempty"`
+	Topic         string                 `protobuf:"bytes,2,opt,name=topic,proto3" json:"topic,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PublishToTopicRequest) Reset() {
+	*x = PublishToTopicRequest{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PublishToTopicRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishToTopicRequest) ProtoMessage() {}
+
+func (x *PublishToTopicRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishToTopicRequest.ProtoReflect.Descriptor instead.
+func (*PublishToTopicRequest) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PublishToTopicRequest) GetApp() string {
+	if x != nil {
+		return x.App
+	}
+	return ""
+}
+
+func (x *PublishToTopicRequest) GetTopic() string {
+	if x != nil {
+		return x.Topic
+	}
+	return ""
+}
+
+func (x *PublishToTopicRequest) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type BroadcastRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	App           string                 `protobuf:"bytes,1,opt,name=app,proto3" json:"app,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BroadcastRequest) Reset() {
+	*x = BroadcastRequest{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BroadcastRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BroadcastRequest) ProtoMessage() {}
+
+func (x *BroadcastRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BroadcastRequest.ProtoReflect.Descriptor instead.
+func (*BroadcastRequest) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BroadcastRequest) GetApp() string {
+	if x != nil {
+		return x.App
+	}
+	return ""
+}
+
+func (x *BroadcastRequest) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type FanOutResponse struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Recipients int32                  `protobuf:"varint,1,opt,name=recipients,proto3" json:"recipients,omitempty"`
+	// queued is the number of nodes the message was queued on for recently disconnected recipients
+	Queued        int32 `protobuf:"varint,2,opt,name=queued,proto3" json:"queued,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FanOutResponse) Reset() {
+	*x = FanOutResponse{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FanOutResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FanOutResponse) ProtoMessage() {}
+
+func (x *FanOutResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FanOutResponse.ProtoReflect.Descriptor instead.
+func (*FanOutResponse) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *FanOutResponse) GetRecipients() int32 {
+	if x != nil {
+		return x.Recipients
+	}
+	return 0
+}
+
+func (x *FanOutResponse) GetQueued() int32 {
+	if x != nil {
+		return x.Queued
+	}
+	return 0
+}
+
+type CloseConnectionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	App           string                 `protobuf:"bytes,1,opt,name=app,proto3" json:"app,omitempty"`
+	ConnectionId  string                 `protobuf:"bytes,2,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CloseConnectionRequest) Reset() {
+	*x = CloseConnectionRequest{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CloseConnectionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloseConnectionRequest) ProtoMessage() {}
+
+func (x *CloseConnectionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloseConnectionRequest.ProtoReflect.Descriptor instead.
+func (*CloseConnectionRequest) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *CloseConnectionRequest) GetApp() string {
+	if x != nil {
+		return x.App
+	}
+	return ""
+}
+
+func (x *CloseConnectionRequest) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+type CloseConnectionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CloseConnectionResponse) Reset() {
+	*x = CloseConnectionResponse{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CloseConnectionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloseConnectionResponse) ProtoMessage() {}
+
+func (x *CloseConnectionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloseConnectionResponse.ProtoReflect.Descriptor instead.
+func (*CloseConnectionResponse) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{7}
+}
+
+type ListConnectionsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	App           string                 `protobuf:"bytes,1,opt,name=app,proto3" json:"app,omitempty"`
+	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConnectionsRequest) Reset() {
+	*x = ListConnectionsRequest{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConnectionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConnectionsRequest) ProtoMessage() {}
+
+func (x *ListConnectionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConnectionsRequest.ProtoReflect.Descriptor instead.
+func (*ListConnectionsRequest) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListConnectionsRequest) GetApp() string {
+	if x != nil {
+		return x.App
+	}
+	return ""
+}
+
+func (x *ListConnectionsRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type ListConnectionsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Connections   []*Connection          `protobuf:"bytes,1,rep,name=connections,proto3" json:"connections,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConnectionsResponse) Reset() {
+	*x = ListConnectionsResponse{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConnectionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConnectionsResponse) ProtoMessage() {}
+
+func (x *ListConnectionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConnectionsResponse.ProtoReflect.Descriptor instead.
+func (*ListConnectionsResponse) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListConnectionsResponse) GetConnections() []*Connection {
+	if x != nil {
+		return x.Connections
+	}
+	return nil
+}
+
+type Connection struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	App           string                 `protobuf:"bytes,2,opt,name=app,proto3" json:"app,omitempty"`
+	Node          string                 `protobuf:"bytes,3,opt,name=node,proto3" json:"node,omitempty"`
+	UserId        string                 `protobuf:"bytes,4,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	ConnectedAt   *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=connected_at,json=connectedAt,proto3" json:"connected_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Connection) Reset() {
+	*x = Connection{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Connection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Connection) ProtoMessage() {}
+
+func (x *Connection) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Connection.ProtoReflect.Descriptor instead.
+func (*Connection) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Connection) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Connection) GetApp() string {
+	if x != nil {
+		return x.App
+	}
+	return ""
+}
+
+func (x *Connection) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *Connection) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *Connection) GetConnectedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ConnectedAt
+	}
+	return nil
+}
+
+type EventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Request:
+	//
+	//	*EventsRequest_Subscribe
+	//	*EventsRequest_Decision
+	Request       isEventsRequest_Request `protobuf_oneof:"request"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EventsRequest) Reset() {
+	*x = EventsRequest{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EventsRequest) ProtoMessage() {}
+
+func (x *EventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EventsRequest.ProtoReflect.Descriptor instead.
+func (*EventsRequest) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *EventsRequest) GetRequest() isEventsRequest_Request {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+func (x *EventsRequest) GetSubscribe() *Subscribe {
+	if x != nil {
+		if x, ok := x.Request.(*EventsRequest_Subscribe); ok {
+			return x.Subscribe
+		}
+	}
+	return nil
+}
+
+func (x *EventsRequest) GetDecision() *ConnectingDecision {
+	if x != nil {
+		if x, ok := x.Request.(*EventsRequest_Decision); ok {
+			return x.Decision
+		}
+	}
+	return nil
+}
+
+type isEventsRequest_Request interface {
+	isEventsRequest_Request()
+}
+
+type EventsRequest_Subscribe struct {
+	Subscribe *Subscribe `protobuf:"bytes,1,opt,name=subscribe,proto3,oneof"`
+}
+
+type EventsRequest_Decision struct {
+	Decision *ConnectingDecision `protobuf:"bytes,2,opt,name=decision,proto3,oneof"`
+}
+
+func (*EventsRequest_Subscribe) isEventsRequest_Request() {}
+
+func (*EventsRequest_Decision) isEventsRequest_Request() {}
+
+type Subscribe struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	App           string                 `protobuf:"bytes,1,opt,name=app,proto3" json:"app,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Subscribe) Reset() {
+	*x = Subscribe{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Subscribe) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Subscribe) ProtoMessage() {}
+
+func (x *Subscribe) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Subscribe.ProtoReflect.Descriptor instead.
+func (*Subscribe) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Subscribe) GetApp() string {
+	if x != nil {
+		return x.App
+	}
+	return ""
+}
+
+// ConnectingDecision answers a Connecting event
+type ConnectingDecision struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	ConnectionId string                 `protobuf:"bytes,1,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`
+	Accept       bool                   `protobuf:"varint,2,opt,name=accept,proto3" json:"accept,omitempty"`
+	// user_id identifies the user of an accepted connection
+	UserId        string `protobuf:"bytes,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConnectingDecision) Reset() {
+	*x = ConnectingDecision{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConnectingDecision) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConnectingDecision) ProtoMessage() {}
+
+func (x *ConnectingDecision) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConnectingDecision.ProtoReflect.Descriptor instead.
+func (*ConnectingDecision) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ConnectingDecision) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+func (x *ConnectingDecision) GetAccept() bool {
+	if x != nil {
+		return x.Accept
+	}
+	return false
+}
+
+func (x *ConnectingDecision) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*Event_Connecting
+	//	*Event_Disconnected
+	//	*Event_MessageReceived
+	Event         isEvent_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *Event) GetEvent() isEvent_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *Event) GetConnecting() *Connecting {
+	if x != nil {
+		if x, ok := x.Event.(*Event_Connecting); ok {
+			return x.Connecting
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetDisconnected() *Disconnected {
+	if x != nil {
+		if x, ok := x.Event.(*Event_Disconnected); ok {
+			return x.Disconnected
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetMessageReceived() *MessageReceived {
+	if x != nil {
+		if x, ok := x.Event.(*Event_MessageReceived); ok {
+			return x.MessageReceived
+		}
+	}
+	return nil
+}
+
+type isEvent_Event interface {
+	isEvent_Event()
+}
+
+type Event_Connecting struct {
+	Connecting *Connecting `protobuf:"bytes,1,opt,name=connecting,proto3,oneof"`
+}
+
+type Event_Disconnected struct {
+	Disconnected *Disconnected `protobuf:"bytes,2,opt,name=disconnected,proto3,oneof"`
+}
+
+type Event_MessageReceived struct {
+	MessageReceived *MessageReceived `protobuf:"bytes,3,opt,name=message_received,json=messageReceived,proto3,oneof"`
+}
+
+func (*Event_Connecting) isEvent_Event() {}
+
+func (*Event_Disconnected) isEvent_Event() {}
+
+func (*Event_MessageReceived) isEvent_Event() {}
+
+// Connecting asks whether to accept a client. Clients not accepted within the callback timeout of the
+// application are rejected.
+type Connecting struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	ConnectionId string                 `protobuf:"bytes,1,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`
+	RequestId    string                 `protobuf:"bytes,2,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	// headers are those of the connection request, multiple values being joined with commas
+	Headers map[string]string `protobuf:"bytes,3,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// resumed is set if the client resumes a session with the connection ID of a lost connection
+	Resumed       bool `protobuf:"varint,4,opt,name=resumed,proto3" json:"resumed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Connecting) Reset() {
+	*x = Connecting{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Connecting) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Connecting) ProtoMessage() {}
+
+func (x *Connecting) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Connecting.ProtoReflect.Descriptor instead.
+func (*Connecting) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *Connecting) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+func (x *Connecting) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *Connecting) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *Connecting) GetResumed() bool {
+	if x != nil {
+		return x.Resumed
+	}
+	return false
+}
+
+type Disconnected struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ConnectionId  string                 `protobuf:"bytes,1,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`
+	RequestId     string                 `protobuf:"bytes,2,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Disconnected) Reset() {
+	*x = Disconnected{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Disconnected) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Disconnected) ProtoMessage() {}
+
+func (x *Disconnected) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Disconnected.ProtoReflect.Descriptor instead.
+func (*Disconnected) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *Disconnected) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+func (x *Disconnected) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+type MessageReceived struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ConnectionId  string                 `protobuf:"bytes,1,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`
+	RequestId     string                 `protobuf:"bytes,2,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	MessageId     string                 `protobuf:"bytes,3,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Message       string                 `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MessageReceived) Reset() {
+	*x = MessageReceived{}
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MessageReceived) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MessageReceived) ProtoMessage() {}
+
+func (x *MessageReceived) ProtoReflect() protoreflect.Message {
+	mi := &file_wsgw_v1_gateway_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MessageReceived.ProtoReflect.Descriptor instead.
+func (*MessageReceived) Descriptor() ([]byte, []int) {
+	return file_wsgw_v1_gateway_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *MessageReceived) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+func (x *MessageReceived) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *MessageReceived) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+func (x *MessageReceived) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+var File_wsgw_v1_gateway_proto protoreflect.FileDescriptor
+
+const file_wsgw_v1_gateway_proto_rawDesc = "" +
+	"\n" +
+	"\x15wsgw/v1/gateway.proto\x12\awsgw.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"^\n" +
+	"\vPushRequest\x12\x10\n" +
+	"\x03app\x18\x01 \x01(\tR\x03app\x12#\n" +
+	"\rconnection_id\x18\x02 \x01(\tR\fconnectionId\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\"&\n" +
+	"\fPushResponse\x12\x16\n" +
+	"\x06queued\x18\x01 \x01(\bR\x06queued\"X\n" +
+	"\x11PushToUserRequest\x12\x10\n" +
+	"\x03app\x18\x01 \x01(\tR\x03app\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\"Y\n" +
+	"\x15PublishToTopicRequest\x12\x10\n" +
+	"\x03app\x18\x01 \x01(\tR\x03app\x12\x14\n" +
+	"\x05topic\x18\x02 \x01(\tR\x05topic\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\">\n" +
+	"\x10BroadcastRequest\x12\x10\n" +
+	"\x03app\x18\x01 \x01(\tR\x03app\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"H\n" +
+	"\x0eFanOutResponse\x12\x1e\n" +
+	"\n" +
+	"recipients\x18\x01 \x01(\x05R\n" +
+	"recipients\x12\x16\n" +
+	"\x06queued\x18\x02 \x01(\x05R\x06queued\"O\n" +
+	"\x16CloseConnectionRequest\x12\x10\n" +
+	"\x03app\x18\x01 \x01(\tR\x03app\x12#\n" +
+	"\rconnection_id\x18\x02 \x01(\tR\fconnectionId\"\x19\n" +
+	"\x17CloseConnectionResponse\"C\n" +
+	"\x16ListConnectionsRequest\x12\x10\n" +
+	"\x03app\x18\x01 \x01(\tR\x03app\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\"P\n" +
+	"\x17ListConnectionsResponse\x125\n" +
+	"\vconnections\x18\x01 \x03(\v2\x13.wsgw.v1.ConnectionR\vconnections\"\x9a\x01\n" +
+	"\n" +
+	"Connection\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03app\x18\x02 \x01(\tR\x03app\x12\x12\n" +
+	"\x04node\x18\x03 \x01(\tR\x04node\x12\x17\n" +
+	"\auser_id\x18\x04 \x01(\tR\x06userId\x12=\n" +
+	"\fconnected_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\vconnectedAt\"\x89\x01\n" +
+	"\rEventsRequest\x122\n" +
+	"\tsubscribe\x18\x01 \x01(\v2\x12.wsgw.v1.SubscribeH\x00R\tsubscribe\x129\n" +
+	"\bdecision\x18\x02 \x01(\v2\x1b.wsgw.v1.ConnectingDecisionH\x00R\bdecisionB\t\n" +
+	"\arequest\"\x1d\n" +
+	"\tSubscribe\x12\x10\n" +
+	"\x03app\x18\x01 \x01(\tR\x03app\"j\n" +
+	"\x12ConnectingDecision\x12#\n" +
+	"\rconnection_id\x18\x01 \x01(\tR\fconnectionId\x12\x16\n" +
+	"\x06accept\x18\x02 \x01(\bR\x06accept\x12\x17\n" +
+	"\auser_id\x18\x03 \x01(\tR\x06userId\"\xcb\x01\n" +
+	"\x05Event\x125\n" +
+	"\n" +
+	"connecting\x18\x01 \x01(\v2\x13.wsgw.v1.ConnectingH\x00R\n" +
+	"connecting\x12;\n" +
+	"\fdisconnected\x18\x02 \x01(\v2\x15.wsgw.v1.DisconnectedH\x00R\fdisconnected\x12E\n" +
+	"\x10message_received\x18\x03 \x01(\v2\x18.wsgw.v1.MessageReceivedH\x00R\x0fmessageReceivedB\a\n" +
+	"\x05event\"\xe2\x01\n" +
+	"\n" +
+	"Connecting\x12#\n" +
+	"\rconnection_id\x18\x01 \x01(\tR\fconnectionId\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x02 \x01(\tR\trequestId\x12:\n" +
+	"\aheaders\x18\x03 \x03(\v2 .wsgw.v1.Connecting.HeadersEntryR\aheaders\x12\x18\n" +
+	"\aresumed\x18\x04 \x01(\bR\aresumed\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"R\n" +
+	"\fDisconnected\x12#\n" +
+	"\rconnection_id\x18\x01 \x01(\tR\fconnectionId\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x02 \x01(\tR\trequestId\"\x8e\x01\n" +
+	"\x0fMessageReceived\x12#\n" +
+	"\rconnection_id\x18\x01 \x01(\tR\fconnectionId\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x02 \x01(\tR\trequestId\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x03 \x01(\tR\tmessageId\x12\x18\n" +
+	"\amessage\x18\x04 \x01(\tR\amessage2\xef\x03\n" +
+	"\aGateway\x123\n" +
+	"\x04Push\x12\x14.wsgw.v1.PushRequest\x1a\x15.wsgw.v1.PushResponse\x12A\n" +
+	"\n" +
+	"PushToUser\x12\x1a.wsgw.v1.PushToUserRequest\x1a\x17.wsgw.v1.FanOutResponse\x12I\n" +
+	"\x0ePublishToTopic\x12\x1e.wsgw.v1.PublishToTopicRequest\x1a\x17.wsgw.v1.FanOutResponse\x12?\n" +
+	"\tBroadcast\x12\x19.wsgw.v1.BroadcastRequest\x1a\x17.wsgw.v1.FanOutResponse\x12T\n" +
+	"\x0fCloseConnection\x12\x1f.wsgw.v1.CloseConnectionRequest\x1a .wsgw.v1.CloseConnectionResponse\x12T\n" +
+	"\x0fListConnections\x12\x1f.wsgw.v1.ListConnectionsRequest\x1a .wsgw.v1.ListConnectionsResponse\x124\n" +
+	"\x06Events\x12\x16.wsgw.v1.EventsRequest\x1a\x0e.wsgw.v1.Event(\x010\x01B,Z*websocket-gateway/internal/grpcapi;grpcapib\x06proto3"
+
+var (
+	file_wsgw_v1_gateway_proto_rawDescOnce sync.Once
+	file_wsgw_v1_gateway_proto_rawDescData []byte
+)
+
+func file_wsgw_v1_gateway_proto_rawDescGZIP() []byte {
+	file_wsgw_v1_gateway_proto_rawDescOnce.Do(func() {
+		file_wsgw_v1_gateway_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_wsgw_v1_gateway_proto_rawDesc), len(file_wsgw_v1_gateway_proto_rawDesc)))
+	})
+	return file_wsgw_v1_gateway_proto_rawDescData
+}
+
+var file_wsgw_v1_gateway_proto_msgTypes = make([]protoimpl.MessageInfo, 19)
+var file_wsgw_v1_gateway_proto_goTypes = []any{
+	(*PushRequest)(nil),             // 0: wsgw.v1.PushRequest
+	(*PushResponse)(nil),            // 1: wsgw.v1.PushResponse
+	(*PushToUserRequest)(nil),       // 2: wsgw.v1.PushToUserRequest
+	(*PublishToTopicRequest)(nil),   // 3: wsgw.v1.PublishToTopicRequest
+	(*BroadcastRequest)(nil),        // 4: wsgw.v1.BroadcastRequest
+	(*FanOutResponse)(nil),          // 5: wsgw.v1.FanOutResponse
+	(*CloseConnectionRequest)(nil),  // 6: wsgw.v1.CloseConnectionRequest
+	(*CloseConnectionResponse)(nil), // 7: wsgw.v1.CloseConnectionResponse
+	(*ListConnectionsRequest)(nil),  // 8: wsgw.v1.ListConnectionsRequest
+	(*ListConnectionsResponse)(nil), // 9: wsgw.v1.ListConnectionsResponse
+	(*Connection)(nil),              // 10: wsgw.v1.Connection
+	(*EventsRequest)(nil),           // 11: wsgw.v1.EventsRequest
+	(*Subscribe)(nil),               // 12: wsgw.v1.Subscribe
+	(*ConnectingDecision)(nil),      // 13: wsgw.v1.ConnectingDecision
+	(*Event)(nil),                   // 14: wsgw.v1.Event
+	(*Connecting)(nil),              // 15: wsgw.v1.Connecting
+	(*Disconnected)(nil),            // 16: wsgw.v1.Disconnected
+	(*MessageReceived)(nil),         // 17: wsgw.v1.MessageReceived
+	nil,                             // 18: wsgw.v1.Connecting.HeadersEntry
+	(*timestamppb.Timestamp)(nil),   // 19: google.protobuf.Timestamp
+}
+var file_wsgw_v1_gateway_proto_depIdxs = []int32{
+	10, // 0: wsgw.v1.ListConnectionsResponse.connections:type_name -> wsgw.v1.Connection
+	19, // 1: wsgw.v1.Connection.connected_at:type_name -> google.protobuf.Timestamp
+	12, // 2: wsgw.v1.EventsRequest.subscribe:type_name -> wsgw.v1.Subscribe
+	13, // 3: wsgw.v1.EventsRequest.decision:type_name -> wsgw.v1.ConnectingDecision
+	15, // 4: wsgw.v1.Event.connecting:type_name -> wsgw.v1.Connecting
+	16, // 5: wsgw.v1.Event.disconnected:type_name -> wsgw.v1.Disconnected
+	17, // 6: wsgw.v1.Event.message_received:type_name -> wsgw.v1.MessageReceived
+	18, // 7: wsgw.v1.Connecting.headers:type_name -> wsgw.v1.Connecting.HeadersEntry
+	0,  // 8: wsgw.v1.Gateway.Push:input_type -> wsgw.v1.PushRequest
+	2,  // 9: wsgw.v1.Gateway.PushToUser:input_type -> wsgw.v1.PushToUserRequest
+	3,  // 10: wsgw.v1.Gateway.PublishToTopic:input_type -> wsgw.v1.PublishToTopicRequest
+	4,  // 11: wsgw.v1.Gateway.Broadcast:input_type -> wsgw.v1.BroadcastRequest
+	6,  // 12: wsgw.v1.Gateway.CloseConnection:input_type -> wsgw.v1.CloseConnectionRequest
+	8,  // 13: wsgw.v1.Gateway.ListConnections:input_type -> wsgw.v1.ListConnectionsRequest
+	11, // 14: wsgw.v1.Gateway.Events:input_type -> wsgw.v1.EventsRequest
+	1,  // 15: wsgw.v1.Gateway.Push:output_type -> wsgw.v1.PushResponse
+	5,  // 16: wsgw.v1.Gateway.PushToUser:output_type -> wsgw.v1.FanOutResponse
+	5,  // 17: wsgw.v1.Gateway.PublishToTopic:output_type -> wsgw.v1.FanOutResponse
+	5,  // 18: wsgw.v1.Gateway.Broadcast:output_type -> wsgw.v1.FanOutResponse
+	7,  // 19: wsgw.v1.Gateway.CloseConnection:output_type -> wsgw.v1.CloseConnectionResponse
+	9,  // 20: wsgw.v1.Gateway.ListConnections:output_type -> wsgw.v1.ListConnectionsResponse
+	14, // 21: wsgw.v1.Gateway.Events:output_type -> wsgw.v1.Event
+	15, // [15:22] is the sub-list for method output_type
+	8,  // [8:15] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_wsgw_v1_gateway_proto_init() }
+func file_wsgw_v1_gateway_proto_init() {
+	if File_wsgw_v1_gateway_proto != nil {
+		return
+	}
+	file_wsgw_v1_gateway_proto_msgTypes[11].OneofWrappers = []any{
+		(*EventsRequest_Subscribe)(nil),
+		(*EventsRequest_Decision)(nil),
+	}
+	file_wsgw_v1_gateway_proto_msgTypes[14].OneofWrappers = []any{
+		(*Event_Connecting)(nil),
+		(*Event_Disconnected)(nil),
+		(*Event_MessageReceived)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_wsgw_v1_gateway_proto_rawDesc), len(file_wsgw_v1_gateway_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   19,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_wsgw_v1_gateway_proto_goTypes,
+		DependencyIndexes: file_wsgw_v1_gateway_proto_depIdxs,
+		MessageInfos:      file_wsgw_v1_gateway_proto_msgTypes,
+	}.Build()
+	File_wsgw_v1_gateway_proto = out.File
+	file_wsgw_v1_gateway_proto_goTypes = nil
+	file_wsgw_v1_gateway_proto_depIdxs = nil
+}
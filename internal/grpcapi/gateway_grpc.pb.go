@@ -0,0 +1,372 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: wsgw/v1/gateway.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Gateway_Push_FullMethodName            = "/wsgw.v1.Gateway/Push"
+	Gateway_PushToUser_FullMethodName      = "/wsgw.v1.Gateway/PushToUser"
+	Gateway_PublishToTopic_FullMethodName  = "/wsgw.v1.Gateway/PublishToTopic"
+	Gateway_Broadcast_FullMethodName       = "/wsgw.v1.Gateway/Broadcast"
+	Gateway_CloseConnection_FullMethodName = "/wsgw.v1.Gateway/CloseConnection"
+	Gateway_ListConnections_FullMethodName = "/wsgw.v1.Gateway/ListConnections"
+	Gateway_Events_FullMethodName          = "/wsgw.v1.Gateway/Events"
+)
+
+// GatewayClient is the client API for Gateway service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Gateway is the gRPC equivalent of the HTTP backend API. The backends authenticate with one of the
+// `BackendAPIKeys` of the application in the `authorization` metadata, e.g. `Bearer secret`, and can
+// pass a request ID in the `x-request-id` metadata.
+type GatewayClient interface {
+	// Push sends a message to a connection. Messages to recently disconnected connections are queued
+	// if the offline queue of the application is enabled.
+	Push(ctx context.Context, in *PushRequest, opts ...grpc.CallOption) (*PushResponse, error)
+	// PushToUser sends a message to the connections of a user across the cluster
+	PushToUser(ctx context.Context, in *PushToUserRequest, opts ...grpc.CallOption) (*FanOutResponse, error)
+	// PublishToTopic sends a message to the members of a topic across the cluster
+	PublishToTopic(ctx context.Context, in *PublishToTopicRequest, opts ...grpc.CallOption) (*FanOutResponse, error)
+	// Broadcast sends a message to all connections of the application across the cluster
+	Broadcast(ctx context.Context, in *BroadcastRequest, opts ...grpc.CallOption) (*FanOutResponse, error)
+	// CloseConnection closes a connection
+	CloseConnection(ctx context.Context, in *CloseConnectionRequest, opts ...grpc.CallOption) (*CloseConnectionResponse, error)
+	// ListConnections lists the connections of the application, those of a single user if `user_id` is set
+	ListConnections(ctx context.Context, in *ListConnectionsRequest, opts ...grpc.CallOption) (*ListConnectionsResponse, error)
+	// Events streams the connection events and the client messages of an application instead of the HTTP
+	// callbacks, as long as the stream is open. The first request subscribes to the events of the application,
+	// the following ones are the decisions on the connecting clients.
+	Events(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[EventsRequest, Event], error)
+}
+
+type gatewayClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGatewayClient(cc grpc.ClientConnInterface) GatewayClient {
+	return &gatewayClient{cc}
+}
+
+func (c *gatewayClient) Push(ctx context.Context, in *PushRequest, opts ...grpc.CallOption) (*PushResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PushResponse)
+	err := c.cc.Invoke(ctx, Gateway_Push_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) PushToUser(ctx context.Context, in *PushToUserRequest, opts ...grpc.CallOption) (*FanOutResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FanOutResponse)
+	err := c.cc.Invoke(ctx, Gateway_PushToUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) PublishToTopic(ctx context.Context, in *PublishToTopicRequest, opts ...grpc.CallOption) (*FanOutResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FanOutResponse)
+	err := c.cc.Invoke(ctx, Gateway_PublishToTopic_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) Broadcast(ctx context.Context, in *BroadcastRequest, opts ...grpc.CallOption) (*FanOutResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FanOutResponse)
+	err := c.cc.Invoke(ctx, Gateway_Broadcast_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) CloseConnection(ctx context.Context, in *CloseConnectionRequest, opts ...grpc.CallOption) (*CloseConnectionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CloseConnectionResponse)
+	err := c.cc.Invoke(ctx, Gateway_CloseConnection_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) ListConnections(ctx context.Context, in *ListConnectionsRequest, opts ...grpc.CallOption) (*ListConnectionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListConnectionsResponse)
+	err := c.cc.Invoke(ctx, Gateway_ListConnections_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) Events(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[EventsRequest, Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Gateway_ServiceDesc.Streams[0], Gateway_Events_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EventsRequest, Event]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gateway_EventsClient = grpc.BidiStreamingClient[EventsRequest, Event]
+
+// GatewayServer is the server API for Gateway service.
+// All implementations must embed UnimplementedGatewayServer
+// for forward compatibility.
+//
+// Gateway is the gRPC equivalent of the HTTP backend API. The backends authenticate with one of the
+// `BackendAPIKeys` of the application in the `authorization` metadata, e.g. `Bearer secret`, and can
+// pass a request ID in the `x-request-id` metadata.
+type GatewayServer interface {
+	// Push sends a message to a connection. Messages to recently disconnected connections are queued
+	// if the offline queue of the application is enabled.
+	Push(context.Context, *PushRequest) (*PushResponse, error)
+	// PushToUser sends a message to the connections of a user across the cluster
+	PushToUser(context.Context, *PushToUserRequest) (*FanOutResponse, error)
+	// PublishToTopic sends a message to the members of a topic across the cluster
+	PublishToTopic(context.Context, *PublishToTopicRequest) (*FanOutResponse, error)
+	// Broadcast sends a message to all connections of the application across the cluster
+	Broadcast(context.Context, *BroadcastRequest) (*FanOutResponse, error)
+	// CloseConnection closes a connection
+	CloseConnection(context.Context, *CloseConnectionRequest) (*CloseConnectionResponse, error)
+	// ListConnections lists the connections of the application, those of a single user if `user_id` is set
+	ListConnections(context.Context, *ListConnectionsRequest) (*ListConnectionsResponse, error)
+	// Events streams the connection events and the client messages of an application instead of the HTTP
+	// callbacks, as long as the stream is open. The first request subscribes to the events of the application,
+	// the following ones are the decisions on the connecting clients.
+	Events(grpc.BidiStreamingServer[EventsRequest, Event]) error
+	mustEmbedUnimplementedGatewayServer()
+}
+
+// UnimplementedGatewayServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGatewayServer struct{}
+
+func (UnimplementedGatewayServer) Push(context.Context, *PushRequest) (*PushResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Push not implemented")
+}
+func (UnimplementedGatewayServer) PushToUser(context.Context, *PushToUserRequest) (*FanOutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PushToUser not implemented")
+}
+func (UnimplementedGatewayServer) PublishToTopic(context.Context, *PublishToTopicRequest) (*FanOutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PublishToTopic not implemented")
+}
+func (UnimplementedGatewayServer) Broadcast(context.Context, *BroadcastRequest) (*FanOutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Broadcast not implemented")
+}
+func (UnimplementedGatewayServer) CloseConnection(context.Context, *CloseConnectionRequest) (*CloseConnectionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CloseConnection not implemented")
+}
+func (UnimplementedGatewayServer) ListConnections(context.Context, *ListConnectionsRequest) (*ListConnectionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListConnections not implemented")
+}
+func (UnimplementedGatewayServer) Events(grpc.BidiStreamingServer[EventsRequest, Event]) error {
+	return status.Errorf(codes.Unimplemented, "method Events not implemented")
+}
+func (UnimplementedGatewayServer) mustEmbedUnimplementedGatewayServer() {}
+func (UnimplementedGatewayServer) testEmbeddedByValue()                 {}
+
+// UnsafeGatewayServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GatewayServer will
+// result in compilation errors.
+type UnsafeGatewayServer interface {
+	mustEmbedUnimplementedGatewayServer()
+}
+
+func RegisterGatewayServer(s grpc.ServiceRegistrar, srv GatewayServer) {
+	// If the following call pancis, it indicates UnimplementedGatewayServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Gateway_ServiceDesc, srv)
+}
+
+func _Gateway_Push_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PushRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).Push(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gateway_Push_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).Push(ctx, req.(*PushRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_PushToUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PushToUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).PushToUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gateway_PushToUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).PushToUser(ctx, req.(*PushToUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_PublishToTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublishToTopicRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).PublishToTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gateway_PublishToTopic_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).PublishToTopic(ctx, req.(*PublishToTopicRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_Broadcast_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BroadcastRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).Broadcast(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gateway_Broadcast_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).Broadcast(ctx, req.(*BroadcastRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_CloseConnection_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CloseConnectionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).CloseConnection(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gateway_CloseConnection_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).CloseConnection(ctx, req.(*CloseConnectionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_ListConnections_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListConnectionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).ListConnections(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Gateway_ListConnections_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).ListConnections(ctx, req.(*ListConnectionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_Events_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GatewayServer).Events(&grpc.GenericServerStream[EventsRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Gateway_EventsServer = grpc.BidiStreamingServer[EventsRequest, Event]
+
+// Gateway_ServiceDesc is the grpc.ServiceDesc for Gateway service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Gateway_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wsgw.v1.Gateway",
+	HandlerType: (*GatewayServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Push",
+			Handler:    _Gateway_Push_Handler,
+		},
+		{
+			MethodName: "PushToUser",
+			Handler:    _Gateway_PushToUser_Handler,
+		},
+		{
+			MethodName: "PublishToTopic",
+			Handler:    _Gateway_PublishToTopic_Handler,
+		},
+		{
+			MethodName: "Broadcast",
+			Handler:    _Gateway_Broadcast_Handler,
+		},
+		{
+			MethodName: "CloseConnection",
+			Handler:    _Gateway_CloseConnection_Handler,
+		},
+		{
+			MethodName: "ListConnections",
+			Handler:    _Gateway_ListConnections_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Events",
+			Handler:       _Gateway_Events_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "wsgw/v1/gateway.proto",
+}
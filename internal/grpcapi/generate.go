@@ -0,0 +1,4 @@
+// Package grpcapi is the code generated from proto/wsgw/v1/gateway.proto for the gRPC backend API
+package grpcapi
+
+//go:generate protoc -I ../../proto --go_out=. --go_opt=module=websocket-gateway/internal/grpcapi --go-grpc_out=. --go-grpc_opt=module=websocket-gateway/internal/grpcapi wsgw/v1/gateway.proto
@@ -0,0 +1,120 @@
+package wsgw
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// HealthConfig configures the readiness checks
+type HealthConfig struct {
+	// CapacityThreshold is the number of connections of the node at which it reports not ready,
+	// so that no more clients are sent its way. 0 disables the check.
+	CapacityThreshold int
+	// FailOnOpenCircuit makes the node report not ready while the circuit breaker of any application is open.
+	// Otherwise, the state of the circuits is only described, as the other applications are still served.
+	FailOnOpenCircuit bool
+}
+
+// healthCheck is the outcome of a readiness check
+type healthCheck struct {
+	Name    string `json:"name"`
+	App     string `json:"app,omitempty"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+	// Informational checks don't decide on the readiness
+	Informational bool `json:"informational,omitempty"`
+}
+
+type readinessResponse struct {
+	Ready  bool          `json:"ready"`
+	Checks []healthCheck `json:"checks"`
+}
+
+// health reports the liveness and readiness of the node
+type health struct {
+	capacityThreshold int
+	failOnOpenCircuit bool
+	apps              *applications
+	draining          atomic.Bool
+}
+
+func newHealth(conf HealthConfig, apps *applications) *health {
+	return &health{
+		capacityThreshold: conf.CapacityThreshold,
+		failOnOpenCircuit: conf.FailOnOpenCircuit,
+		apps:              apps,
+	}
+}
+
+// readiness runs the readiness checks
+func (h *health) readiness() readinessResponse {
+	checks := []healthCheck{{Name: "draining", OK: !h.draining.Load()}}
+	if !checks[0].OK {
+		checks[0].Message = "draining connections"
+	}
+
+	connections := 0
+	for _, name := range h.apps.names() {
+		app := h.apps.byName[name]
+		connections += app.conns.count()
+
+		check := healthCheck{Name: "callbacks", App: name, OK: !app.client.breaker.isOpen(), Informational: !h.failOnOpenCircuit}
+		if !check.OK {
+			check.Message = errCircuitOpen.Error()
+		}
+		checks = append(checks, check)
+	}
+
+	if h.capacityThreshold > 0 {
+		checks = append(checks, healthCheck{
+			Name:    "capacity",
+			OK:      connections < h.capacityThreshold,
+			Message: fmt.Sprintf("%d connections of %d", connections, h.capacityThreshold),
+		})
+	}
+
+	response := readinessResponse{Ready: true, Checks: checks}
+	for _, check := range checks {
+		response.Ready = response.Ready && (check.OK || check.Informational)
+	}
+	return response
+}
+
+// livenessHandler reports that the process is alive without checking anything
+func (h *health) livenessHandler() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		g.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+// readinessHandler reports whether the node is ready for new connections, describing each check
+func (h *health) readinessHandler() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		response := h.readiness()
+		if !response.Ready {
+			zerolog.Ctx(g.Request.Context()).Info().Interface("checks", response.Checks).Msg("not ready")
+			g.JSON(http.StatusServiceUnavailable, response)
+			return
+		}
+		g.JSON(http.StatusOK, response)
+	}
+}
+
+// drainingGuard rejects new connections while the node is draining
+func (h *health) drainingGuard() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		if h.draining.Load() {
+			zerolog.Ctx(g.Request.Context()).Info().Msg("draining, connection rejected")
+			g.AbortWithStatus(http.StatusServiceUnavailable)
+			app := appFromContext(g)
+			app.audit.connectAttempted(app.name, g, g.Query(resumeTokenQueryParam) != "")
+			app.audit.connectRejected(app.name, requestIDFromContext(g.Request.Context()), "draining", http.StatusServiceUnavailable)
+			return
+		}
+		g.Next()
+	}
+}
@@ -7,16 +7,69 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+	"websocket-gateway/internal/logging"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"nhooyr.io/websocket"
 )
 
 // TODO: make this configurable?
 const ConnectionIDHeaderKey = "X-WSGW-CONNECTION-ID"
 
+// UserIDHeaderKey is the header the application can identify the user of an accepted connection with
+// in its response to `POST /ws/connecting`
+const UserIDHeaderKey = "X-WSGW-USER-ID"
+
+// MessageIDHeaderKey is the header conveying the ID the gateway assigned to a message received from a client
+const MessageIDHeaderKey = "X-WSGW-MESSAGE-ID"
+
+// tooSlowCloseReason is the reason connections are closed with for being too slow to keep up with the messages
+const tooSlowCloseReason = "connection too slow to keep up with messages"
+
+// transport binds the connections accepted by the applications to the sockets of a protocol
+type transport interface {
+	name() string
+	// accept upgrades the request to the socket the connection is bound to. `closeSocket` is to be called
+	// once the connection is done with the socket.
+	accept(g *gin.Context, app *application, conn *connection) (socket wsIO, closeSocket func(), err error)
+	// detached reports whether the sockets outlive the requests opening them, which are answered right away
+	detached() bool
+}
+
+// webSocketTransport binds the connections to WebSockets
+type webSocketTransport struct{}
+
+func (webSocketTransport) name() string {
+	return "websocket"
+}
+
+func (webSocketTransport) detached() bool {
+	return false
+}
+
+func (webSocketTransport) accept(g *gin.Context, app *application, conn *connection) (wsIO, func(), error) {
+	wsConn, acceptErr := websocket.Accept(g.Writer, g.Request, &websocket.AcceptOptions{
+		OriginPatterns: app.settings.Load().originPatterns,
+	})
+	if acceptErr != nil {
+		return nil, nil, acceptErr
+	}
+	wsConn.SetReadLimit(maxMessageSize)
+	return &wsIOAdapter{wsConn}, func() {
+		if conn.overloaded.Load() {
+			wsConn.Close(websocket.StatusTryAgainLater, callbackQueueFullCloseReason)
+			return
+		}
+		wsConn.Close(websocket.StatusNormalClosure, "")
+	}, nil
+}
+
 type wsIOAdapter struct {
 	wsConn *websocket.Conn
 }
@@ -26,7 +79,7 @@ func (wsIo *wsIOAdapter) CloseRead(ctx context.Context) context.Context {
 }
 
 func (wsIo *wsIOAdapter) Close() error {
-	return wsIo.wsConn.Close(websocket.StatusPolicyViolation, "connection too slow to keep up with messages")
+	return wsIo.wsConn.Close(websocket.StatusPolicyViolation, tooSlowCloseReason)
 }
 
 func (wsIo *wsIOAdapter) Write(ctx context.Context, msg string) error {
@@ -47,95 +100,329 @@ func (wsIo *wsIOAdapter) Read(ctx context.Context) (string, error) {
 type applicationURLs interface {
 	connecting() string
 	disconnected() string
+	messageReceived() string
 }
 
-// Relays the connection request to the backend's `POST /ws/connecting` endpoint and
-func notifyAppOfWsConnectionChange(notificationUrl string, connId connectionID, g *gin.Context, parentLogger zerolog.Logger) bool {
+const (
+	connectingEndpoint      = "connecting"
+	disconnectedEndpoint    = "disconnected"
+	messageReceivedEndpoint = "message-received"
+)
+
+// notifyAppOfWsConnectionChange relays the connection request (`header`) to the backend's endpoint at `notificationUrl`,
+// e.g. `POST /ws/connecting`, with the connection ID added. It returns whether the application accepted the
+// connection along with the header of its response or, if it did not, the status code to respond to the client with.
+func notifyAppOfWsConnectionChange(ctx context.Context, client *appClient, endpoint string, notificationUrl string, connId connectionID, header http.Header, parentLogger zerolog.Logger) (bool, http.Header, int) {
 	logger := parentLogger.With().Str("method", fmt.Sprintf("notifyAppOfWsConnecting: %s", notificationUrl)).Logger()
 
 	logger.Debug().Msg("BEGIN")
 	defer logger.Debug().Msg("END")
 
-	logger.Debug().Msg("Creating request...")
-	request, err := http.NewRequest(http.MethodPost, notificationUrl, nil)
-	if err != nil {
-		logger.Error().Stack().Err(err).Msg("failed to create request object")
-		g.AbortWithStatus(http.StatusInternalServerError)
-		return false
-	}
-	request.Header = g.Request.Header
-
-	request.Header.Add(ConnectionIDHeaderKey, string(connId))
+	header = header.Clone()
+	header.Set(ConnectionIDHeaderKey, string(connId))
 
-	// TODO: doesn't recreate the client for each request
-	client := http.Client{
-		Timeout: time.Second * 15,
-	}
 	logger.Debug().Msg("executing request...")
-	response, requestErr := client.Do(request)
+	statusCode, responseHeader, requestErr := client.post(ctx, endpoint, notificationUrl, header, nil)
+	if requestErr == errCircuitOpen {
+		logger.Info().Msg("callback circuit open")
+		return false, nil, http.StatusServiceUnavailable
+	}
 	if requestErr != nil {
 		logger.Error().Stack().Err(requestErr).Msg("failed to send request")
-		g.AbortWithStatus(http.StatusInternalServerError)
-		return false
+		return false, nil, http.StatusInternalServerError
 	}
-	logger.Debug().Int("status_code", response.StatusCode).Msg("checking status code...")
-	if response.StatusCode == http.StatusUnauthorized {
+	logger.Debug().Int("status_code", statusCode).Msg("checking status code...")
+	if statusCode == http.StatusUnauthorized {
 		logger.Info().Msg("Authentication failed")
-		g.AbortWithStatus(http.StatusUnauthorized)
-		return false
+		return false, nil, http.StatusUnauthorized
+	}
+	if statusCode != 200 {
+		logger.Info().Int("status_code", statusCode).Msg("unexpected status code")
+		return false, nil, http.StatusInternalServerError
+	}
+	return true, responseHeader, 0
+}
+
+// hopByHopHeaders are specific to the client's connection to the gateway and the WS handshake,
+// so they are not relayed to the application
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Sec-Websocket-Key",
+	"Sec-Websocket-Version",
+	"Sec-Websocket-Extensions",
+	"Sec-Websocket-Protocol",
+}
+
+// gatewayHeaders are set by the gateway only, the values sent by clients are not relayed.
+// The trace context of the client is continued by the gateway's spans instead.
+var gatewayHeaders = []string{
+	ConnectionIDHeaderKey,
+	ResumedHeaderKey,
+	ForwardedByHeaderKey,
+	ClusterKeyHeaderKey,
+	RequestIDHeaderKey,
+	"Traceparent",
+	"Tracestate",
+}
+
+func relayedHeader(incoming http.Header) http.Header {
+	header := incoming.Clone()
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
 	}
-	if response.StatusCode != 200 {
-		logger.Info().Int("status_code", response.StatusCode).Msg("unexpected status code")
-		g.AbortWithStatus(http.StatusInternalServerError)
-		return false
+	for _, name := range gatewayHeaders {
+		header.Del(name)
 	}
-	return true
+	return header
 }
 
-// connectHandler calls `authenticateClient` if it is not `nil` to authenticate the client,
-// then notifies the application of the new WS connection
-func connectHandler(
-	appUrls applicationURLs,
-	ws *wsConnections,
-	loadBalancerAddress string,
-	onMessageReceived onMgsReceivedFunc,
-) gin.HandlerFunc {
+// messageReceivedNotifier creates the function relaying the messages received from the clients
+// to the backend's `POST /ws/message-received` endpoint
+func messageReceivedNotifier(appUrls applicationURLs, client *appClient, parentLogger zerolog.Logger) onMgsReceivedFunc {
+	logger := parentLogger.With().Str(logging.MethodLogger, "notifyAppOfMessageReceived").Logger()
+
+	return func(msg inboundMessage) error {
+		header := http.Header{}
+		header.Set(ConnectionIDHeaderKey, string(msg.connectionId))
+		header.Set(MessageIDHeaderKey, msg.id)
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+
+		// The callbacks are correlated with the request, which opened the connection
+		ctx := withRequestID(trace.ContextWithSpanContext(context.Background(), msg.traceContext), msg.requestID)
+		statusCode, _, err := client.post(ctx, messageReceivedEndpoint, appUrls.messageReceived(), header, strings.NewReader(msg.data))
+		if err != nil {
+			client.failed(messageReceivedEndpoint)
+			logger.Error().Err(err).Str("connection_id", string(msg.connectionId)).Str("request_id", msg.requestID).Str("message_id", msg.id).Msg("failed to send request")
+			return err
+		}
+		if statusCode != http.StatusOK {
+			client.failed(messageReceivedEndpoint)
+			logger.Info().Int("status_code", statusCode).Str("connection_id", string(msg.connectionId)).Str("request_id", msg.requestID).Str("message_id", msg.id).Msg("unexpected status code")
+			return fmt.Errorf("unexpected status code: %d", statusCode)
+		}
+		return nil
+	}
+}
+
+// connectHandler notifies the application selected for the request of the new connection
+// for authentication, then processes the messages over the socket of the `transport` until it is closed.
+// Clients reconnecting within the grace period of their lost connection are rebound to it without
+// the application noticing, whatever the transport.
+func connectHandler(ids *connectionIDs, transport transport) gin.HandlerFunc {
 	return func(g *gin.Context) {
+		app := appFromContext(g)
+
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("client connecting", g.Request.RemoteAddr).Str("app", app.name).Str("transport", transport.name()).Logger()
+
+		// The handshake, including the `/ws/connecting` callback, is traced
+		handshakeCtx, span := app.tracing.startServerSpan(g, "wsgw.connect", attribute.String("wsgw.app", app.name))
+		endHandshake := func(outcome string, status int) {
+			app.metrics.connects.WithLabelValues(app.name, outcome).Inc()
+			span.SetAttributes(attribute.String("wsgw.outcome", outcome))
+			endServerSpan(span, status)
+		}
+
+		requestID := requestIDFromContext(g.Request.Context())
+		resumeToken := g.Query(resumeTokenQueryParam)
+		app.audit.connectAttempted(app.name, g, resumeToken != "")
+
+		var clientLastSeq uint64
+		if lastSeq := g.Query(lastSeqQueryParam); lastSeq != "" {
+			clientLastSeq, _ = strconv.ParseUint(lastSeq, 10, 64)
+		}
+
+		var conn *connection
+		var session *retainedSession
+		if resumeToken != "" && app.conns.resumable() {
+			if held := app.conns.claimHeld(resumeToken); held != nil {
+				conn = held.conn
+			} else if app.conns.replayEnabled() {
+				var sessionErr error
+				session, sessionErr = app.conns.claimSession(resumeToken)
+				if sessionErr != nil {
+					// The client will learn from the session message that it got a new session
+					logger.Info().Err(sessionErr).Msg("session can't be resumed")
+				}
+			}
+		}
 
-		logger := zerolog.Ctx(g.Request.Context()).With().Str("client connecting", g.Request.RemoteAddr).Logger()
+		callbackHeader := relayedHeader(g.Request.Header)
+		callbackCtx := context.WithoutCancel(handshakeCtx)
 
-		connId := createID()
+		rebound := conn != nil
+		releaseSlot := func() {}
+		if rebound {
+			logger = logger.With().Str("rebound_connection_id", string(conn.id)).Logger()
+			app.conns.rebind(conn, clientLastSeq)
+		} else {
+			// The slot is held from before the callback until the connection is added or rejected
+			maxConnections := app.settings.Load().maxConnections
+			var reserved bool
+			releaseSlot, reserved = app.conns.reserveSlot(maxConnections)
+			if !reserved {
+				logger.Info().Int("max_connections", maxConnections).Msg("connection limit reached")
+				g.AbortWithStatus(http.StatusServiceUnavailable)
+				endHandshake("over_capacity", http.StatusServiceUnavailable)
+				app.audit.connectRejected(app.name, requestID, "over_capacity", http.StatusServiceUnavailable)
+				return
+			}
+			defer releaseSlot()
 
-		appAccepted := notifyAppOfWsConnectionChange(appUrls.connecting(), connId, g, logger)
-		logger.Debug().Bool("app_accepted", appAccepted)
+			connId := ids.create(app.name)
+			connectingHeader := callbackHeader
+			if session != nil {
+				connId = session.connId
+				connectingHeader = callbackHeader.Clone()
+				connectingHeader.Set(ResumedHeaderKey, "true")
+				logger = logger.With().Str("resumed_connection_id", string(connId)).Logger()
+			}
 
-		if !appAccepted {
+			appAccepted, appResponseHeader, rejectionStatus := app.notifyConnectionChange(callbackCtx, connectingEndpoint, connId, connectingHeader, logger)
+			logger.Debug().Bool("app_accepted", appAccepted)
+			app.audit.appDecision(app.name, requestID, connId, appAccepted, appResponseHeader.Get(UserIDHeaderKey), rejectionStatus)
+
+			if !appAccepted {
+				if session != nil {
+					app.conns.releaseSession(session)
+				}
+				g.AbortWithStatus(rejectionStatus)
+				if rejectionStatus == http.StatusUnauthorized {
+					endHandshake("unauthorized", rejectionStatus)
+				} else {
+					endHandshake("rejected", rejectionStatus)
+				}
+				return
+			}
+
+			conn = app.conns.newConnection(connId, appResponseHeader.Get(UserIDHeaderKey), requestID, session, clientLastSeq)
+			conn.traceContext = span.SpanContext()
+			if rate, hasRate := connectionSampleRate(appResponseHeader); hasRate {
+				conn.payloadSampleRate = &rate
+			}
+			app.conns.logConnectionRequest(conn, callbackHeader)
+		}
+		logger = logger.With().Str("connection_id", string(conn.id)).Str("user_id", conn.userID).Logger()
+		span.SetAttributes(attribute.String("wsgw.connection_id", string(conn.id)))
+		if conn.resumeToken != "" {
+			g.Header(ResumeTokenHeaderKey, conn.resumeToken)
+		}
+
+		notifyAppOfDisconnection := func() {
+			// The application learns of the disconnection after the batches of messages received before
+			app.batcher.afterMessagesOf(conn.id, func() {
+				app.notifyConnectionChange(callbackCtx, disconnectedEndpoint, conn.id, callbackHeader, logger)
+			})
+		}
+
+		socket, closeSocket, acceptErr := transport.accept(g, app, conn)
+		if acceptErr != nil {
+			logger.Error().Stack().Err(acceptErr).Msg("failed to accept connection request")
+			g.Error(acceptErr)
+			if g.Writer.Written() {
+				// The transport responded with the reason already
+				g.Abort()
+			} else {
+				g.AbortWithStatus(500)
+			}
+			endHandshake("handshake_failed", http.StatusInternalServerError)
+			app.audit.upgradeFailed(app.name, conn, requestID, acceptErr)
+			if rebound {
+				app.conns.connectionLost(conn, acceptErr, notifyAppOfDisconnection)
+			}
 			return
 		}
 
-		wsConn, subsErr := websocket.Accept(g.Writer, g.Request, &websocket.AcceptOptions{
-			OriginPatterns: []string{loadBalancerAddress},
-		})
-		if subsErr != nil {
-			logger.Error().Stack().Err(subsErr).Msg("failed to accept WS connection request")
-			g.Error(subsErr)
-			g.AbortWithStatus(500)
+		outcome := "accepted"
+		switch {
+		case rebound:
+			outcome = "rebound"
+		case session != nil:
+			outcome = "resumed"
+		}
+		endHandshake(outcome, http.StatusSwitchingProtocols)
+		app.audit.upgraded(app.name, conn, requestID, transport.name(), outcome)
+		if !rebound {
+			app.conns.addConnection(conn)
+			releaseSlot()
+			app.broker.connected(app.name, conn)
+		}
+
+		serve := func(ctx context.Context) {
+			defer closeSocket()
+
+			logger.Debug().Msg("message processing about to start...")
+			subscriptionError := app.conns.processMessages(ctx, conn, socket, app.onMessageReceived) // we block here until Error or Done
+			logger.Debug().Stack().Err(subscriptionError).Msg("failed to process websocket message")
+
+			app.conns.connectionLost(conn, subscriptionError, notifyAppOfDisconnection)
+		}
+		if transport.detached() {
+			go serve(context.WithoutCancel(g.Request.Context()))
 			return
 		}
-		defer wsConn.Close(websocket.StatusNormalClosure, "")
+		serve(g.Request.Context())
+	}
+}
 
-		logger.Debug().Msg("websocket message processing about to start...")
-		subscriptionError := ws.processMessages(g.Request.Context(), connId, &wsIOAdapter{wsConn}, onMessageReceived) // we block here until Error or Done
-		logger.Debug().Stack().Err(subscriptionError).Msg("failed to process websocket message")
+// backendAuthenticator aborts the request if `authenticateBackend` fails to authenticate the caller
+// as a backend of the application selected for the request
+func backendAuthenticator(authenticateBackend func(app *application, c *gin.Context) error) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		app := appFromContext(g)
+		if authErr := authenticateBackend(app, g); authErr != nil {
+			zerolog.Ctx(g.Request.Context()).Info().Str("app", app.name).Err(authErr).Msg("failed to authenticate backend")
+			g.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		g.Next()
+	}
+}
+
+// readMessageToPush reads the message to push from the request body, which is expected to be a JSON string
+func readMessageToPush(g *gin.Context, logger zerolog.Logger) (string, bool) {
+	requestBody, errReadRequest := io.ReadAll(g.Request.Body)
+	if errReadRequest != nil {
+		logger.Error().Str("body_type", fmt.Sprintf("%T", g.Request.Body)).Err(errReadRequest).Msg("failed to read request body")
+		g.JSON(500, nil)
+		return "", false
+	}
+	var body interface{}
+	errBodyUnmarshal := json.Unmarshal(requestBody, &body)
+	if errBodyUnmarshal != nil {
+		logger.Error().Str("body_content_type", fmt.Sprintf("%T", requestBody)).Err(errBodyUnmarshal).Msg("failed to unmarshal request body")
+		g.JSON(400, nil)
+		return "", false
+	}
 
-		notifyAppOfWsConnectionChange(appUrls.disconnected(), connId, g, logger)
+	bodyAsString, conversionOk := body.(string)
+	if !conversionOk {
+		logger.Error().Str("body_content_type", fmt.Sprintf("%T", requestBody)).Msg("failed to convert request body to string")
+		g.JSON(400, nil)
+		return "", false
 	}
+
+	return bodyAsString, true
 }
 
-func pushHandler(authenticateBackend func(c *gin.Context) error, connIdPathParamName string, ws *wsConnections) gin.HandlerFunc {
+func pushHandler(connIdPathParamName string) gin.HandlerFunc {
 	return func(g *gin.Context) {
+		app := appFromContext(g)
 
-		logger := zerolog.Ctx(g.Request.Context()).With().Str("server pushing", g.Request.RemoteAddr).Logger()
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("server pushing", g.Request.RemoteAddr).Str("app", app.name).Logger()
+
+		// The push is traced through to the write of the message to the socket
+		ctx, span := app.tracing.startServerSpan(g, "wsgw.push", attribute.String("wsgw.app", app.name))
+		start := time.Now()
+		defer func() {
+			app.metrics.pushDuration.WithLabelValues(app.name, strconv.Itoa(g.Writer.Status())).Observe(time.Since(start).Seconds())
+			endServerSpan(span, g.Writer.Status())
+		}()
 
 		connectionIdStr := g.Param(connIdPathParamName)
 		if connectionIdStr == "" {
@@ -143,36 +430,204 @@ func pushHandler(authenticateBackend func(c *gin.Context) error, connIdPathParam
 			g.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
+		span.SetAttributes(attribute.String("wsgw.connection_id", connectionIdStr))
 
-		requestBody, errReadRequest := io.ReadAll(g.Request.Body)
-		if errReadRequest != nil {
-			logger.Error().Str("body_type", fmt.Sprintf("%T", g.Request.Body)).Err(errReadRequest).Msg("failed to read request body")
-			g.JSON(500, nil)
+		message, messageOk := readMessageToPush(g, logger)
+		if !messageOk {
 			return
 		}
-		var body interface{}
-		errBodyUnmarshal := json.Unmarshal(requestBody, &body)
-		if errBodyUnmarshal != nil {
-			logger.Error().Str("body_content_type", fmt.Sprintf("%T", requestBody)).Err(errBodyUnmarshal).Msg("failed to unmarshal request body")
-			g.JSON(400, nil)
+
+		queued, errPush := app.conns.pushOrQueue(ctx, message, connectionID(connectionIdStr))
+		if queued {
+			logger.Debug().Str("connection_id", connectionIdStr).Msg("connection offline, message queued")
+			g.Status(http.StatusAccepted)
 			return
 		}
+		if errPush == ErrConnectionNotFound {
+			logger.Error().Str("connection_id", connectionIdStr).Msg("connection doesn't exist")
+			g.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		if errPush == errConnectionTooSlow {
+			logger.Info().Str("connection_id", connectionIdStr).Msg("connection too slow, message dropped")
+			g.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		if errPush == errRateLimited {
+			logger.Info().Str("connection_id", connectionIdStr).Msg("push rate limit exceeded")
+			g.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+		if errPush == errOfflineQueueFull {
+			logger.Info().Str("connection_id", connectionIdStr).Msg("offline queue full, message rejected")
+			g.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		if errPush != nil {
+			logger.Error().Str("connection_id", connectionIdStr).Err(errPush).Msg("failed to push to connection")
+			g.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		g.Status(http.StatusNoContent)
+	}
+}
+
+func closeHandler(connIdPathParamName string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		app := appFromContext(g)
+
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("server closing", g.Request.RemoteAddr).Str("app", app.name).Logger()
 
-		bodyAsString, conversionOk := body.(string)
-		if !conversionOk {
-			logger.Error().Str("body_content_type", fmt.Sprintf("%T", requestBody)).Msg("failed to convert request body to string")
-			g.JSON(400, nil)
+		connectionIdStr := g.Param(connIdPathParamName)
+		errClose := app.conns.close(connectionID(connectionIdStr), newBackendCaller(g))
+		if errClose == ErrConnectionNotFound {
+			logger.Info().Str("connection_id", connectionIdStr).Msg("connection doesn't exist")
+			g.AbortWithStatus(http.StatusNotFound)
 			return
 		}
 
-		errPush := ws.push(bodyAsString, connectionID(connectionIdStr))
-		if errPush == errConnectionNotFound {
-			logger.Error().Str("connection_id", connectionIdStr).Msg("connection doesn't exist")
+		g.Status(http.StatusNoContent)
+	}
+}
+
+type broadcastResponse struct {
+	Recipients int `json:"recipients"`
+	// Queued is the number of nodes the message was queued on for recently disconnected recipients
+	Queued int `json:"queued"`
+}
+
+func (r *broadcastResponse) add(other broadcastResponse) {
+	r.Recipients += other.Recipients
+	r.Queued += other.Queued
+}
+
+// deliverLocallyFunc sends msg to the recipients on this node selected by the request
+// and returns the number of them
+type deliverLocallyFunc func(app *application, g *gin.Context, msg string) (broadcastResponse, error)
+
+// fanOutHandler sends the message to the selected recipients on this node and, unless the
+// request was forwarded by another node, on the other nodes of the cluster
+func fanOutHandler(cluster *cluster, deliverLocally deliverLocallyFunc) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		app := appFromContext(g)
+
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("server broadcasting", g.Request.RemoteAddr).Str("app", app.name).Logger()
+
+		ctx, span := app.tracing.startServerSpan(g, "wsgw.fan-out", attribute.String("wsgw.app", app.name), attribute.String("http.route", g.FullPath()))
+		defer func() {
+			endServerSpan(span, g.Writer.Status())
+		}()
+		g.Request = g.Request.WithContext(ctx)
+
+		message, messageOk := readMessageToPush(g, logger)
+		if !messageOk {
+			return
+		}
+
+		result, deliveryErr := deliverLocally(app, g, message)
+		if deliveryErr == errRateLimited {
+			logger.Info().Msg("push rate limit exceeded")
+			g.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+		if deliveryErr != nil {
+			logger.Error().Err(deliveryErr).Msg("failed to deliver message")
+			g.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !isForwarded(g) {
+			peerHeader := g.Request.Header.Clone()
+			app.tracing.inject(ctx, peerHeader)
+			result.add(cluster.broadcastToPeers(ctx, g.Request.URL.Path, peerHeader, message))
+		}
+		logger.Debug().Int("recipients", result.Recipients).Int("queued", result.Queued).Msg("message sent")
+
+		g.JSON(http.StatusOK, result)
+	}
+}
+
+func broadcastHandler(cluster *cluster) gin.HandlerFunc {
+	return fanOutHandler(cluster, func(app *application, g *gin.Context, msg string) (broadcastResponse, error) {
+		recipients, err := app.conns.broadcast(g.Request.Context(), msg)
+		return broadcastResponse{Recipients: recipients}, err
+	})
+}
+
+func pushToUserHandler(cluster *cluster, userIdPathParamName string) gin.HandlerFunc {
+	return fanOutHandler(cluster, func(app *application, g *gin.Context, msg string) (broadcastResponse, error) {
+		recipients, queued, err := app.conns.pushToUser(g.Request.Context(), g.Param(userIdPathParamName), msg)
+		result := broadcastResponse{Recipients: recipients}
+		if queued {
+			result.Queued = 1
+		}
+		return result, err
+	})
+}
+
+func publishToTopicHandler(cluster *cluster, topicPathParamName string) gin.HandlerFunc {
+	return fanOutHandler(cluster, func(app *application, g *gin.Context, msg string) (broadcastResponse, error) {
+		recipients, err := app.conns.publishToTopic(g.Request.Context(), g.Param(topicPathParamName), msg)
+		return broadcastResponse{Recipients: recipients}, err
+	})
+}
+
+// topicMembershipHandler adds the connection to or, with `join` false, removes it from the topic
+func topicMembershipHandler(connIdPathParamName string, topicPathParamName string, join bool) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		app := appFromContext(g)
+
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("app", app.name).Logger()
+
+		connId := connectionID(g.Param(connIdPathParamName))
+		topic := g.Param(topicPathParamName)
+
+		var err error
+		if join {
+			err = app.conns.joinTopic(g.Request.Context(), connId, topic)
+		} else {
+			err = app.conns.leaveTopic(g.Request.Context(), connId, topic)
+		}
+		if err == ErrConnectionNotFound {
+			logger.Info().Str("connection_id", string(connId)).Msg("connection doesn't exist")
 			g.AbortWithStatus(http.StatusNotFound)
 			return
 		}
+		if err != nil {
+			logger.Error().Str("connection_id", string(connId)).Str("topic", topic).Bool("join", join).Err(err).Msg("failed to update topic membership")
+			g.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		g.Status(http.StatusNoContent)
+	}
+}
+
+// listConnectionsHandler lists the connections of the application known to the registry,
+// those of a single user if the `user` query parameter is specified
+func listConnectionsHandler() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		app := appFromContext(g)
+
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("app", app.name).Logger()
+
+		entries, err := app.conns.registry.Connections(g.Request.Context(), app.name)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to list connections")
+			g.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		if userID := g.Query("user"); userID != "" {
+			userEntries := []ConnectionEntry{}
+			for _, entry := range entries {
+				if entry.UserID == userID {
+					userEntries = append(userEntries, entry)
+				}
+			}
+			entries = userEntries
+		}
 
-		logger.Error().Str("connection_id", connectionIdStr).Err(errPush).Msg("failed to push to connection")
-		g.AbortWithStatus(http.StatusInternalServerError)
+		g.JSON(http.StatusOK, entries)
 	}
 }
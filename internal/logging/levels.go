@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	// levelsMu serializes the changes of the levels
+	levelsMu        sync.Mutex
+	baseLevel       atomic.Int32
+	subsystemLevels atomic.Pointer[map[string]zerolog.Level]
+)
+
+// Level returns the current log level
+func Level() zerolog.Level {
+	return zerolog.Level(baseLevel.Load())
+}
+
+// SetLevel changes the log level of all loggers at runtime
+func SetLevel(level zerolog.Level) {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+	baseLevel.Store(int32(level))
+	applyLevels()
+}
+
+// SetSubsystemLevels replaces the levels of the subsystems at runtime
+func SetSubsystemLevels(levels map[string]zerolog.Level) {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+	subsystemLevels.Store(&levels)
+	applyLevels()
+}
+
+// applyLevels sets the global level to the lowest level, so that the events of the subsystems with a
+// lower level than the base level reach the subsystemLevelWriter. It is to be called with `levelsMu` held.
+func applyLevels() {
+	lowest := Level()
+	if levels := subsystemLevels.Load(); levels != nil {
+		for _, level := range *levels {
+			lowest = min(lowest, level)
+		}
+	}
+	zerolog.SetGlobalLevel(lowest)
+}
+
+// subsystemLevelWriter drops the events below the level of their subsystem or, if no level is set for
+// the subsystem, the base level
+type subsystemLevelWriter struct {
+	out zerolog.LevelWriter
+}
+
+func (w *subsystemLevelWriter) Write(p []byte) (int, error) {
+	return w.out.Write(p)
+}
+
+func (w *subsystemLevelWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	threshold := Level()
+	if levels := subsystemLevels.Load(); levels != nil && len(*levels) > 0 {
+		if subsystemLevel, ok := levelOf(*levels, p); ok {
+			threshold = subsystemLevel
+		}
+	}
+	if level < threshold {
+		return len(p), nil
+	}
+	return w.out.WriteLevel(level, p)
+}
+
+// levelOf returns the level of the subsystem of the JSON encoded event `p` by its method or unit.
+// The last field wins, as it was added by the most specific logger.
+func levelOf(levels map[string]zerolog.Level, p []byte) (zerolog.Level, bool) {
+	for _, key := range []string{MethodLogger, UnitLogger} {
+		if subsystem, ok := stringField(p, key); ok {
+			if level, hasLevel := levels[subsystem]; hasLevel {
+				return level, true
+			}
+		}
+	}
+	return zerolog.NoLevel, false
+}
+
+func stringField(p []byte, key string) (string, bool) {
+	prefix := []byte(`"` + key + `":"`)
+	start := bytes.LastIndex(p, prefix)
+	if start < 0 {
+		return "", false
+	}
+	value := p[start+len(prefix):]
+	end := bytes.IndexByte(value, '"')
+	if end < 0 {
+		return "", false
+	}
+	return string(value[:end]), true
+}
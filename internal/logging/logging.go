@@ -1,6 +1,7 @@
 package logging
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"runtime/debug"
@@ -15,16 +16,80 @@ import (
 
 var once sync.Once
 
+// mu guards `log`, which Configure replaces
+var mu sync.RWMutex
+
 var log zerolog.Logger
 
+// Config configures the logging of the process
+type Config struct {
+	// Level is the name of the log level, e.g. `debug`. Defaults to `info`, or the level in `LOG_LEVEL`.
+	Level string
+	// Levels overrides the level for subsystems, by the value of the `unit` or `method` field of their
+	// loggers, e.g. `{"WsConnections": "debug"}`. The `method` takes precedence over the `unit`.
+	Levels map[string]string
+	// Format is either `json` (the default) or `console` for humans
+	Format string
+	// Outputs are the destinations of the logs: `stdout`, `stderr` (the default), `file` or `syslog`
+	Outputs []string
+	// Caller adds the file and line of the logging code to the logs
+	Caller bool
+	File   FileConfig
+	Syslog SyslogConfig
+}
+
+// FileConfig configures the `file` output, which is rotated when it reaches its maximum size
+type FileConfig struct {
+	// Path defaults to `websocket-gateway.log`
+	Path string
+	// MaxSizeMB is the size in megabytes at which the file is rotated. Defaults to 5.
+	MaxSizeMB int
+	// MaxBackups is the number of rotated files kept. Defaults to 10.
+	MaxBackups int
+	// MaxAgeDays is the number of days the rotated files are kept. Defaults to 14.
+	MaxAgeDays int
+	// Uncompressed keeps the rotated files uncompressed
+	Uncompressed bool
+}
+
+// SyslogConfig configures the `syslog` output
+type SyslogConfig struct {
+	// Network and Address are those of the syslog daemon, e.g. `udp` and `logs.example.com:514`.
+	// Default to the local daemon, which is journald on systemd hosts.
+	Network string
+	Address string
+	// Tag defaults to `websocket-gateway`
+	Tag string
+}
+
+const (
+	JSONFormat    = "json"
+	ConsoleFormat = "console"
+)
+
+const (
+	StdoutOutput = "stdout"
+	StderrOutput = "stderr"
+	FileOutput   = "file"
+	SyslogOutput = "syslog"
+)
+
+const (
+	defaultLogFile       = "websocket-gateway.log"
+	defaultLogMaxSizeMB  = 5
+	defaultLogMaxBackups = 10
+	defaultLogMaxAgeDays = 14
+	defaultSyslogTag     = "websocket-gateway"
+)
+
 func Get() zerolog.Logger {
 	once.Do(func() {
 		zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 		zerolog.TimeFieldFormat = time.RFC3339Nano
 
-		logLevel, err := strconv.Atoi(os.Getenv("LOG_LEVEL"))
+		logLevel, err := ParseLevel(os.Getenv("LOG_LEVEL"))
 		if err != nil {
-			logLevel = int(zerolog.InfoLevel) // default to INFO
+			logLevel = zerolog.InfoLevel // default to INFO
 		}
 
 		var output io.Writer = zerolog.ConsoleWriter{
@@ -38,42 +103,125 @@ func Get() zerolog.Logger {
 
 		if !isDevelopmentEnv() {
 			fileLogger := &lumberjack.Logger{
-				Filename:   "websocket-gateway.log",
-				MaxSize:    5,
-				MaxBackups: 10,
-				MaxAge:     14,
+				Filename:   defaultLogFile,
+				MaxSize:    defaultLogMaxSizeMB,
+				MaxBackups: defaultLogMaxBackups,
+				MaxAge:     defaultLogMaxAgeDays,
 				Compress:   true,
 			}
 
 			output = zerolog.MultiLevelWriter(os.Stderr, fileLogger)
 		}
 
-		var gitRevision string
+		SetLevel(logLevel)
+		log = newLogger(output, isDevelopmentEnv())
+	})
+
+	mu.RLock()
+	defer mu.RUnlock()
+	return log
+}
+
+// Configure replaces the logger returned by Get. The loggers derived from the previous one keep logging as before.
+func Configure(conf Config) error {
+	Get()
+
+	level := Level()
+	if conf.Level != "" {
+		var levelErr error
+		if level, levelErr = ParseLevel(conf.Level); levelErr != nil {
+			return levelErr
+		}
+	}
+	subsystemLevels, levelsErr := parseSubsystemLevels(conf.Levels)
+	if levelsErr != nil {
+		return levelsErr
+	}
+	output, outputErr := newOutput(conf)
+	if outputErr != nil {
+		return outputErr
+	}
+
+	mu.Lock()
+	log = newLogger(output, conf.Caller)
+	mu.Unlock()
+
+	SetLevel(level)
+	SetSubsystemLevels(subsystemLevels)
+	return nil
+}
 
-		buildInfo, ok := debug.ReadBuildInfo()
-		if ok {
-			for _, v := range buildInfo.Settings {
-				if v.Key == "vcs.revision" {
-					gitRevision = v.Value
-					break
-				}
+func newLogger(output io.Writer, caller bool) zerolog.Logger {
+	var gitRevision, goVersion string
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if ok {
+		goVersion = buildInfo.GoVersion
+		for _, v := range buildInfo.Settings {
+			if v.Key == "vcs.revision" {
+				gitRevision = v.Value
+				break
 			}
 		}
+	}
+
+	logContext := zerolog.New(&subsystemLevelWriter{out: zerolog.MultiLevelWriter(output)}).
+		With().
+		Timestamp().
+		Str("git_revision", gitRevision).
+		Str("go_version", goVersion)
+	if caller {
+		logContext = logContext.Caller()
+	}
+	return logContext.Logger()
+}
 
-		logContext := zerolog.New(output).
-			Level(zerolog.Level(logLevel)).
-			With().
-			Timestamp().
-			Str("git_revision", gitRevision).
-			Str("go_version", buildInfo.GoVersion)
-		if isDevelopmentEnv() {
-			logContext = logContext.Caller()
+// Validate reports the problems of the configuration
+func (c Config) Validate() error {
+	if c.Level != "" {
+		if _, levelErr := ParseLevel(c.Level); levelErr != nil {
+			return levelErr
 		}
+	}
+	if _, levelsErr := parseSubsystemLevels(c.Levels); levelsErr != nil {
+		return levelsErr
+	}
+	switch c.Format {
+	case "", JSONFormat, ConsoleFormat:
+	default:
+		return fmt.Errorf("unknown log format: %s", c.Format)
+	}
+	for _, output := range c.Outputs {
+		switch output {
+		case StdoutOutput, StderrOutput, FileOutput, SyslogOutput:
+		default:
+			return fmt.Errorf("unknown log output: %s", output)
+		}
+	}
+	return nil
+}
 
-		log = logContext.Logger()
-	})
+// ParseLevel parses the name of a log level, e.g. `debug`, or, for compatibility, its number
+func ParseLevel(name string) (zerolog.Level, error) {
+	if name == "" {
+		return zerolog.NoLevel, fmt.Errorf("empty log level")
+	}
+	if number, numberErr := strconv.Atoi(name); numberErr == nil {
+		return zerolog.Level(number), nil
+	}
+	return zerolog.ParseLevel(name)
+}
 
-	return log
+func parseSubsystemLevels(levelNames map[string]string) (map[string]zerolog.Level, error) {
+	levels := make(map[string]zerolog.Level, len(levelNames))
+	for subsystem, name := range levelNames {
+		level, levelErr := ParseLevel(name)
+		if levelErr != nil {
+			return nil, fmt.Errorf("invalid level for %s: %w", subsystem, levelErr)
+		}
+		levels[subsystem] = level
+	}
+	return levels, nil
 }
 
 const (
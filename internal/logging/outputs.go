@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// newOutput creates the writer of the configured outputs in the configured format
+func newOutput(conf Config) (io.Writer, error) {
+	if validationErr := conf.Validate(); validationErr != nil {
+		return nil, validationErr
+	}
+
+	outputs := conf.Outputs
+	if len(outputs) == 0 {
+		outputs = []string{StderrOutput}
+	}
+
+	writers := make([]io.Writer, 0, len(outputs))
+	for _, output := range outputs {
+		var writer io.Writer
+		switch output {
+		case StdoutOutput:
+			writer = os.Stdout
+		case StderrOutput:
+			writer = os.Stderr
+		case FileOutput:
+			writer = newFileOutput(conf.File)
+		case SyslogOutput:
+			syslogWriter, syslogErr := newSyslogOutput(conf.Syslog)
+			if syslogErr != nil {
+				return nil, syslogErr
+			}
+			writer = syslogWriter
+		}
+
+		if conf.Format == ConsoleFormat {
+			writer = zerolog.ConsoleWriter{
+				Out:        writer,
+				TimeFormat: time.RFC3339,
+				NoColor:    output != StdoutOutput && output != StderrOutput,
+			}
+		}
+		writers = append(writers, writer)
+	}
+	return zerolog.MultiLevelWriter(writers...), nil
+}
+
+// NewWriter creates the writer of the `outputs` for streams separate from the logs, e.g. the audit log.
+// The events are written as JSON lines.
+func NewWriter(outputs []string, file FileConfig, syslog SyslogConfig) (io.Writer, error) {
+	return newOutput(Config{Outputs: outputs, File: file, Syslog: syslog})
+}
+
+func newFileOutput(conf FileConfig) io.Writer {
+	fileLogger := &lumberjack.Logger{
+		Filename:   conf.Path,
+		MaxSize:    conf.MaxSizeMB,
+		MaxBackups: conf.MaxBackups,
+		MaxAge:     conf.MaxAgeDays,
+		Compress:   !conf.Uncompressed,
+	}
+	if fileLogger.Filename == "" {
+		fileLogger.Filename = defaultLogFile
+	}
+	if fileLogger.MaxSize == 0 {
+		fileLogger.MaxSize = defaultLogMaxSizeMB
+	}
+	if fileLogger.MaxBackups == 0 {
+		fileLogger.MaxBackups = defaultLogMaxBackups
+	}
+	if fileLogger.MaxAge == 0 {
+		fileLogger.MaxAge = defaultLogMaxAgeDays
+	}
+	return fileLogger
+}
@@ -0,0 +1,23 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"io"
+	"log/syslog"
+
+	"github.com/rs/zerolog"
+)
+
+// newSyslogOutput connects to the syslog daemon, which gets the events with their level as severity
+func newSyslogOutput(conf SyslogConfig) (io.Writer, error) {
+	tag := conf.Tag
+	if tag == "" {
+		tag = defaultSyslogTag
+	}
+	writer, dialErr := syslog.Dial(conf.Network, conf.Address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if dialErr != nil {
+		return nil, dialErr
+	}
+	return zerolog.SyslogLevelWriter(writer), nil
+}
@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package logging
+
+import (
+	"errors"
+	"io"
+)
+
+func newSyslogOutput(conf SyslogConfig) (io.Writer, error) {
+	return nil, errors.New("the syslog output isn't supported on this platform")
+}
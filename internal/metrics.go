@@ -0,0 +1,126 @@
+package wsgw
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "wsgw"
+
+// The directions of the messages in the message metrics
+const (
+	inboundDirection  = "inbound"
+	outboundDirection = "outbound"
+)
+
+// The reasons of the dropped messages
+const (
+	tooSlowDropReason          = "too_slow"
+	encodeErrorDropReason      = "encode_error"
+	offlineQueueFullDropReason = "offline_queue_full"
+	// callbackQueueFullDropReason is that of the messages from the clients dropped
+	callbackQueueFullDropReason = "callback_queue_full"
+)
+
+type metrics struct {
+	registry *prometheus.Registry
+
+	callbackDuration *prometheus.HistogramVec
+	callbackFailures *prometheus.CounterVec
+
+	connections          *prometheus.GaugeVec
+	connects             *prometheus.CounterVec
+	disconnects          *prometheus.CounterVec
+	messages             *prometheus.CounterVec
+	messageBytes         *prometheus.CounterVec
+	pushDuration         *prometheus.HistogramVec
+	outboundQueueDepth   *prometheus.HistogramVec
+	droppedMessages      *prometheus.CounterVec
+	rateLimiterRejection *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		callbackDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "app_callback_duration_seconds",
+			Help:      "Duration of the callbacks to the applications by endpoint and response status",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"app", "endpoint", "status"}),
+		callbackFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "app_callback_failures_total",
+			Help:      "Callbacks relaying the messages of the clients, which weren't sent or weren't answered with 200",
+		}, []string{"app", "endpoint"}),
+		connections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "connections",
+			Help:      "Number of connections owned by the node, including those held for the disconnect grace period",
+		}, []string{"app"}),
+		connects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "connects_total",
+			Help:      "Connection requests by outcome",
+		}, []string{"app", "outcome"}),
+		disconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "disconnects_total",
+			Help:      "Connections gone by reason",
+		}, []string{"app", "reason"}),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "messages_total",
+			Help:      "Messages received from (inbound) and sent to (outbound) the clients",
+		}, []string{"app", "direction"}),
+		messageBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "message_bytes_total",
+			Help:      "Size of the messages received from (inbound) and sent to (outbound) the clients",
+		}, []string{"app", "direction"}),
+		pushDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "push_duration_seconds",
+			Help:      "Duration of the pushes to connections by response status",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"app", "status"}),
+		outboundQueueDepth: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "outbound_queue_depth",
+			Help:      "Number of messages waiting to be sent to a client when queueing another one",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+		}, []string{"app"}),
+		droppedMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "dropped_messages_total",
+			Help:      "Messages to and from the clients dropped by reason",
+		}, []string{"app", "reason"}),
+		rateLimiterRejection: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rate_limiter_rejections_total",
+			Help:      "Pushes rejected by the push rate limiter",
+		}, []string{"app"}),
+	}
+
+	m.registry.MustRegister(
+		m.callbackDuration,
+		m.callbackFailures,
+		m.connections,
+		m.connects,
+		m.disconnects,
+		m.messages,
+		m.messageBytes,
+		m.pushDuration,
+		m.outboundQueueDepth,
+		m.droppedMessages,
+		m.rateLimiterRejection,
+	)
+
+	return m
+}
+
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,204 @@
+package wsgw
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OfflineQueueConfig configures the queueing of the messages pushed to recently disconnected connections and users
+type OfflineQueueConfig struct {
+	// TTL is how long the connections and users are queued for after their disconnection and how long
+	// the messages are kept. 0 disables the queue.
+	TTL time.Duration
+	// MaxMessages is the number of messages queued per connection or user at most. Defaults to 100.
+	MaxMessages int
+	// Eviction is what happens to messages pushed to a full queue: `drop-oldest` (the default) evicts the
+	// oldest message queued, `reject` rejects the new message.
+	Eviction string
+}
+
+const (
+	DropOldestEviction = "drop-oldest"
+	RejectEviction     = "reject"
+)
+
+const defaultOfflineQueueMaxMessages = 100
+
+var (
+	errNotQueued        = errors.New("recipient not recently disconnected")
+	errOfflineQueueFull = errors.New("offline queue full")
+)
+
+// offlineKey identifies the queue of either a connection or a user
+type offlineKey struct {
+	connId connectionID
+	userID string
+}
+
+type queuedMessage struct {
+	msgType   string
+	data      string
+	expiresAt time.Time
+}
+
+// offlineRecipient is a recently disconnected connection or user. It is forgotten when its newest
+// message or, lacking messages, its disconnection is older than the TTL.
+type offlineRecipient struct {
+	messages []queuedMessage
+	expiry   *time.Timer
+}
+
+// offlineQueue keeps the messages pushed to recently disconnected connections and users until they
+// reconnect. A connection reconnects when its session is resumed, a user with any new connection.
+type offlineQueue struct {
+	ttl         time.Duration
+	maxMessages int
+	dropOldest  bool
+
+	mu         sync.Mutex
+	recipients map[offlineKey]*offlineRecipient
+}
+
+// newOfflineQueue returns nil if the queue is disabled
+func newOfflineQueue(conf OfflineQueueConfig) (*offlineQueue, error) {
+	if conf.TTL <= 0 {
+		return nil, nil
+	}
+
+	switch conf.Eviction {
+	case "", DropOldestEviction, RejectEviction:
+	default:
+		return nil, fmt.Errorf("unknown offline queue eviction policy: %s", conf.Eviction)
+	}
+
+	q := &offlineQueue{
+		recipients: make(map[offlineKey]*offlineRecipient),
+	}
+	q.reconfigure(conf)
+	return q, nil
+}
+
+// reconfigure changes the TTL and the limits of the queue. The new TTL applies to the recipients as they
+// disconnect or get messages from then on. It can't enable or disable the queue.
+func (q *offlineQueue) reconfigure(conf OfflineQueueConfig) {
+	if q == nil || conf.TTL <= 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.ttl = conf.TTL
+	q.maxMessages = conf.MaxMessages
+	if q.maxMessages <= 0 {
+		q.maxMessages = defaultOfflineQueueMaxMessages
+	}
+	q.dropOldest = conf.Eviction != RejectEviction
+}
+
+// disconnected starts queueing the messages for the connection, if `connId` is not empty, and its user
+func (q *offlineQueue) disconnected(connId connectionID, userID string) {
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if connId != "" {
+		q.keep(offlineKey{connId: connId})
+	}
+	if userID != "" {
+		q.keep(offlineKey{userID: userID})
+	}
+}
+
+// keep creates or prolongs the queue of the recipient. It is to be called with `mu` held.
+func (q *offlineQueue) keep(key offlineKey) *offlineRecipient {
+	recipient, ok := q.recipients[key]
+	if ok {
+		recipient.expiry.Reset(q.ttl)
+		return recipient
+	}
+
+	recipient = &offlineRecipient{}
+	recipient.expiry = time.AfterFunc(q.ttl, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if q.recipients[key] == recipient {
+			delete(q.recipients, key)
+		}
+	})
+	q.recipients[key] = recipient
+	return recipient
+}
+
+// put queues the message for the recipient. It returns errNotQueued if the recipient isn't recently disconnected.
+func (q *offlineQueue) put(key offlineKey, msgType string, data string) error {
+	if q == nil {
+		return errNotQueued
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.recipients[key]; !ok {
+		return errNotQueued
+	}
+	recipient := q.keep(key)
+
+	now := time.Now()
+	recipient.messages = unexpired(recipient.messages, now)
+	if len(recipient.messages) >= q.maxMessages {
+		if !q.dropOldest {
+			return errOfflineQueueFull
+		}
+		recipient.messages = recipient.messages[1:]
+	}
+	recipient.messages = append(recipient.messages, queuedMessage{
+		msgType:   msgType,
+		data:      data,
+		expiresAt: now.Add(q.ttl),
+	})
+	return nil
+}
+
+// take removes the queues of the connection and its user returning their unexpired messages,
+// those of the connection first
+func (q *offlineQueue) take(connId connectionID, userID string) []queuedMessage {
+	if q == nil {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	messages := q.remove(offlineKey{connId: connId})
+	if userID != "" {
+		messages = append(messages, q.remove(offlineKey{userID: userID})...)
+	}
+	return unexpired(messages, time.Now())
+}
+
+// remove is to be called with `mu` held
+func (q *offlineQueue) remove(key offlineKey) []queuedMessage {
+	recipient, ok := q.recipients[key]
+	if !ok {
+		return nil
+	}
+	recipient.expiry.Stop()
+	delete(q.recipients, key)
+	return recipient.messages
+}
+
+func unexpired(messages []queuedMessage, now time.Time) []queuedMessage {
+	result := messages[:0]
+	for _, msg := range messages {
+		if now.Before(msg.expiresAt) {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
@@ -0,0 +1,189 @@
+package wsgw
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"websocket-gateway/internal/logging"
+)
+
+// PayloadLoggingConfig configures the logging of the payloads of the messages received from and pushed to the clients
+type PayloadLoggingConfig struct {
+	// SampleRate is the fraction of the messages, whose payload is logged: 0 (the default) logs none, 1 logs all.
+	// The application can set the rate for single connections in the `X-WSGW-PAYLOAD-SAMPLE-RATE` header of its
+	// response to `POST /ws/connecting`, e.g. to debug the client of a particular user.
+	SampleRate float64
+	// RedactPaths are the dot-separated paths of the fields of JSON payloads, whose values are redacted,
+	// e.g. `user.password`. `*` matches any field or array element, e.g. `items.*.token`.
+	RedactPaths []string
+	// RedactPatterns are regular expressions, whose matches are redacted in the payloads, e.g. `Bearer [\w.~+/-]+`
+	RedactPatterns []string
+	// RedactHeaders are the headers redacted in the logged connection requests
+	// besides `Authorization`, `Proxy-Authorization` and `Cookie`
+	RedactHeaders []string
+}
+
+// PayloadSampleRateHeaderKey is the header the application can set the sample rate of the payload logging of
+// an accepted connection with in its response to `POST /ws/connecting`
+const PayloadSampleRateHeaderKey = "X-WSGW-PAYLOAD-SAMPLE-RATE"
+
+// alwaysRedactedHeaders carry credentials, so they are never logged
+var alwaysRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// payloadLogger decides which payloads are logged and redacts them
+type payloadLogger struct {
+	sampleRate     float64
+	redactPaths    [][]string
+	redactPatterns []*regexp.Regexp
+	redactHeaders  []string
+}
+
+func newPayloadLogger(conf PayloadLoggingConfig) (*payloadLogger, error) {
+	if validationErr := conf.validate(); validationErr != nil {
+		return nil, validationErr
+	}
+
+	p := &payloadLogger{sampleRate: conf.SampleRate}
+	for _, path := range conf.RedactPaths {
+		p.redactPaths = append(p.redactPaths, strings.Split(strings.TrimPrefix(path, "$."), "."))
+	}
+	for _, pattern := range conf.RedactPatterns {
+		p.redactPatterns = append(p.redactPatterns, regexp.MustCompile(pattern))
+	}
+	for _, name := range append(alwaysRedactedHeaders, conf.RedactHeaders...) {
+		p.redactHeaders = append(p.redactHeaders, http.CanonicalHeaderKey(name))
+	}
+	return p, nil
+}
+
+func (c PayloadLoggingConfig) validate() error {
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return fmt.Errorf("SampleRate: %v is not between 0 and 1", c.SampleRate)
+	}
+	for _, path := range c.RedactPaths {
+		if strings.TrimPrefix(path, "$.") == "" {
+			return fmt.Errorf("RedactPaths: empty path")
+		}
+	}
+	for _, pattern := range c.RedactPatterns {
+		if _, compileErr := regexp.Compile(pattern); compileErr != nil {
+			return fmt.Errorf("RedactPatterns: %w", compileErr)
+		}
+	}
+	return nil
+}
+
+// connectionSampleRate parses the sample rate the application set for a connection in its response header.
+// Missing or invalid rates fall back to the one of the application.
+func connectionSampleRate(header http.Header) (float64, bool) {
+	rate, parseErr := strconv.ParseFloat(header.Get(PayloadSampleRateHeaderKey), 64)
+	if parseErr != nil || rate < 0 || rate > 1 {
+		return 0, false
+	}
+	return rate, true
+}
+
+// rate returns the sample rate of the connection
+func (p *payloadLogger) rate(conn *connection) float64 {
+	if conn.payloadSampleRate != nil {
+		return *conn.payloadSampleRate
+	}
+	return p.sampleRate
+}
+
+// sampled decides whether the next payload of the connection is logged
+func (p *payloadLogger) sampled(conn *connection) bool {
+	rate := p.rate(conn)
+	return rate > 0 && (rate >= 1 || rand.Float64() < rate)
+}
+
+// redact redacts the configured JSON fields and patterns in the payload
+func (p *payloadLogger) redact(payload string) string {
+	if len(p.redactPaths) > 0 {
+		decoder := json.NewDecoder(strings.NewReader(payload))
+		decoder.UseNumber()
+		var value any
+		if decoder.Decode(&value) == nil && !decoder.More() {
+			for _, path := range p.redactPaths {
+				value = redactPath(value, path)
+			}
+			var encoded bytes.Buffer
+			encoder := json.NewEncoder(&encoded)
+			encoder.SetEscapeHTML(false)
+			if encoder.Encode(value) == nil {
+				payload = strings.TrimSuffix(encoded.String(), "\n")
+			}
+		}
+	}
+	for _, pattern := range p.redactPatterns {
+		payload = pattern.ReplaceAllLiteralString(payload, redactedSecret)
+	}
+	return payload
+}
+
+// redactPath redacts the values at `path` in the decoded JSON `value`
+func redactPath(value any, path []string) any {
+	if len(path) == 0 {
+		return redactedSecret
+	}
+	switch typed := value.(type) {
+	case map[string]any:
+		for key, field := range typed {
+			if path[0] == "*" || path[0] == key {
+				typed[key] = redactPath(field, path[1:])
+			}
+		}
+	case []any:
+		for i, element := range typed {
+			if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				typed[i] = redactPath(element, path[1:])
+			}
+		}
+	}
+	return value
+}
+
+// redactHeader returns a copy of the header with the credentials and the configured headers redacted
+func (p *payloadLogger) redactHeader(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range p.redactHeaders {
+		if _, present := header[name]; present {
+			header[name] = []string{redactedSecret}
+		}
+	}
+	return header
+}
+
+// logPayload logs the payload of a message received from or sent to the connection, if sampled
+func (wsconn *wsConnections) logPayload(conn *connection, direction string, msgID string, payload string) {
+	p := wsconn.payloads.Load()
+	if !p.sampled(conn) {
+		return
+	}
+	conn.logger.Info().
+		Str(logging.MethodLogger, "logPayload").
+		Str("direction", direction).
+		Str("message_id", msgID).
+		Int("size", len(payload)).
+		Str("payload", p.redact(payload)).
+		Msg("message payload")
+}
+
+// logConnectionRequest logs the header of the request, which opened the connection, if its payloads are logged
+func (wsconn *wsConnections) logConnectionRequest(conn *connection, header http.Header) {
+	p := wsconn.payloads.Load()
+	rate := p.rate(conn)
+	if rate == 0 {
+		return
+	}
+	conn.logger.Info().
+		Str(logging.MethodLogger, "logPayload").
+		Float64("sample_rate", rate).
+		Interface("header", p.redactHeader(header)).
+		Msg("connection request")
+}
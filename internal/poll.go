@@ -0,0 +1,360 @@
+package wsgw
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"nhooyr.io/websocket"
+)
+
+// LongPollingConfig configures the long-polling transport
+type LongPollingConfig struct {
+	// Wait is how long polls are held while there are no messages for the client. Defaults to 25 seconds.
+	Wait time.Duration
+	// Timeout is how long a connection can go without requests of its client before it is considered lost.
+	// Defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+const (
+	defaultPollWait    = 25 * time.Second
+	defaultPollTimeout = 30 * time.Second
+	// pollQueueSize is the number of messages queued for the next poll, beyond which writes block
+	pollQueueSize = 64
+)
+
+var (
+	errPollSocketClosed = errors.New("long-polling connection closed")
+	errPollTimeout      = errors.New("long-polling connection timed out")
+	// errClosedByPollingClient is a normal closure, so that the connection is gone right away
+	errClosedByPollingClient = websocket.CloseError{Code: websocket.StatusNormalClosure, Reason: "closed by client"}
+)
+
+// pollResponse is the body of the responses to the polls. The client acknowledges the messages by passing
+// their cursor to the next poll.
+type pollResponse struct {
+	Messages []string `json:"messages"`
+	Cursor   uint64   `json:"cursor"`
+}
+
+// pollCursorQueryParam is the query parameter of the polls acknowledging the messages up to the cursor
+const pollCursorQueryParam = "cursor"
+
+// connectionResponse is the body of the response opening a long-polling connection
+type connectionResponse struct {
+	ConnectionID string `json:"connectionId"`
+	Token        string `json:"token"`
+	ResumeToken  string `json:"resumeToken,omitempty"`
+}
+
+// pollTransport binds the connections to sessions, which the clients poll for the messages sent to them
+// and post their messages to. Connections not polled for a while are lost.
+type pollTransport struct {
+	wait    time.Duration
+	timeout time.Duration
+
+	mu      sync.Mutex
+	sockets map[connectionID]*pollSocket
+}
+
+func newPollTransport(conf LongPollingConfig) *pollTransport {
+	t := &pollTransport{
+		wait:    conf.Wait,
+		timeout: conf.Timeout,
+		sockets: make(map[connectionID]*pollSocket),
+	}
+	if t.wait == 0 {
+		t.wait = defaultPollWait
+	}
+	if t.timeout == 0 {
+		t.timeout = defaultPollTimeout
+	}
+	return t
+}
+
+func (t *pollTransport) name() string {
+	return "long-polling"
+}
+
+func (t *pollTransport) detached() bool {
+	return true
+}
+
+func (t *pollTransport) accept(g *gin.Context, app *application, conn *connection) (wsIO, func(), error) {
+	if !allowCORS(g, app.settings.Load().originPatterns) {
+		g.AbortWithStatus(http.StatusForbidden)
+		return nil, nil, errOriginNotAllowed
+	}
+
+	socket := &pollSocket{
+		token:    rand.Text(),
+		timeout:  t.timeout,
+		outbound: make(chan string, pollQueueSize),
+		upstream: make(chan string),
+		closed:   make(chan struct{}),
+	}
+	socket.expiry = time.AfterFunc(t.timeout, func() { socket.closeWith(errPollTimeout) })
+
+	t.mu.Lock()
+	t.sockets[conn.id] = socket
+	t.mu.Unlock()
+
+	g.Header(ConnectionIDHeaderKey, string(conn.id))
+	g.Header(ConnectionTokenHeaderKey, socket.token)
+	g.JSON(http.StatusOK, connectionResponse{
+		ConnectionID: string(conn.id),
+		Token:        socket.token,
+		ResumeToken:  conn.resumeToken,
+	})
+
+	return socket, func() {
+		t.mu.Lock()
+		if t.sockets[conn.id] == socket {
+			delete(t.sockets, conn.id)
+		}
+		t.mu.Unlock()
+		socket.closeWith(errPollSocketClosed)
+	}, nil
+}
+
+// authorizedSocket returns the socket of the connection addressed by the request, if the request bears its token.
+// Otherwise, it aborts the request.
+func (t *pollTransport) authorizedSocket(g *gin.Context, connIdPathParamName string, logger zerolog.Logger) *pollSocket {
+	if !allowCORS(g, appFromContext(g).settings.Load().originPatterns) {
+		g.AbortWithStatus(http.StatusForbidden)
+		return nil
+	}
+
+	t.mu.Lock()
+	socket := t.sockets[connectionID(g.Param(connIdPathParamName))]
+	t.mu.Unlock()
+	if socket == nil {
+		logger.Info().Msg("long-polling connection doesn't exist")
+		g.AbortWithStatus(http.StatusNotFound)
+		return nil
+	}
+	if !hasConnectionToken(g, socket.token) {
+		logger.Info().Msg("invalid connection token")
+		g.AbortWithStatus(http.StatusForbidden)
+		return nil
+	}
+	return socket
+}
+
+// pollHandler answers with the messages queued for the connection, waiting for some if there are none
+func (t *pollTransport) pollHandler(connIdPathParamName string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("app", appFromContext(g).name).Str("connection_id", g.Param(connIdPathParamName)).Logger()
+		socket := t.authorizedSocket(g, connIdPathParamName, logger)
+		if socket == nil {
+			return
+		}
+
+		var acknowledged *uint64
+		if rawCursor, ok := g.GetQuery(pollCursorQueryParam); ok {
+			cursor, parseErr := strconv.ParseUint(rawCursor, 10, 64)
+			if parseErr != nil {
+				logger.Info().Err(parseErr).Msg("invalid cursor")
+				g.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+			acknowledged = &cursor
+		}
+
+		messages, cursor, pollErr := socket.poll(g.Request.Context(), t.wait, acknowledged)
+		if pollErr != nil {
+			logger.Debug().Err(pollErr).Msg("poll failed")
+			g.AbortWithStatus(http.StatusGone)
+			return
+		}
+		g.JSON(http.StatusOK, pollResponse{Messages: messages, Cursor: cursor})
+	}
+}
+
+// upstreamHandler relays the messages the clients post to their connection
+func (t *pollTransport) upstreamHandler(connIdPathParamName string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("app", appFromContext(g).name).Str("connection_id", g.Param(connIdPathParamName)).Logger()
+		socket := t.authorizedSocket(g, connIdPathParamName, logger)
+		if socket == nil {
+			return
+		}
+
+		body, readErr := io.ReadAll(http.MaxBytesReader(g.Writer, g.Request.Body, maxMessageSize))
+		if readErr != nil {
+			logger.Info().Err(readErr).Msg("failed to read message")
+			g.AbortWithStatus(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		if deliverErr := socket.deliver(g.Request.Context(), string(body)); deliverErr != nil {
+			logger.Info().Err(deliverErr).Msg("failed to relay message")
+			g.AbortWithStatus(http.StatusGone)
+			return
+		}
+		g.Status(http.StatusNoContent)
+	}
+}
+
+// closeHandler closes the connection on behalf of its client
+func (t *pollTransport) closeHandler(connIdPathParamName string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("app", appFromContext(g).name).Str("connection_id", g.Param(connIdPathParamName)).Logger()
+		socket := t.authorizedSocket(g, connIdPathParamName, logger)
+		if socket == nil {
+			return
+		}
+
+		socket.closeWith(errClosedByPollingClient)
+		g.Status(http.StatusNoContent)
+	}
+}
+
+// pollSocket queues the messages for the client of a long-polling connection until it polls for them
+type pollSocket struct {
+	token   string
+	timeout time.Duration
+
+	outbound chan string
+	upstream chan string
+
+	// mu guards the counting of the requests in progress, while which the connection doesn't expire
+	mu       sync.Mutex
+	requests int
+	expiry   *time.Timer
+
+	// pollMu serializes the polls. The last messages polled are kept as unacked until a poll
+	// acknowledges their cursor, so that those of a lost response are polled again.
+	pollMu  sync.Mutex
+	unacked []string
+	cursor  uint64
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (s *pollSocket) Read(ctx context.Context) (string, error) {
+	select {
+	case msg := <-s.upstream:
+		return msg, nil
+	case <-s.closed:
+		return "", s.closeErr
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (s *pollSocket) Write(ctx context.Context, msg string) error {
+	select {
+	case s.outbound <- msg:
+		return nil
+	case <-s.closed:
+		return s.closeErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the socket of a connection too slow to keep up with the messages
+func (s *pollSocket) Close() error {
+	s.closeWith(errPollSocketClosed)
+	return nil
+}
+
+// closeWith closes the socket, so that the connection is lost with `err`
+func (s *pollSocket) closeWith(err error) {
+	s.closeOnce.Do(func() {
+		s.closeErr = err
+		s.expiry.Stop()
+		close(s.closed)
+	})
+}
+
+// beginRequest keeps the connection from expiring until the request of the client ends
+func (s *pollSocket) beginRequest() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	s.expiry.Stop()
+}
+
+func (s *pollSocket) endRequest() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests--
+	if s.requests == 0 {
+		select {
+		case <-s.closed:
+		default:
+			s.expiry.Reset(s.timeout)
+		}
+	}
+}
+
+// poll returns the messages not acknowledged yet along with their cursor. The last messages polled are
+// acknowledged if `acknowledged` is their cursor, or is nil for clients not acknowledging messages.
+// Otherwise, they are returned again. Once acknowledged, the queued messages are taken, waiting up to
+// `wait` for one if there are none.
+func (s *pollSocket) poll(ctx context.Context, wait time.Duration, acknowledged *uint64) ([]string, uint64, error) {
+	s.beginRequest()
+	defer s.endRequest()
+	s.pollMu.Lock()
+	defer s.pollMu.Unlock()
+
+	if len(s.unacked) > 0 {
+		if acknowledged != nil && *acknowledged != s.cursor {
+			return s.unacked, s.cursor, nil
+		}
+		s.unacked = nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	messages := []string{}
+	select {
+	case msg := <-s.outbound:
+		messages = append(messages, msg)
+	case <-timer.C:
+		return messages, s.cursor, nil
+	case <-s.closed:
+		return nil, 0, s.closeErr
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+	for drained := false; !drained && len(messages) < pollQueueSize; {
+		select {
+		case msg := <-s.outbound:
+			messages = append(messages, msg)
+		default:
+			drained = true
+		}
+	}
+	s.cursor++
+	s.unacked = messages
+	return messages, s.cursor, nil
+}
+
+// deliver passes a message of the client to the reader of the socket
+func (s *pollSocket) deliver(ctx context.Context, msg string) error {
+	s.beginRequest()
+	defer s.endRequest()
+
+	select {
+	case s.upstream <- msg:
+		return nil
+	case <-s.closed:
+		return s.closeErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
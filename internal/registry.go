@@ -0,0 +1,221 @@
+package wsgw
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ConnectionEntry describes a connection in the connection registry
+type ConnectionEntry struct {
+	ID          string    `json:"id"`
+	App         string    `json:"app"`
+	Node        string    `json:"node"`
+	UserID      string    `json:"userId,omitempty"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+// ConnectionRegistry keeps track of which connections exist, which node owns them and
+// of the membership of the connections in users and topics
+type ConnectionRegistry interface {
+	Register(ctx context.Context, entry ConnectionEntry) error
+	// Deregister removes the connection along with its user and topic memberships
+	Deregister(ctx context.Context, app string, connId string) error
+	// Lookup returns ErrConnectionNotFound for unknown connections
+	Lookup(ctx context.Context, app string, connId string) (ConnectionEntry, error)
+	Connections(ctx context.Context, app string) ([]ConnectionEntry, error)
+	UserConnections(ctx context.Context, app string, userID string) ([]string, error)
+	JoinTopic(ctx context.Context, app string, topic string, connId string) error
+	LeaveTopic(ctx context.Context, app string, topic string, connId string) error
+	TopicMembers(ctx context.Context, app string, topic string) ([]string, error)
+	Close() error
+}
+
+// RegistryConfig selects and configures the connection registry
+type RegistryConfig struct {
+	// Type is either `memory` (the default) or `redis`
+	Type string
+	// The Redis* options apply to the `redis` registry
+	RedisAddress  string
+	RedisUsername string
+	RedisPassword string
+	RedisDB       int
+	// KeyPrefix is prepended to the keys of the `redis` registry. Defaults to `wsgw`.
+	KeyPrefix string
+	// NodeTTL is how long the connections of a node are kept in the `redis` registry after it stopped
+	// refreshing its heartbeat, before the other nodes remove them. Defaults to 30 seconds.
+	NodeTTL time.Duration
+}
+
+const (
+	MemoryRegistryType = "memory"
+	RedisRegistryType  = "redis"
+)
+
+var errUnknownRegistryType = errors.New("unknown registry type")
+
+func newConnectionRegistry(conf RegistryConfig, nodeID string, logger zerolog.Logger) (ConnectionRegistry, error) {
+	switch conf.Type {
+	case "", MemoryRegistryType:
+		return NewInMemoryRegistry(), nil
+	case RedisRegistryType:
+		return newRedisRegistryFromConfig(conf, nodeID, logger), nil
+	default:
+		return nil, errUnknownRegistryType
+	}
+}
+
+type appConnectionKey struct {
+	app    string
+	connId string
+}
+
+type appMembershipKey struct {
+	app  string
+	name string
+}
+
+// inMemoryRegistry is the process-local default registry
+type inMemoryRegistry struct {
+	mu      sync.Mutex
+	entries map[appConnectionKey]ConnectionEntry
+	users   map[appMembershipKey]map[string]struct{}
+	topics  map[appMembershipKey]map[string]struct{}
+	// connTopics is the reverse index of `topics` for cleaning up on deregistration
+	connTopics map[appConnectionKey]map[string]struct{}
+}
+
+func NewInMemoryRegistry() ConnectionRegistry {
+	return &inMemoryRegistry{
+		entries:    make(map[appConnectionKey]ConnectionEntry),
+		users:      make(map[appMembershipKey]map[string]struct{}),
+		topics:     make(map[appMembershipKey]map[string]struct{}),
+		connTopics: make(map[appConnectionKey]map[string]struct{}),
+	}
+}
+
+func (r *inMemoryRegistry) Register(ctx context.Context, entry ConnectionEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[appConnectionKey{entry.App, entry.ID}] = entry
+	if entry.UserID != "" {
+		addMember(r.users, appMembershipKey{entry.App, entry.UserID}, entry.ID)
+	}
+	return nil
+}
+
+func (r *inMemoryRegistry) Deregister(ctx context.Context, app string, connId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := appConnectionKey{app, connId}
+	entry, ok := r.entries[key]
+	if !ok {
+		return nil
+	}
+	delete(r.entries, key)
+	if entry.UserID != "" {
+		removeMember(r.users, appMembershipKey{app, entry.UserID}, connId)
+	}
+	for topic := range r.connTopics[key] {
+		removeMember(r.topics, appMembershipKey{app, topic}, connId)
+	}
+	delete(r.connTopics, key)
+	return nil
+}
+
+func (r *inMemoryRegistry) Lookup(ctx context.Context, app string, connId string) (ConnectionEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[appConnectionKey{app, connId}]
+	if !ok {
+		return ConnectionEntry{}, ErrConnectionNotFound
+	}
+	return entry, nil
+}
+
+func (r *inMemoryRegistry) Connections(ctx context.Context, app string) ([]ConnectionEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := []ConnectionEntry{}
+	for key, entry := range r.entries {
+		if key.app == app {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+func (r *inMemoryRegistry) UserConnections(ctx context.Context, app string, userID string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return members(r.users, appMembershipKey{app, userID}), nil
+}
+
+func (r *inMemoryRegistry) JoinTopic(ctx context.Context, app string, topic string, connId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := appConnectionKey{app, connId}
+	if _, ok := r.entries[key]; !ok {
+		return ErrConnectionNotFound
+	}
+	addMember(r.topics, appMembershipKey{app, topic}, connId)
+	if r.connTopics[key] == nil {
+		r.connTopics[key] = make(map[string]struct{})
+	}
+	r.connTopics[key][topic] = struct{}{}
+	return nil
+}
+
+func (r *inMemoryRegistry) LeaveTopic(ctx context.Context, app string, topic string, connId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removeMember(r.topics, appMembershipKey{app, topic}, connId)
+	delete(r.connTopics[appConnectionKey{app, connId}], topic)
+	return nil
+}
+
+func (r *inMemoryRegistry) TopicMembers(ctx context.Context, app string, topic string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return members(r.topics, appMembershipKey{app, topic}), nil
+}
+
+func (r *inMemoryRegistry) Close() error {
+	return nil
+}
+
+func addMember(memberships map[appMembershipKey]map[string]struct{}, key appMembershipKey, connId string) {
+	if memberships[key] == nil {
+		memberships[key] = make(map[string]struct{})
+	}
+	memberships[key][connId] = struct{}{}
+}
+
+func removeMember(memberships map[appMembershipKey]map[string]struct{}, key appMembershipKey, connId string) {
+	delete(memberships[key], connId)
+	if len(memberships[key]) == 0 {
+		delete(memberships, key)
+	}
+}
+
+func members(memberships map[appMembershipKey]map[string]struct{}, key appMembershipKey) []string {
+	connIds := make([]string, 0, len(memberships[key]))
+	for connId := range memberships[key] {
+		connIds = append(connIds, connId)
+	}
+	sort.Strings(connIds)
+	return connIds
+}
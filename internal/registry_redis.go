@@ -0,0 +1,355 @@
+package wsgw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"websocket-gateway/internal/logging"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+// redisRegistry keeps the registry in Redis, so that it is shared by the nodes of the cluster
+// and can be queried by the application backends directly. The keys are:
+//
+//	${prefix}:${app}:conns                    set of the IDs of the connections of the application
+//	${prefix}:${app}:conn:${connId}           hash with the fields `node`, `user_id` and `connected_at` (RFC3339)
+//	${prefix}:${app}:conn:${connId}:topics    set of the topics the connection is a member of
+//	${prefix}:${app}:user:${userId}           set of the IDs of the connections of the user
+//	${prefix}:${app}:topic:${topic}           set of the IDs of the connections in the topic
+//	${prefix}:nodes                           set of the IDs of the nodes with connections
+//	${prefix}:node:${nodeId}:conns            set of the connections of the node as `${app}:${connId}`
+//	${prefix}:node:${nodeId}:alive            heartbeat of the node, expiring after the node TTL
+//
+// The nodes refresh their heartbeat while alive and remove the connections of the nodes, whose heartbeat
+// expired, as those nodes couldn't deregister them. A starting node removes those left by its previous run,
+// which may not have lapsed yet.
+type redisRegistry struct {
+	client    redis.UniversalClient
+	keyPrefix string
+
+	stopHeartbeat chan struct{}
+	heartbeatDone chan struct{}
+}
+
+const (
+	defaultRegistryKeyPrefix = "wsgw"
+	defaultRegistryNodeTTL   = 30 * time.Second
+	// registryTransactionAttempts is the number of times a transaction is run before giving up on the
+	// concurrent changes of the keys it watches
+	registryTransactionAttempts = 10
+)
+
+var errRegistryConflict = errors.New("registry keys kept changing during the transaction")
+
+// NewRedisRegistry creates a registry stored in Redis with keys prefixed by `keyPrefix`
+func NewRedisRegistry(client redis.UniversalClient, keyPrefix string) ConnectionRegistry {
+	if keyPrefix == "" {
+		keyPrefix = defaultRegistryKeyPrefix
+	}
+	return &redisRegistry{
+		client:    client,
+		keyPrefix: keyPrefix,
+	}
+}
+
+func newRedisRegistryFromConfig(conf RegistryConfig, nodeID string, logger zerolog.Logger) ConnectionRegistry {
+	client := redis.NewClient(&redis.Options{
+		Addr:     conf.RedisAddress,
+		Username: conf.RedisUsername,
+		Password: conf.RedisPassword,
+		DB:       conf.RedisDB,
+	})
+	r := NewRedisRegistry(client, conf.KeyPrefix).(*redisRegistry)
+	nodeTTL := conf.NodeTTL
+	if nodeTTL <= 0 {
+		nodeTTL = defaultRegistryNodeTTL
+	}
+	logger = logger.With().Str(logging.UnitLogger, "registry").Str("node_id", nodeID).Logger()
+	if err := r.removeNodeConnections(context.Background(), nodeID); err != nil {
+		logger.Warn().Err(err).Msg("failed to remove the connections of the previous run of the node")
+	}
+	r.stopHeartbeat = make(chan struct{})
+	r.heartbeatDone = make(chan struct{})
+	go r.heartbeat(nodeID, nodeTTL, logger)
+	return r
+}
+
+// heartbeat refreshes the heartbeat of the node every third of `nodeTTL` and removes the connections
+// of the nodes, whose heartbeat expired
+func (r *redisRegistry) heartbeat(nodeID string, nodeTTL time.Duration, logger zerolog.Logger) {
+	defer close(r.heartbeatDone)
+
+	ticker := time.NewTicker(nodeTTL / 3)
+	defer ticker.Stop()
+	for {
+		ctx := context.Background()
+		if err := r.client.Set(ctx, r.nodeAliveKey(nodeID), time.Now().UTC().Format(time.RFC3339Nano), nodeTTL).Err(); err != nil {
+			logger.Warn().Err(err).Msg("failed to refresh the heartbeat")
+		}
+		if err := r.removeLapsedNodes(ctx, nodeID); err != nil {
+			logger.Warn().Err(err).Msg("failed to remove the connections of the lapsed nodes")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.stopHeartbeat:
+			return
+		}
+	}
+}
+
+// removeLapsedNodes deregisters the connections of the nodes other than `nodeID`, whose heartbeat expired
+func (r *redisRegistry) removeLapsedNodes(ctx context.Context, nodeID string) error {
+	nodes, err := r.client.SMembers(ctx, r.nodesKey()).Result()
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if node == nodeID {
+			continue
+		}
+		alive, aliveErr := r.client.Exists(ctx, r.nodeAliveKey(node)).Result()
+		if aliveErr != nil {
+			return aliveErr
+		}
+		if alive > 0 {
+			continue
+		}
+		if removeErr := r.removeNodeConnections(ctx, node); removeErr != nil {
+			return removeErr
+		}
+		if forgetErr := r.forgetNode(ctx, node); forgetErr != nil {
+			return forgetErr
+		}
+	}
+	return nil
+}
+
+// forgetNode removes the node `nodeID` from the nodes unless it registered connections in the meantime,
+// which means that it is back
+func (r *redisRegistry) forgetNode(ctx context.Context, nodeID string) error {
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		remaining, err := tx.SCard(ctx, r.nodeConnectionsKey(nodeID)).Result()
+		if err != nil || remaining > 0 {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SRem(ctx, r.nodesKey(), nodeID)
+			return nil
+		})
+		return err
+	}, r.nodeConnectionsKey(nodeID))
+	if err == redis.TxFailedErr {
+		return nil
+	}
+	return err
+}
+
+// transaction runs `f` in a transaction watching `keys` and runs it again as long as the keys are changed
+// concurrently
+func (r *redisRegistry) transaction(ctx context.Context, f func(tx *redis.Tx) error, keys ...string) error {
+	for range registryTransactionAttempts {
+		err := r.client.Watch(ctx, f, keys...)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return errRegistryConflict
+}
+
+// removeNodeConnections deregisters the connections registered by the node `nodeID`
+func (r *redisRegistry) removeNodeConnections(ctx context.Context, nodeID string) error {
+	conns, err := r.client.SMembers(ctx, r.nodeConnectionsKey(nodeID)).Result()
+	if err != nil {
+		return err
+	}
+	for _, conn := range conns {
+		separator := strings.LastIndex(conn, ":")
+		if separator < 0 {
+			continue
+		}
+		if deregisterErr := r.Deregister(ctx, conn[:separator], conn[separator+1:]); deregisterErr != nil {
+			return deregisterErr
+		}
+		r.client.SRem(ctx, r.nodeConnectionsKey(nodeID), conn)
+	}
+	return nil
+}
+
+func (r *redisRegistry) connectionsKey(app string) string {
+	return fmt.Sprintf("%s:%s:conns", r.keyPrefix, app)
+}
+
+func (r *redisRegistry) connectionKey(app string, connId string) string {
+	return fmt.Sprintf("%s:%s:conn:%s", r.keyPrefix, app, connId)
+}
+
+func (r *redisRegistry) connectionTopicsKey(app string, connId string) string {
+	return fmt.Sprintf("%s:%s:conn:%s:topics", r.keyPrefix, app, connId)
+}
+
+func (r *redisRegistry) userKey(app string, userID string) string {
+	return fmt.Sprintf("%s:%s:user:%s", r.keyPrefix, app, userID)
+}
+
+func (r *redisRegistry) topicKey(app string, topic string) string {
+	return fmt.Sprintf("%s:%s:topic:%s", r.keyPrefix, app, topic)
+}
+
+func (r *redisRegistry) nodesKey() string {
+	return fmt.Sprintf("%s:nodes", r.keyPrefix)
+}
+
+func (r *redisRegistry) nodeConnectionsKey(nodeID string) string {
+	return fmt.Sprintf("%s:node:%s:conns", r.keyPrefix, nodeID)
+}
+
+func (r *redisRegistry) nodeAliveKey(nodeID string) string {
+	return fmt.Sprintf("%s:node:%s:alive", r.keyPrefix, nodeID)
+}
+
+func (r *redisRegistry) Register(ctx context.Context, entry ConnectionEntry) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, r.connectionKey(entry.App, entry.ID),
+			"node", entry.Node,
+			"user_id", entry.UserID,
+			"connected_at", entry.ConnectedAt.Format(time.RFC3339Nano),
+		)
+		pipe.SAdd(ctx, r.connectionsKey(entry.App), entry.ID)
+		if entry.UserID != "" {
+			pipe.SAdd(ctx, r.userKey(entry.App, entry.UserID), entry.ID)
+		}
+		pipe.SAdd(ctx, r.nodeConnectionsKey(entry.Node), entry.App+":"+entry.ID)
+		pipe.SAdd(ctx, r.nodesKey(), entry.Node)
+		return nil
+	})
+	return err
+}
+
+// Deregister removes the connection along with its memberships. The topics joined concurrently are
+// removed as well, as joining changes the watched topics of the connection.
+func (r *redisRegistry) Deregister(ctx context.Context, app string, connId string) error {
+	return r.transaction(ctx, func(tx *redis.Tx) error {
+		fields, err := tx.HGetAll(ctx, r.connectionKey(app, connId)).Result()
+		if err != nil || len(fields) == 0 {
+			return err
+		}
+		topics, err := tx.SMembers(ctx, r.connectionTopicsKey(app, connId)).Result()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, r.connectionKey(app, connId), r.connectionTopicsKey(app, connId))
+			pipe.SRem(ctx, r.connectionsKey(app), connId)
+			if userID := fields["user_id"]; userID != "" {
+				pipe.SRem(ctx, r.userKey(app, userID), connId)
+			}
+			pipe.SRem(ctx, r.nodeConnectionsKey(fields["node"]), app+":"+connId)
+			for _, topic := range topics {
+				pipe.SRem(ctx, r.topicKey(app, topic), connId)
+			}
+			return nil
+		})
+		return err
+	}, r.connectionKey(app, connId), r.connectionTopicsKey(app, connId))
+}
+
+func (r *redisRegistry) Lookup(ctx context.Context, app string, connId string) (ConnectionEntry, error) {
+	fields, err := r.client.HGetAll(ctx, r.connectionKey(app, connId)).Result()
+	if err != nil {
+		return ConnectionEntry{}, err
+	}
+	if len(fields) == 0 {
+		return ConnectionEntry{}, ErrConnectionNotFound
+	}
+
+	connectedAt, _ := time.Parse(time.RFC3339Nano, fields["connected_at"])
+	return ConnectionEntry{
+		ID:          connId,
+		App:         app,
+		Node:        fields["node"],
+		UserID:      fields["user_id"],
+		ConnectedAt: connectedAt,
+	}, nil
+}
+
+func (r *redisRegistry) Connections(ctx context.Context, app string) ([]ConnectionEntry, error) {
+	connIds, err := r.sortedMembers(ctx, r.connectionsKey(app))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ConnectionEntry, 0, len(connIds))
+	for _, connId := range connIds {
+		entry, lookupErr := r.Lookup(ctx, app, connId)
+		if lookupErr == ErrConnectionNotFound {
+			continue // deregistered in the meantime
+		}
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (r *redisRegistry) UserConnections(ctx context.Context, app string, userID string) ([]string, error) {
+	return r.sortedMembers(ctx, r.userKey(app, userID))
+}
+
+// JoinTopic adds the connection to the topic unless it is deregistered concurrently, which changes
+// the watched entry of the connection
+func (r *redisRegistry) JoinTopic(ctx context.Context, app string, topic string, connId string) error {
+	return r.transaction(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, r.connectionKey(app, connId)).Result()
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return ErrConnectionNotFound
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SAdd(ctx, r.topicKey(app, topic), connId)
+			pipe.SAdd(ctx, r.connectionTopicsKey(app, connId), topic)
+			return nil
+		})
+		return err
+	}, r.connectionKey(app, connId))
+}
+
+func (r *redisRegistry) LeaveTopic(ctx context.Context, app string, topic string, connId string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SRem(ctx, r.topicKey(app, topic), connId)
+		pipe.SRem(ctx, r.connectionTopicsKey(app, connId), topic)
+		return nil
+	})
+	return err
+}
+
+func (r *redisRegistry) TopicMembers(ctx context.Context, app string, topic string) ([]string, error) {
+	return r.sortedMembers(ctx, r.topicKey(app, topic))
+}
+
+func (r *redisRegistry) Close() error {
+	if r.stopHeartbeat != nil {
+		close(r.stopHeartbeat)
+		<-r.heartbeatDone
+	}
+	return r.client.Close()
+}
+
+func (r *redisRegistry) sortedMembers(ctx context.Context, key string) ([]string, error) {
+	connIds, err := r.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(connIds)
+	return connIds, nil
+}
@@ -0,0 +1,197 @@
+package wsgw
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	logging "websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+)
+
+// ReloadReport tells which settings a reload changed
+type ReloadReport struct {
+	// Applied are the changed settings, which took effect
+	Applied []string
+	// RequiresRestart are the changed settings, which only take effect once the gateway is restarted
+	RequiresRestart []string
+}
+
+// reloadableAppSettings are the application settings, which can be changed without restarting the gateway
+var reloadableAppSettings = map[string]bool{
+	"BaseUrl":             true,
+	"ConnectingPath":      true,
+	"DisconnectedPath":    true,
+	"MessageReceivedPath": true,
+	"OriginPatterns":      true,
+	"BackendAPIKeys":      true,
+	"MaxConnections":      true,
+	"MessageBufferSize":   true,
+	"PushRateLimit":       true,
+	"PushBurst":           true,
+	"OfflineQueue":        true,
+	"PayloadLogging":      true,
+}
+
+// appConfigSettings are the top-level settings, which are compared as part of the application configurations
+var appConfigSettings = map[string]bool{
+	"AppBaseUrl":          true,
+	"AppTransport":        true,
+	"LoadBalancerAddress": true,
+	"Apps":                true,
+}
+
+var errNotStarted = errors.New("the server is not started")
+
+// urlScheme returns the scheme of `rawUrl`, empty if it can't be parsed
+func urlScheme(rawUrl string) string {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	return parsed.Scheme
+}
+
+// currentConfig returns the configuration the server runs with
+func (s *Server) currentConfig() Config {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	return s.configuration
+}
+
+// Reload applies the reloadable settings of `conf` without disturbing the existing connections: the callback
+// URLs, origin patterns, backend API keys, connection limits, buffer sizes, push rate limits, the offline
+// queue limits and the log level. Invalid configurations are rejected as a whole, keeping the current one.
+func (s *Server) Reload(conf Config) (ReloadReport, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if s.apps == nil {
+		return ReloadReport{}, errNotStarted
+	}
+	if validationErr := conf.Validate(); validationErr != nil {
+		return ReloadReport{}, validationErr
+	}
+
+	current := s.currentConfig()
+	report := ReloadReport{}
+
+	// The application settings, which can't be reloaded, are kept as they are
+	reloaded := current
+	// The log level is only set when it changed, so that it stays as changed on the admin listener otherwise
+	levelChanged := conf.Logging.Level != "" && conf.Logging.Level != current.Logging.Level
+	if levelChanged {
+		reloaded.Logging.Level = conf.Logging.Level
+		report.Applied = append(report.Applied, "Logging.Level")
+	}
+	levelsChanged := (len(conf.Logging.Levels) > 0 || len(current.Logging.Levels) > 0) && !reflect.DeepEqual(conf.Logging.Levels, current.Logging.Levels)
+	if levelsChanged {
+		reloaded.Logging.Levels = conf.Logging.Levels
+		report.Applied = append(report.Applied, "Logging.Levels")
+	}
+	// The outputs and the format of the logs can't be changed at runtime
+	currentLogging, newLogging := current.Logging, conf.Logging
+	currentLogging.Level, currentLogging.Levels, newLogging.Level, newLogging.Levels = "", nil, "", nil
+	if !reflect.DeepEqual(currentLogging, newLogging) {
+		report.RequiresRestart = append(report.RequiresRestart, "Logging")
+	}
+
+	currentApps := map[string]AppConfig{}
+	for _, appConf := range current.appConfigs() {
+		currentApps[appConf.Name] = appConf
+	}
+	newApps := map[string]AppConfig{}
+	for _, appConf := range conf.appConfigs() {
+		newApps[appConf.Name] = appConf
+		if _, exists := currentApps[appConf.Name]; !exists {
+			report.RequiresRestart = append(report.RequiresRestart, fmt.Sprintf("Apps[%s]", appConf.Name))
+		}
+	}
+
+	reloadedApps := map[string]AppConfig{}
+	for _, name := range s.apps.names() {
+		currentApp := currentApps[name]
+		newApp, exists := newApps[name]
+		if !exists {
+			report.RequiresRestart = append(report.RequiresRestart, fmt.Sprintf("Apps[%s]", name))
+			reloadedApps[name] = currentApp
+			continue
+		}
+
+		reloadedApp := currentApp
+		currentValue, newValue, reloadedValue := reflect.ValueOf(currentApp), reflect.ValueOf(newApp), reflect.ValueOf(&reloadedApp).Elem()
+		for i := 0; i < currentValue.NumField(); i++ {
+			setting := currentValue.Type().Field(i).Name
+			if reflect.DeepEqual(currentValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+				continue
+			}
+			settingName := fmt.Sprintf("Apps[%s].%s", name, setting)
+			// The offline queue can't be enabled or disabled at runtime, nor can the scheme of the base URL be changed
+			// with HTTP/2, whose transport is set up for the scheme
+			if !reloadableAppSettings[setting] || (setting == "OfflineQueue" && (currentApp.OfflineQueue.TTL > 0) != (newApp.OfflineQueue.TTL > 0)) ||
+				(setting == "BaseUrl" && currentApp.Transport.EnableHTTP2 && urlScheme(currentApp.BaseUrl) != urlScheme(newApp.BaseUrl)) {
+				report.RequiresRestart = append(report.RequiresRestart, settingName)
+				continue
+			}
+			reloadedValue.Field(i).Set(newValue.Field(i))
+			report.Applied = append(report.Applied, settingName)
+		}
+		reloadedApps[name] = reloadedApp
+	}
+
+	currentValue, newValue := reflect.ValueOf(current), reflect.ValueOf(conf)
+	for i := 0; i < currentValue.NumField(); i++ {
+		setting := currentValue.Type().Field(i).Name
+		if appConfigSettings[setting] || setting == "Logging" {
+			continue
+		}
+		if !reflect.DeepEqual(currentValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			report.RequiresRestart = append(report.RequiresRestart, setting)
+		}
+	}
+
+	for name, appConf := range reloadedApps {
+		s.apps.byName[name].reload(appConf)
+	}
+	if level, levelErr := logging.ParseLevel(reloaded.Logging.Level); levelChanged && levelErr == nil {
+		logging.SetLevel(level)
+	}
+	if levelsChanged {
+		logging.SetSubsystemLevels(parsedSubsystemLevels(reloaded.Logging.Levels))
+	}
+
+	reloaded.Apps = reloadedAppConfigs(current, reloadedApps)
+	if current.AppBaseUrl != "" {
+		// The default application is defined by the top-level settings
+		reloaded.AppBaseUrl = reloadedApps[DefaultAppName].BaseUrl
+		reloaded.LoadBalancerAddress = reloadedApps[DefaultAppName].OriginPatterns[0]
+	}
+	s.configMu.Lock()
+	s.configuration = reloaded
+	s.configMu.Unlock()
+
+	s.logger.Info().Strs("applied", report.Applied).Msg("configuration reloaded")
+	if len(report.RequiresRestart) > 0 {
+		s.logger.Warn().Strs("requires_restart", report.RequiresRestart).Msg("changed settings take effect after a restart")
+	}
+	return report, nil
+}
+
+// parsedSubsystemLevels parses the validated subsystem levels
+func parsedSubsystemLevels(levelNames map[string]string) map[string]zerolog.Level {
+	levels := make(map[string]zerolog.Level, len(levelNames))
+	for subsystem, name := range levelNames {
+		levels[subsystem], _ = logging.ParseLevel(name)
+	}
+	return levels
+}
+
+// reloadedAppConfigs returns the `Config.Apps` of `current` with the reloaded application configurations
+func reloadedAppConfigs(current Config, reloadedApps map[string]AppConfig) []AppConfig {
+	apps := make([]AppConfig, len(current.Apps))
+	for i, appConf := range current.Apps {
+		apps[i] = reloadedApps[appConf.Name]
+	}
+	return apps
+}
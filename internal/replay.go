@@ -0,0 +1,147 @@
+package wsgw
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ResumeTokenHeaderKey is the header of the WS handshake response conveying the token the client
+// can resume its session with after a disconnection
+const ResumeTokenHeaderKey = "X-WSGW-RESUME-TOKEN"
+
+// ResumedHeaderKey marks the `POST /ws/connecting` requests of resumed sessions
+const ResumedHeaderKey = "X-WSGW-RESUMED"
+
+// The query parameters of `GET /connect` for resuming a session
+const (
+	resumeTokenQueryParam = "resume"
+	lastSeqQueryParam     = "lastSeq"
+)
+
+const sessionMessageType = "session"
+
+const defaultResumeWindow = 2 * time.Minute
+
+var errSessionNotFound = errors.New("session not found")
+
+// replayBuffer keeps the most recent messages sent over a connection
+type replayBuffer struct {
+	messages []outboundMessage
+	next     int
+	full     bool
+}
+
+func newReplayBuffer(size int) *replayBuffer {
+	return &replayBuffer{
+		messages: make([]outboundMessage, size),
+	}
+}
+
+func (b *replayBuffer) add(msg outboundMessage) {
+	b.messages[b.next] = msg
+	b.next = (b.next + 1) % len(b.messages)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// since returns the buffered messages with a sequence number greater than `seq` in order
+func (b *replayBuffer) since(seq uint64) []outboundMessage {
+	ordered := b.messages[:b.next]
+	if b.full {
+		ordered = append(append([]outboundMessage{}, b.messages[b.next:]...), b.messages[:b.next]...)
+	}
+
+	result := []outboundMessage{}
+	for _, msg := range ordered {
+		if msg.Seq > seq {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
+
+// retainedSession is what is kept of a connection after it was lost, so that the client can resume it
+type retainedSession struct {
+	token     string
+	connId    connectionID
+	lastSeq   uint64
+	history   *replayBuffer
+	expiresAt time.Time
+	expiry    *time.Timer
+}
+
+// newResumeToken creates a random token, which encodes the ID of the node retaining the session
+func newResumeToken(nodeID string) string {
+	random := make([]byte, 24)
+	_, _ = rand.Read(random)
+	token := base64.RawURLEncoding.EncodeToString(random)
+	if nodeID == "" {
+		return token
+	}
+	return token + nodeSeparator + nodeID
+}
+
+// resumeTokenNode returns the ID of the node retaining the session of the token
+func resumeTokenNode(token string) string {
+	_, node, _ := strings.Cut(token, nodeSeparator)
+	return node
+}
+
+func (wsconn *wsConnections) replayEnabled() bool {
+	return wsconn.replayBufferSize > 0
+}
+
+// retainSession keeps the history of the lost connection for the resume window
+func (wsconn *wsConnections) retainSession(conn *connection) {
+	conn.sendMu.Lock()
+	session := &retainedSession{
+		token:     conn.resumeToken,
+		connId:    conn.id,
+		lastSeq:   conn.lastSeq,
+		history:   conn.history,
+		expiresAt: time.Now().Add(wsconn.resumeWindow),
+	}
+	conn.sendMu.Unlock()
+
+	wsconn.storeSession(session)
+}
+
+func (wsconn *wsConnections) storeSession(session *retainedSession) {
+	wsconn.sessionsMu.Lock()
+	defer wsconn.sessionsMu.Unlock()
+
+	session.expiry = time.AfterFunc(time.Until(session.expiresAt), func() {
+		wsconn.sessionsMu.Lock()
+		defer wsconn.sessionsMu.Unlock()
+		if wsconn.sessions[session.token] == session {
+			delete(wsconn.sessions, session.token)
+		}
+	})
+	wsconn.sessions[session.token] = session
+}
+
+// claimSession takes the session retained for the token, so that no other connection can resume it
+func (wsconn *wsConnections) claimSession(token string) (*retainedSession, error) {
+	wsconn.sessionsMu.Lock()
+	defer wsconn.sessionsMu.Unlock()
+
+	session, ok := wsconn.sessions[token]
+	if !ok {
+		return nil, errSessionNotFound
+	}
+	session.expiry.Stop()
+	delete(wsconn.sessions, token)
+	return session, nil
+}
+
+// releaseSession puts back a claimed session, which could not be resumed after all
+func (wsconn *wsConnections) releaseSession(session *retainedSession) {
+	if time.Now().After(session.expiresAt) {
+		return
+	}
+	wsconn.storeSession(session)
+}
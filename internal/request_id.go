@@ -0,0 +1,49 @@
+package wsgw
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rs/xid"
+)
+
+// RequestIDHeaderKey carries the ID of a request. The ID of an incoming request, whether sent by the
+// caller or generated by the gateway, is sent back in the response and relayed to the callbacks the
+// request causes.
+const RequestIDHeaderKey = "X-Request-ID"
+
+// maxRequestIDLength limits the length of the request IDs accepted from the callers
+const maxRequestIDLength = 128
+
+type requestIDContextKey struct{}
+
+func withRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// requestIDFromContext returns the ID of the request the context belongs to, if any
+func requestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// requestID returns the ID sent by the caller, if it is valid, or a new one
+func requestID(header http.Header) string {
+	if requestID := header.Get(RequestIDHeaderKey); validRequestID(requestID) {
+		return requestID
+	}
+	return xid.New().String()
+}
+
+// validRequestID accepts the IDs of reasonable length made of printable ASCII characters
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < '!' || requestID[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -1,35 +1,67 @@
 package wsgw
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 	logging "websocket-gateway/internal/logging"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
 )
 
 type Config struct {
 	ServerHost          string
 	ServerPort          int
 	AppBaseUrl          string
+	AppTransport        AppTransportConfig
 	LoadBalancerAddress string // TODO: remove this
+	// Apps defines further applications served by the gateway besides the one at AppBaseUrl
+	Apps          []AppConfig
+	Cluster       ClusterConfig
+	Registry      RegistryConfig
+	ConnectionIDs ConnectionIDConfig
+	Tracing       TracingConfig
+	Health        HealthConfig
+	Admin         AdminConfig
+	Logging       logging.Config
+	Audit         AuditConfig
+	LongPolling   LongPollingConfig
+	GRPC          GRPCConfig
+	Broker        BrokerConfig
 }
 
 type Server struct {
 	Addr          string
 	listener      net.Listener
+	adminListener net.Listener
+	grpcServer    *grpc.Server
+	broker        *broker
 	configuration Config
-	logger        zerolog.Logger
+	// configMu guards `configuration` once the server is started, reloadMu serializes the reloads
+	configMu sync.Mutex
+	reloadMu sync.Mutex
+	logger   zerolog.Logger
+	metrics  *metrics
+	tracing  *tracing
+	health   *health
+	apps     *applications
+	registry ConnectionRegistry
 }
 
 func CreateServer(configuration Config, logging zerolog.Logger) *Server {
 	return &Server{
 		configuration: configuration,
 		logger:        logging,
+		metrics:       newMetrics(),
 	}
 }
 
@@ -65,7 +97,62 @@ func (s *Server) start(r http.Handler, ready func(port int, stop func())) {
 
 // SetupAndStart sets up and starts server.
 func (s *Server) SetupAndStart(ready func(port int, stop func())) {
-	r := createWsGwRequestHandler(s.configuration, s.logger)
+	if validationErr := s.configuration.Validate(); validationErr != nil {
+		panic(fmt.Sprintf("Invalid configuration: %v", validationErr))
+	}
+
+	cluster, clusterErr := newCluster(s.configuration.Cluster, s.logger)
+	if clusterErr != nil {
+		panic(fmt.Sprintf("Error while setting up the cluster: %v", clusterErr))
+	}
+
+	ids, idsErr := newConnectionIDs(s.configuration.ConnectionIDs, cluster.nodeID)
+	if idsErr != nil {
+		panic(fmt.Sprintf("Error while setting up the connection IDs: %v", idsErr))
+	}
+
+	registry, registryErr := newConnectionRegistry(s.configuration.Registry, cluster.nodeID, s.logger)
+	if registryErr != nil {
+		panic(fmt.Sprintf("Error while setting up the connection registry: %v", registryErr))
+	}
+	s.registry = registry
+
+	tracing, tracingErr := newTracing(s.configuration.Tracing)
+	if tracingErr != nil {
+		panic(fmt.Sprintf("Error while setting up tracing: %v", tracingErr))
+	}
+	s.tracing = tracing
+
+	audit, auditErr := newAuditLog(s.configuration.Audit)
+	if auditErr != nil {
+		panic(fmt.Sprintf("Error while setting up the audit log: %v", auditErr))
+	}
+
+	broker, brokerErr := newBroker(s.configuration.Broker, cluster.nodeID, s.logger)
+	if brokerErr != nil {
+		panic(fmt.Sprintf("Error while setting up the message broker: %v", brokerErr))
+	}
+	s.broker = broker
+
+	apps, appsErr := newApplications(s.configuration, cluster.nodeID, registry, s.metrics, tracing, audit, broker, s.logger)
+	if appsErr != nil {
+		panic(fmt.Sprintf("Error while setting up the applications: %v", appsErr))
+	}
+	if subscribeErr := broker.subscribe(apps, ids); subscribeErr != nil {
+		panic(fmt.Sprintf("Error while subscribing to the push commands: %v", subscribeErr))
+	}
+	s.apps = apps
+	s.health = newHealth(s.configuration.Health, apps)
+
+	if adminErr := s.startAdmin(); adminErr != nil {
+		panic(fmt.Sprintf("Error while setting up the admin listener: %v", adminErr))
+	}
+
+	if grpcErr := s.startGRPC(apps, cluster, ids); grpcErr != nil {
+		panic(fmt.Sprintf("Error while setting up the gRPC listener: %v", grpcErr))
+	}
+
+	r := createWsGwRequestHandler(apps, cluster, ids, s.metrics, s.health, newPollTransport(s.configuration.LongPolling))
 	s.start(r, ready)
 }
 
@@ -73,13 +160,46 @@ func (s *Server) SetupAndStart(ready func(port int, stop func())) {
 // or by a service-mesh provider)
 // In the unlikely case of ex-machina control isn't available, OAuth2 client credentials flow could be easily supported.
 // (Use https://pkg.go.dev/github.com/golang-jwt/jwt/v4#example-package-GetTokenViaHTTP to verify the token.)
-func authenticateBackend(c *gin.Context) error {
-	return nil
+// Backends can additionally be required to present one of the API keys configured for their application.
+func authenticateBackend(app *application, c *gin.Context) error {
+	backendAPIKeys := app.settings.Load().backendAPIKeys
+	if len(backendAPIKeys) == 0 {
+		return nil
+	}
+	return authenticateBearer(backendAPIKeys, c)
 }
 
-// Calls the `POST /ws/message-received` endpoint on the backend with "msg" and "connectionId"
-func onMessageReceived(msg string, connectionId connectionID) error {
-	return nil
+// authenticateBearer verifies that the request bears one of the `keys` as bearer token
+func authenticateBearer(keys []string, c *gin.Context) error {
+	return verifyBearer(keys, c.GetHeader("Authorization"))
+}
+
+// verifyBearer verifies that the `authorization` is one of the `keys` as bearer token
+func verifyBearer(keys []string, authorization string) error {
+	token, hasBearer := strings.CutPrefix(authorization, "Bearer ")
+	if !hasBearer {
+		return errMissingBackendCredentials
+	}
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+			return nil
+		}
+	}
+	return errInvalidBackendCredentials
+}
+
+var (
+	errMissingBackendCredentials = errors.New("missing backend credentials")
+	errInvalidBackendCredentials = errors.New("invalid backend credentials")
+)
+
+// Drain makes the node reject new connections and report not ready, so that it is taken out of the
+// load balancer, while the existing connections are served until the node is stopped
+func (s *Server) Drain() {
+	s.logger.Info().Msg("draining")
+	if s.health != nil {
+		s.health.draining.Store(true)
+	}
 }
 
 // Stop kills the listener
@@ -91,61 +211,101 @@ func (s *Server) Stop() {
 	} else {
 		logging.Info().Msg("Listener closed successfully")
 	}
+	if s.adminListener != nil {
+		s.adminListener.Close()
+	}
+	if s.grpcServer != nil {
+		s.grpcServer.Stop()
+	}
+	if s.apps != nil {
+		s.apps.close()
+	}
+	s.broker.close()
+	if s.registry != nil {
+		s.registry.Close()
+	}
+	if s.tracing != nil {
+		if tracingErr := s.tracing.shutdown(context.Background()); tracingErr != nil {
+			logging.Error().Err(tracingErr).Msg("error while exporting the remaining spans")
+		}
+	}
 
 }
 
-func createWsGwRequestHandler(options Config, logging zerolog.Logger) *gin.Engine {
+func createWsGwRequestHandler(apps *applications, cluster *cluster, ids *connectionIDs, m *metrics, h *health, poll *pollTransport) *gin.Engine {
 	rootEngine := gin.Default()
 
-	rootEngine.Use(RequestLogger)
+	rootEngine.Use(RequestLogger, cluster.forwardedAuthenticator())
 
-	wsConns := newWsConnections()
+	rootEngine.GET("/metrics", gin.WrapH(m.handler()))
+	rootEngine.GET("/healthz", h.livenessHandler())
+	rootEngine.GET("/readyz", h.readinessHandler())
 
-	appUrls := appURLs{
-		baseUrl: options.AppBaseUrl,
-	}
+	rootEngine.GET("/connect", appSelector(apps, ""), cluster.resumeRouter(), h.drainingGuard(), connectHandler(ids, webSocketTransport{}))
+	rootEngine.GET("/connect/:app", appSelector(apps, "app"), cluster.resumeRouter(), h.drainingGuard(), connectHandler(ids, webSocketTransport{}))
+
+	sse := newSSETransport()
+	rootEngine.GET("/connect/sse", appSelector(apps, ""), cluster.resumeRouter(), h.drainingGuard(), connectHandler(ids, sse))
+	rootEngine.GET("/connect/:app/sse", appSelector(apps, "app"), cluster.resumeRouter(), h.drainingGuard(), connectHandler(ids, sse))
+	registerSSEUpstream(rootEngine.Group("/connect/sse", appSelector(apps, "")), sse, cluster, ids)
+	registerSSEUpstream(rootEngine.Group("/connect/:app/sse", appSelector(apps, "app")), sse, cluster, ids)
+
+	rootEngine.GET("/connect/poll", appSelector(apps, ""), cluster.resumeRouter(), h.drainingGuard(), connectHandler(ids, poll))
+	rootEngine.GET("/connect/:app/poll", appSelector(apps, "app"), cluster.resumeRouter(), h.drainingGuard(), connectHandler(ids, poll))
+	registerPollSession(rootEngine.Group("/connect/poll", appSelector(apps, "")), poll, cluster, ids)
+	registerPollSession(rootEngine.Group("/connect/:app/poll", appSelector(apps, "app")), poll, cluster, ids)
 
-	rootEngine.GET(
-		"/connect",
-		connectHandler(
-			&appUrls,
-			wsConns,
-			options.LoadBalancerAddress,
-			onMessageReceived,
-		),
-	)
+	defaultAppBackendAPI := rootEngine.Group("", appSelector(apps, ""), backendAuthenticator(authenticateBackend))
+	registerBackendAPI(defaultAppBackendAPI, cluster, ids)
 
-	rootEngine.POST(
-		"/message/:connectionId",
-		pushHandler(
-			authenticateBackend,
-			"connectionId",
-			wsConns,
-		),
-	)
+	appBackendAPI := rootEngine.Group("/apps/:app", appSelector(apps, "app"), backendAuthenticator(authenticateBackend))
+	registerBackendAPI(appBackendAPI, cluster, ids)
 
 	return rootEngine
 }
 
-type appURLs struct {
-	baseUrl string
+// registerSSEUpstream registers the endpoint the clients of SSE connections send their messages to
+func registerSSEUpstream(r *gin.RouterGroup, sse *sseTransport, cluster *cluster, ids *connectionIDs) {
+	connection := r.Group("", connectionIDVerifier(ids, "connectionId"), cluster.connectionRouter("connectionId"))
+	connection.POST("/:connectionId", sse.upstreamHandler("connectionId"))
+	connection.OPTIONS("/:connectionId", preflightHandler(http.MethodPost))
 }
 
-func (u *appURLs) connecting() string {
-	return fmt.Sprintf("%s/ws/connecting", u.baseUrl)
+// registerPollSession registers the endpoints the clients of long-polling connections poll, send their messages
+// to and close their connection with
+func registerPollSession(r *gin.RouterGroup, poll *pollTransport, cluster *cluster, ids *connectionIDs) {
+	connection := r.Group("", connectionIDVerifier(ids, "connectionId"), cluster.connectionRouter("connectionId"))
+	connection.GET("/:connectionId", poll.pollHandler("connectionId"))
+	connection.POST("/:connectionId", poll.upstreamHandler("connectionId"))
+	connection.DELETE("/:connectionId", poll.closeHandler("connectionId"))
+	connection.OPTIONS("/:connectionId", preflightHandler("GET, POST, DELETE"))
 }
 
-func (u *appURLs) disconnected() string {
-	return fmt.Sprintf("%s/ws/disconnected", u.baseUrl)
+func registerBackendAPI(r *gin.RouterGroup, cluster *cluster, ids *connectionIDs) {
+	// routes addressing a single connection
+	connection := r.Group("", connectionIDVerifier(ids, "connectionId"), cluster.connectionRouter("connectionId"))
+	connection.POST("/message/:connectionId", pushHandler("connectionId"))
+	connection.DELETE("/connections/:connectionId", closeHandler("connectionId"))
+	connection.PUT("/connections/:connectionId/topics/:topic", topicMembershipHandler("connectionId", "topic", true))
+	connection.DELETE("/connections/:connectionId/topics/:topic", topicMembershipHandler("connectionId", "topic", false))
+
+	r.GET("/connections", listConnectionsHandler())
+	r.POST("/broadcast", broadcastHandler(cluster))
+	r.POST("/users/:userId/message", pushToUserHandler(cluster, "userId"))
+	r.POST("/topics/:topic/message", publishToTopicHandler(cluster, "topic"))
 }
 
 func RequestLogger(g *gin.Context) {
 	start := time.Now()
 
-	l := logging.Get()
-
 	r := g.Request
-	g.Request = r.WithContext(l.WithContext(r.Context()))
+	requestID := requestID(r.Header)
+	// The header is set for the requests forwarded to the other nodes of the cluster
+	r.Header.Set(RequestIDHeaderKey, requestID)
+	g.Header(RequestIDHeaderKey, requestID)
+
+	l := logging.Get().With().Str("request_id", requestID).Logger()
+	g.Request = r.WithContext(withRequestID(l.WithContext(r.Context()), requestID))
 
 	lrw := newLoggingResponseWriter(g.Writer)
 
@@ -0,0 +1,299 @@
+package wsgw
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// ConnectionTokenHeaderKey is the header conveying the token, which authorizes the client of a connection over
+// plain HTTP requests (SSE or long-polling) to use it, e.g. to send messages upstream with `POST /connect/sse/:connectionId`
+const ConnectionTokenHeaderKey = "X-WSGW-CONNECTION-TOKEN"
+
+// sseConnectionEvent is the first event of the streams, which tells the client its connection ID and token
+const sseConnectionEvent = "connection"
+
+// sseCloseEvent is the last event of the streams of the connections closed by the gateway. EventSource clients
+// reconnect to streams ending without it.
+const sseCloseEvent = "close"
+
+// sseKeepAliveInterval is how often a comment is sent over idle streams, so that proxies don't time them out
+const sseKeepAliveInterval = 15 * time.Second
+
+// sseWriteTimeout limits the writes of the events, which are not messages
+const sseWriteTimeout = 5 * time.Second
+
+var (
+	errSSESocketClosed  = errors.New("SSE stream closed")
+	errOriginNotAllowed = errors.New("origin not allowed")
+)
+
+// sseTransport binds the connections to Server-Sent Events streams for the messages downstream,
+// while the clients send their messages upstream in separate requests
+type sseTransport struct {
+	mu      sync.Mutex
+	sockets map[connectionID]*sseSocket
+}
+
+func newSSETransport() *sseTransport {
+	return &sseTransport{sockets: make(map[connectionID]*sseSocket)}
+}
+
+func (t *sseTransport) name() string {
+	return "sse"
+}
+
+func (t *sseTransport) detached() bool {
+	return false
+}
+
+func (t *sseTransport) accept(g *gin.Context, app *application, conn *connection) (wsIO, func(), error) {
+	if !allowCORS(g, app.settings.Load().originPatterns) {
+		g.AbortWithStatus(http.StatusForbidden)
+		return nil, nil, errOriginNotAllowed
+	}
+
+	socket := &sseSocket{
+		token:      rand.Text(),
+		writer:     g.Writer,
+		controller: http.NewResponseController(g.Writer),
+		upstream:   make(chan string),
+		closed:     make(chan struct{}),
+	}
+
+	g.Header("Content-Type", "text/event-stream")
+	g.Header("Cache-Control", "no-cache")
+	// Keeps nginx from buffering the stream
+	g.Header("X-Accel-Buffering", "no")
+	g.Header(ConnectionIDHeaderKey, string(conn.id))
+	g.Header(ConnectionTokenHeaderKey, socket.token)
+	g.Status(http.StatusOK)
+
+	// EventSource clients can't read the headers of the response
+	connectionEvent, _ := json.Marshal(map[string]string{"connectionId": string(conn.id), "token": socket.token, "resumeToken": conn.resumeToken})
+	if writeErr := socket.writeEvent(sseConnectionEvent, string(connectionEvent), time.Now().Add(sseWriteTimeout)); writeErr != nil {
+		return nil, nil, writeErr
+	}
+
+	t.mu.Lock()
+	t.sockets[conn.id] = socket
+	t.mu.Unlock()
+
+	go socket.keepAlive()
+
+	return socket, func() {
+		t.mu.Lock()
+		if t.sockets[conn.id] == socket {
+			delete(t.sockets, conn.id)
+		}
+		t.mu.Unlock()
+		socket.end()
+	}, nil
+}
+
+func (t *sseTransport) socket(connId connectionID) *sseSocket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sockets[connId]
+}
+
+// upstreamHandler relays the messages the clients of SSE connections send to their connection
+func (t *sseTransport) upstreamHandler(connIdPathParamName string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		app := appFromContext(g)
+		logger := zerolog.Ctx(g.Request.Context()).With().Str("app", app.name).Str("connection_id", g.Param(connIdPathParamName)).Logger()
+
+		if !allowCORS(g, app.settings.Load().originPatterns) {
+			g.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		socket := t.socket(connectionID(g.Param(connIdPathParamName)))
+		if socket == nil {
+			logger.Info().Msg("SSE connection doesn't exist")
+			g.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		if !hasConnectionToken(g, socket.token) {
+			logger.Info().Msg("invalid SSE token")
+			g.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		body, readErr := io.ReadAll(http.MaxBytesReader(g.Writer, g.Request.Body, maxMessageSize))
+		if readErr != nil {
+			logger.Info().Err(readErr).Msg("failed to read message")
+			g.AbortWithStatus(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		if deliverErr := socket.deliver(g.Request.Context(), string(body)); deliverErr != nil {
+			logger.Info().Err(deliverErr).Msg("failed to relay message")
+			g.AbortWithStatus(http.StatusGone)
+			return
+		}
+		g.Status(http.StatusNoContent)
+	}
+}
+
+// hasConnectionToken verifies that the request bears the `token` of the connection it addresses
+func hasConnectionToken(g *gin.Context, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(g.GetHeader(ConnectionTokenHeaderKey)), []byte(token)) == 1
+}
+
+// preflightHandler answers the CORS preflight requests of the browsers using the connections with `methods`
+func preflightHandler(methods string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		if !allowCORS(g, appFromContext(g).settings.Load().originPatterns) {
+			g.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		g.Header("Access-Control-Allow-Methods", methods)
+		g.Header("Access-Control-Allow-Headers", "Content-Type, "+ConnectionTokenHeaderKey)
+		g.Status(http.StatusNoContent)
+	}
+}
+
+// allowCORS authorizes the origin of the request as the WebSocket handshake does and allows the browser
+// to read the response of the authorized cross-origin requests
+func allowCORS(g *gin.Context, originPatterns []string) bool {
+	origin := g.GetHeader("Origin")
+	if origin == "" {
+		return true
+	}
+	originURL, parseErr := url.Parse(origin)
+	if parseErr != nil {
+		return false
+	}
+	allowed := strings.EqualFold(originURL.Host, g.Request.Host)
+	for _, pattern := range originPatterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(originURL.Host)); matched {
+			allowed = true
+		}
+	}
+	if allowed {
+		g.Header("Access-Control-Allow-Origin", origin)
+		g.Header("Access-Control-Allow-Credentials", "true")
+		g.Header("Access-Control-Expose-Headers", ConnectionIDHeaderKey+", "+ConnectionTokenHeaderKey)
+		g.Header("Vary", "Origin")
+	}
+	return allowed
+}
+
+// sseSocket is the stream of an SSE connection along with the messages the client sends upstream
+type sseSocket struct {
+	token string
+
+	// writeMu serializes the writes to the stream, which must not happen once it is closed
+	writeMu    sync.Mutex
+	writer     io.Writer
+	controller *http.ResponseController
+
+	upstream  chan string
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *sseSocket) Read(ctx context.Context) (string, error) {
+	select {
+	case msg := <-s.upstream:
+		return msg, nil
+	case <-s.closed:
+		return "", errSSESocketClosed
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (s *sseSocket) Write(ctx context.Context, msg string) error {
+	deadline, _ := ctx.Deadline()
+	return s.writeEvent("", msg, deadline)
+}
+
+// Close closes the stream of a connection too slow to keep up with the messages
+func (s *sseSocket) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+	return nil
+}
+
+// end ends the stream once the connection is done with it, telling the client not to reconnect
+func (s *sseSocket) end() {
+	s.writeEvent(sseCloseEvent, "", time.Now().Add(sseWriteTimeout))
+	s.Close()
+	// Waits for the writes in progress, as the stream can't be written to once the request is handled
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+}
+
+// deliver passes a message of the client to the reader of the socket
+func (s *sseSocket) deliver(ctx context.Context, msg string) error {
+	select {
+	case s.upstream <- msg:
+		return nil
+	case <-s.closed:
+		return errSSESocketClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writeEvent writes an event with the `data` split into lines as required by the SSE format
+func (s *sseSocket) writeEvent(event string, data string, deadline time.Time) error {
+	var encoded strings.Builder
+	if event != "" {
+		encoded.WriteString("event: " + event + "\n")
+	}
+	for _, line := range strings.Split(sseLineBreaks.Replace(data), "\n") {
+		encoded.WriteString("data: " + line + "\n")
+	}
+	encoded.WriteString("\n")
+	return s.write(encoded.String(), deadline)
+}
+
+var sseLineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// write writes to the stream, failing after the `deadline`, if any
+func (s *sseSocket) write(encoded string, deadline time.Time) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	select {
+	case <-s.closed:
+		return errSSESocketClosed
+	default:
+	}
+	if !deadline.IsZero() {
+		s.controller.SetWriteDeadline(deadline)
+		defer s.controller.SetWriteDeadline(time.Time{})
+	}
+	if _, writeErr := io.WriteString(s.writer, encoded); writeErr != nil {
+		return writeErr
+	}
+	return s.controller.Flush()
+}
+
+// keepAlive sends comments over the stream until it is closed
+func (s *sseSocket) keepAlive() {
+	ticker := time.NewTicker(sseKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			s.write(": keep-alive\n\n", time.Now().Add(sseWriteTimeout))
+		}
+	}
+}
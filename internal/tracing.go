@@ -0,0 +1,99 @@
+package wsgw
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// TracingConfig configures the export of the traces
+type TracingConfig struct {
+	// OTLPEndpoint is the URL of the OTLP/HTTP collector the traces are exported to, e.g. `http://localhost:4318`.
+	// Tracing is disabled if empty, though incoming W3C trace contexts are still relayed to the applications.
+	OTLPEndpoint string
+	// ServiceName defaults to `websocket-gateway`
+	ServiceName string
+	// BatchTimeout is the longest time spans are buffered before being exported. Defaults to 5 seconds.
+	BatchTimeout time.Duration
+}
+
+const defaultTracingServiceName = "websocket-gateway"
+
+const tracerName = "websocket-gateway"
+
+// tracing creates the spans and propagates the W3C trace context to and from the applications
+type tracing struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+func newTracing(conf TracingConfig) (*tracing, error) {
+	t := &tracing{
+		tracer:     noop.NewTracerProvider().Tracer(tracerName),
+		propagator: propagation.TraceContext{},
+	}
+	if conf.OTLPEndpoint == "" {
+		return t, nil
+	}
+
+	exporter, exporterErr := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(conf.OTLPEndpoint))
+	if exporterErr != nil {
+		return nil, exporterErr
+	}
+
+	serviceName := conf.ServiceName
+	if serviceName == "" {
+		serviceName = defaultTracingServiceName
+	}
+	var batcherOptions []sdktrace.BatchSpanProcessorOption
+	if conf.BatchTimeout > 0 {
+		batcherOptions = append(batcherOptions, sdktrace.WithBatchTimeout(conf.BatchTimeout))
+	}
+
+	t.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, batcherOptions...),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+	t.tracer = t.provider.Tracer(tracerName)
+	return t, nil
+}
+
+// startServerSpan starts a span for the request continuing the trace of the caller, if any
+func (t *tracing) startServerSpan(g *gin.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx := t.propagator.Extract(g.Request.Context(), propagation.HeaderCarrier(g.Request.Header))
+	return t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+}
+
+// endServerSpan records the response status of the request and ends the span
+func endServerSpan(span trace.Span, status int) {
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// inject adds the trace context of `ctx` to the header of a request
+func (t *tracing) inject(ctx context.Context, header http.Header) {
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// shutdown exports the buffered spans
+func (t *tracing) shutdown(ctx context.Context) error {
+	if t.provider == nil {
+		return nil
+	}
+	return t.provider.Shutdown(ctx)
+}
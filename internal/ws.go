@@ -4,24 +4,163 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 	"websocket-gateway/internal/logging"
 
+	"github.com/rs/xid"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
 	"nhooyr.io/websocket"
 )
 
 type connection struct {
 	id          connectionID
-	fromClient  chan string
-	fromBackend chan string
-	readError   chan error
-	closeSlow   func()
+	userID      string
+	fromBackend chan outboundMessage
+	// requestID is that of the request, which opened the connection
+	requestID string
+	// logger logs with the IDs of the connection, its user and the request, which opened it
+	logger zerolog.Logger
+	// traceContext is that of the connect request
+	traceContext trace.SpanContext
+	// closeRequested is signaled when the backend asks for the connection to be closed
+	closeRequested chan struct{}
+
+	// sendMu serializes the sending of messages, so that they are queued in the order of their sequence numbers
+	sendMu  sync.Mutex
+	lastSeq uint64
+
+	// resumeToken is set if the connection can be resumed or rebound, history if replay is enabled
+	history     *replayBuffer
+	resumeToken string
+	// pending are the messages to be sent before any other, e.g. those replayed to a resumed session
+	pending []outboundMessage
+
+	// socket is the WS the connection is currently bound to, nil while the connection is held
+	socketMu sync.Mutex
+	socket   wsIO
+	// tooSlow is set once the connection was closed for being too slow
+	tooSlow atomic.Bool
+	// overloaded is set once the connection was closed for its callback queue being full
+	overloaded atomic.Bool
+	// callbacks queues the callbacks for the messages from the client, nil if they are made right away
+	callbacks *callbackQueue
+
+	// connectedAt and stats are recorded in the audit log once the connection is closed
+	connectedAt time.Time
+	stats       connectionStats
+	// closedBy is the backend, which asked for the connection to be closed
+	closedBy atomic.Pointer[backendCaller]
+	// payloadSampleRate is the sample rate of the payload logging the application set for the connection, if any
+	payloadSampleRate *float64
+}
+
+// addPending queues a message of `msgType` with `data` for being sent before those from the backend
+func (conn *connection) addPending(msgType string, data string) {
+	conn.sendMu.Lock()
+	defer conn.sendMu.Unlock()
+
+	msg := conn.nextMessage(msgType, data)
+	conn.lastSeq = msg.Seq
+	if conn.history != nil {
+		conn.history.add(msg)
+	}
+	conn.pending = append(conn.pending, msg)
+}
+
+// takePending returns the messages queued for being sent first and clears them
+func (conn *connection) takePending() []outboundMessage {
+	conn.sendMu.Lock()
+	defer conn.sendMu.Unlock()
+
+	pending := conn.pending
+	conn.pending = nil
+	return pending
+}
+
+// nextMessage is to be called with `sendMu` held
+func (conn *connection) nextMessage(msgType string, data string) outboundMessage {
+	return outboundMessage{
+		Type:      msgType,
+		ID:        xid.New().String(),
+		Seq:       conn.lastSeq + 1,
+		Timestamp: time.Now().UTC(),
+		Data:      data,
+	}
+}
+
+// closeSlow closes the socket of a connection too slow to keep up with the messages
+func (conn *connection) closeSlow() {
+	conn.tooSlow.Store(true)
+
+	conn.socketMu.Lock()
+	defer conn.socketMu.Unlock()
+
+	if conn.socket != nil {
+		go conn.socket.Close()
+	}
+}
+
+func (conn *connection) bind(socket wsIO) {
+	conn.socketMu.Lock()
+	defer conn.socketMu.Unlock()
+
+	conn.socket = socket
+}
+
+func (conn *connection) unbind(socket wsIO) {
+	conn.socketMu.Lock()
+	defer conn.socketMu.Unlock()
+
+	if conn.socket == socket {
+		conn.socket = nil
+	}
+}
+
+// sessionMessage is the message conveying the connection ID and resume token to the client, its sequence
+// number being that of the last message sent so far. It is to be called with `sendMu` held.
+func (conn *connection) sessionMessage(resumed bool) outboundMessage {
+	return outboundMessage{
+		Type:         sessionMessageType,
+		ID:           xid.New().String(),
+		Seq:          conn.lastSeq,
+		Timestamp:    time.Now().UTC(),
+		ConnectionID: string(conn.id),
+		ResumeToken:  conn.resumeToken,
+		Resumed:      resumed,
+	}
+}
+
+// send queues a message of `msgType` with `data` for the connection. It never blocks and
+// reports whether the message could be queued.
+func (conn *connection) send(msgType string, data string, traceContext trace.SpanContext) bool {
+	conn.sendMu.Lock()
+	defer conn.sendMu.Unlock()
+
+	msg := conn.nextMessage(msgType, data)
+	msg.traceContext = traceContext
+	select {
+	case conn.fromBackend <- msg:
+		conn.lastSeq = msg.Seq
+		if conn.history != nil {
+			conn.history.add(msg)
+		}
+		return true
+	default:
+		return false
+	}
 }
 
 type wsConnections struct {
-	connectionMessageBuffer int
+	appName                 string
+	nodeID                  string
+	connectionMessageBuffer atomic.Int64
+	messageFormat           string
+	encode                  messageEncoder
 
 	// publishLimiter controls the rate limit applied to the publish endpoint.
 	//
@@ -30,21 +169,127 @@ type wsConnections struct {
 
 	connectionsMu sync.Mutex
 	wsMap         map[connectionID]*connection
+	// reservedSlots are the connections being accepted, which count towards the connection limit
+	reservedSlots int
+
+	// registry keeps track of the connections across the nodes of the cluster, while `wsMap`
+	// holds the connections owned by this node
+	registry ConnectionRegistry
 
+	replayBufferSize int
+	resumeWindow     time.Duration
+	gracePeriod      time.Duration
+	// sessionsMu guards both the retained sessions and the held connections, which are keyed by resume token
+	sessionsMu sync.Mutex
+	sessions   map[string]*retainedSession
+	held       map[string]*heldConnection
+
+	// offline is nil unless messages to recently disconnected connections and users are queued
+	offline *offlineQueue
+	// payloads is replaced when the configuration is reloaded
+	payloads atomic.Pointer[payloadLogger]
+	// callbacks is nil unless the callbacks for the messages from the clients are dispatched to a pool of workers
+	callbacks *callbackPool
+
+	metrics *metrics
+	tracing *tracing
+	// audit is nil unless the lifecycle of the connections is audited
+	audit  *auditLog
 	logger zerolog.Logger
 }
 
-var errConnectionNotFound = errors.New("connection not found")
+var (
+	ErrConnectionNotFound = errors.New("connection not found")
+	errClosedByBackend    = errors.New("connection closed by backend")
+	errConnectionTooSlow  = errors.New("connection too slow to keep up with messages")
+	errRateLimited        = errors.New("push rate limit exceeded")
+)
+
+const defaultMessageBufferSize = 16
+
+// maxMessageSize is the largest message a client can send upstream, whatever the transport
+const maxMessageSize = 32768
+
+const maxThrottleWait = 5 * time.Second
+
+// pushRateLimit returns the limit and burst of the push rate limiter of the application
+func pushRateLimit(conf AppConfig) (rate.Limit, int) {
+	if conf.PushRateLimit == 0 {
+		return rate.Every(time.Millisecond * 100), 8
+	}
+	return rate.Limit(conf.PushRateLimit), conf.PushBurst
+}
+
+func messageBufferSize(conf AppConfig) int {
+	if conf.MessageBufferSize == 0 {
+		return defaultMessageBufferSize
+	}
+	return conf.MessageBufferSize
+}
+
+type wsConnectionsConfig struct {
+	appName           string
+	nodeID            string
+	registry          ConnectionRegistry
+	messageBufferSize int
+	pushLimiter       *rate.Limiter
+	messageFormat     string
+	replayBufferSize  int
+	resumeWindow      time.Duration
+	gracePeriod       time.Duration
+	offlineQueue      OfflineQueueConfig
+	payloadLogging    PayloadLoggingConfig
+	callbackDispatch  CallbackDispatchConfig
+	metrics           *metrics
+	tracing           *tracing
+	audit             *auditLog
+}
+
+func newWsConnections(conf wsConnectionsConfig) (*wsConnections, error) {
+	encode, encoderErr := newMessageEncoder(conf.messageFormat)
+	if encoderErr != nil {
+		return nil, encoderErr
+	}
+	if conf.replayBufferSize > 0 && conf.messageFormat != JSONEnvelopeMessageFormat {
+		return nil, errors.New("replay requires the json-envelope message format")
+	}
+	offline, offlineErr := newOfflineQueue(conf.offlineQueue)
+	if offlineErr != nil {
+		return nil, offlineErr
+	}
+	payloads, payloadsErr := newPayloadLogger(conf.payloadLogging)
+	if payloadsErr != nil {
+		return nil, payloadsErr
+	}
+	resumeWindow := conf.resumeWindow
+	if resumeWindow == 0 {
+		resumeWindow = defaultResumeWindow
+	}
 
-func newWsConnections() *wsConnections {
 	ns := &wsConnections{
-		connectionMessageBuffer: 16,
-		wsMap:                   make(map[connectionID]*connection),
-		publishLimiter:          rate.NewLimiter(rate.Every(time.Millisecond*100), 8),
-		logger:                  logging.Get().With().Str("unit", "WsConnections").Logger(),
+		appName:          conf.appName,
+		nodeID:           conf.nodeID,
+		registry:         conf.registry,
+		messageFormat:    conf.messageFormat,
+		encode:           encode,
+		wsMap:            make(map[connectionID]*connection),
+		publishLimiter:   conf.pushLimiter,
+		replayBufferSize: conf.replayBufferSize,
+		resumeWindow:     resumeWindow,
+		gracePeriod:      conf.gracePeriod,
+		sessions:         make(map[string]*retainedSession),
+		held:             make(map[string]*heldConnection),
+		offline:          offline,
+		callbacks:        newCallbackPool(conf.callbackDispatch),
+		metrics:          conf.metrics,
+		tracing:          conf.tracing,
+		audit:            conf.audit,
+		logger:           logging.Get().With().Str("unit", "WsConnections").Str("app", conf.appName).Logger(),
 	}
+	ns.connectionMessageBuffer.Store(int64(conf.messageBufferSize))
+	ns.payloads.Store(payloads)
 
-	return ns
+	return ns, nil
 }
 
 type wsIO interface {
@@ -53,28 +298,97 @@ type wsIO interface {
 	Read(ctx context.Context) (string, error)
 }
 
-type onMgsReceivedFunc func(msg string, connectionId connectionID) error
+type onMgsReceivedFunc func(msg inboundMessage) error
+
+// reload applies the reloadable settings of the application. The message buffer size applies to the
+// connections created from then on.
+func (wsconn *wsConnections) reload(conf AppConfig) {
+	wsconn.connectionMessageBuffer.Store(int64(messageBufferSize(conf)))
+	limit, burst := pushRateLimit(conf)
+	wsconn.publishLimiter.SetLimit(limit)
+	wsconn.publishLimiter.SetBurst(burst)
+	wsconn.offline.reconfigure(conf.OfflineQueue)
+	if payloads, payloadsErr := newPayloadLogger(conf.PayloadLogging); payloadsErr == nil {
+		wsconn.payloads.Store(payloads)
+	}
+}
 
+// newConnection creates the connection with `connId`. If `session` is not nil, the connection resumes it
+// replaying the messages after `clientLastSeq`.
+func (wsconn *wsConnections) newConnection(connId connectionID, userID string, requestID string, session *retainedSession, clientLastSeq uint64) *connection {
+	conn := &connection{
+		id:             connId,
+		userID:         userID,
+		requestID:      requestID,
+		fromBackend:    make(chan outboundMessage, wsconn.connectionMessageBuffer.Load()),
+		closeRequested: make(chan struct{}, 1),
+		connectedAt:    time.Now(),
+		callbacks:      wsconn.callbacks.newQueue(),
+		logger: wsconn.logger.With().
+			Str("connection_id", string(connId)).
+			Str("user_id", userID).
+			Str("request_id", requestID).
+			Logger(),
+	}
+
+	if !wsconn.resumable() {
+		return conn
+	}
+
+	if session != nil {
+		conn.resumeToken = session.token
+		conn.lastSeq = session.lastSeq
+		conn.history = session.history
+		conn.pending = session.history.since(clientLastSeq)
+	} else {
+		conn.resumeToken = newResumeToken(wsconn.nodeID)
+		if wsconn.replayEnabled() {
+			conn.history = newReplayBuffer(wsconn.replayBufferSize)
+		}
+	}
+
+	if wsconn.messageFormat == JSONEnvelopeMessageFormat {
+		conn.pending = append([]outboundMessage{conn.sessionMessage(session != nil)}, conn.pending...)
+	}
+
+	return conn
+}
+
+// processMessages relays the messages between the backend and the socket `wsIo` the connection is bound to
+// until either the socket or the connection is closed. The connection must have been added before.
 func (wsconn *wsConnections) processMessages(
 	ctx context.Context,
-	connectionId connectionID,
+	conn *connection,
 	wsIo wsIO,
 	onMessageReceived onMgsReceivedFunc,
 ) error {
-	logger := wsconn.logger.With().Str(logging.MethodLogger, "processMessages").Logger()
+	logger := conn.logger.With().Str(logging.MethodLogger, "processMessages").Logger()
 
-	conn := &connection{
-		id:          connectionId,
-		fromClient:  make(chan string),
-		fromBackend: make(chan string, wsconn.connectionMessageBuffer),
-		readError:   make(chan error),
-		closeSlow: func() {
-			wsIo.Close()
-		},
+	conn.bind(wsIo)
+	defer conn.unbind(wsIo)
+
+	for _, msg := range conn.takePending() {
+		if err := wsconn.write(ctx, conn, wsIo, msg, logger); err != nil {
+			return err
+		}
 	}
 
-	wsconn.addConnection(conn)
-	defer wsconn.deleteConnection(conn)
+	fromClient := make(chan string)
+	// inbox is nil while reading from the client is paused for its callback queue being full,
+	// until `space` signals room for the message held back
+	inbox := fromClient
+	var space <-chan struct{}
+	var heldBack *inboundMessage
+	defer func() {
+		if heldBack != nil {
+			held := *heldBack
+			conn.callbacks.add(func() { onMessageReceived(held) })
+		}
+	}()
+	readError := make(chan error, 1)
+	// done stops the reader once the socket is closed, which happens after returning
+	done := make(chan struct{})
+	defer close(done)
 
 	go func() {
 		for {
@@ -88,14 +402,14 @@ func (wsconn *wsConnections) processMessages(
 				default:
 					logger.Error().Err(errRead).Msg("read error")
 				}
-				select {
-				case conn.readError <- errRead:
-				default:
-					go wsIo.Close()
-				}
+				readError <- errRead
+				return
+			}
+			select {
+			case fromClient <- msgRead:
+			case <-done:
 				return
 			}
-			conn.fromClient <- msgRead
 		}
 	}()
 
@@ -104,14 +418,49 @@ func (wsconn *wsConnections) processMessages(
 		select {
 		case msg := <-conn.fromBackend:
 			logger.Debug().Msg("select: msg from backend")
-			err := writeTimeout(ctx, time.Second*5, wsIo, msg)
+			err := wsconn.write(ctx, conn, wsIo, msg, logger)
 			if err != nil {
 				return err
 			}
-		case msg := <-conn.fromClient:
-			onMessageReceived(msg, conn.id)
-		case <-conn.readError:
-			return nil
+		case msg := <-inbox:
+			wsconn.metrics.messages.WithLabelValues(wsconn.appName, inboundDirection).Inc()
+			wsconn.metrics.messageBytes.WithLabelValues(wsconn.appName, inboundDirection).Add(float64(len(msg)))
+			conn.stats.messagesReceived.Add(1)
+			conn.stats.bytesReceived.Add(int64(len(msg)))
+			inbound := newInboundMessage(conn, msg)
+			wsconn.logPayload(conn, inboundDirection, inbound.id, msg)
+			if conn.callbacks == nil {
+				onMessageReceived(inbound)
+				break
+			}
+			if conn.callbacks.tryAdd(func() { onMessageReceived(inbound) }) {
+				break
+			}
+			switch wsconn.callbacks.whenFull {
+			case DropOnFullQueue:
+				logger.Info().Str("message_id", inbound.id).Msg("callback queue full, message dropped")
+				wsconn.metrics.droppedMessages.WithLabelValues(wsconn.appName, callbackQueueFullDropReason).Inc()
+			case CloseOnFullQueue:
+				logger.Info().Msg("callback queue full, closing connection")
+				conn.overloaded.Store(true)
+				return errCallbackQueueFull
+			default:
+				heldBack = &inbound
+				inbox = nil
+				space = conn.callbacks.space
+			}
+		case <-space:
+			held := *heldBack
+			if conn.callbacks.tryAdd(func() { onMessageReceived(held) }) {
+				heldBack = nil
+				inbox = fromClient
+				space = nil
+			}
+		case err := <-readError:
+			return err
+		case <-conn.closeRequested:
+			logger.Debug().Msg("select: close requested")
+			return errClosedByBackend
 		case <-ctx.Done():
 			logger.Debug().Msg("select: context is done")
 			return ctx.Err()
@@ -120,11 +469,56 @@ func (wsconn *wsConnections) processMessages(
 	}
 }
 
-// addConnection registers a subscriber.
+// write encodes msg in the format of the application and writes it to the connection.
+// Messages failing to encode are dropped. Writes of traced pushes are traced as part of the push.
+func (wsconn *wsConnections) write(ctx context.Context, conn *connection, wsIo wsIO, msg outboundMessage, logger zerolog.Logger) error {
+	if msg.traceContext.IsValid() {
+		var span trace.Span
+		ctx, span = wsconn.tracing.tracer.Start(trace.ContextWithSpanContext(ctx, msg.traceContext), "wsgw.write",
+			trace.WithAttributes(attribute.String("wsgw.message_id", msg.ID), attribute.String("wsgw.message_type", msg.Type)),
+		)
+		defer span.End()
+	}
+
+	encoded, encodeErr := wsconn.encode(msg)
+	if encodeErr != nil {
+		logger.Error().Err(encodeErr).Str("message_id", msg.ID).Msg("failed to encode message")
+		wsconn.metrics.droppedMessages.WithLabelValues(wsconn.appName, encodeErrorDropReason).Inc()
+		return nil
+	}
+	if err := writeTimeout(ctx, time.Second*5, wsIo, encoded); err != nil {
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+		return err
+	}
+	wsconn.metrics.messages.WithLabelValues(wsconn.appName, outboundDirection).Inc()
+	wsconn.metrics.messageBytes.WithLabelValues(wsconn.appName, outboundDirection).Add(float64(len(encoded)))
+	conn.stats.messagesSent.Add(1)
+	conn.stats.bytesSent.Add(int64(len(encoded)))
+	wsconn.logPayload(conn, outboundDirection, msg.ID, msg.Data)
+	return nil
+}
+
+// addConnection registers a subscriber. The messages queued while it or its user was offline are sent first.
 func (wsconn *wsConnections) addConnection(conn *connection) {
+	for _, msg := range wsconn.offline.take(conn.id, conn.userID) {
+		conn.addPending(msg.msgType, msg.data)
+	}
+
 	wsconn.connectionsMu.Lock()
 	wsconn.wsMap[conn.id] = conn
 	wsconn.connectionsMu.Unlock()
+	wsconn.metrics.connections.WithLabelValues(wsconn.appName).Inc()
+
+	registryErr := wsconn.registry.Register(context.Background(), ConnectionEntry{
+		ID:          string(conn.id),
+		App:         wsconn.appName,
+		Node:        wsconn.nodeID,
+		UserID:      conn.userID,
+		ConnectedAt: time.Now(),
+	})
+	if registryErr != nil {
+		conn.logger.Error().Err(registryErr).Msg("failed to register connection")
+	}
 }
 
 // deleteConnection deletes the given subscriber.
@@ -132,26 +526,232 @@ func (wsconn *wsConnections) deleteConnection(conn *connection) {
 	wsconn.connectionsMu.Lock()
 	delete(wsconn.wsMap, conn.id)
 	wsconn.connectionsMu.Unlock()
+	wsconn.metrics.connections.WithLabelValues(wsconn.appName).Dec()
+
+	registryErr := wsconn.registry.Deregister(context.Background(), wsconn.appName, string(conn.id))
+	if registryErr != nil {
+		conn.logger.Error().Err(registryErr).Msg("failed to deregister connection")
+	}
+}
+
+// push sends the msg to the connection with `connId`.
+// It never blocks and so slow connections are closed and the message is dropped.
+func (wsconn *wsConnections) push(ctx context.Context, msg string, connId connectionID) error {
+	if err := wsconn.throttle(ctx); err != nil {
+		return err
+	}
+
+	wsconn.connectionsMu.Lock()
+	defer wsconn.connectionsMu.Unlock()
+
+	conn, ok := wsconn.wsMap[connId]
+	if !ok {
+		return ErrConnectionNotFound
+	}
+	if !wsconn.sendTo(ctx, conn, directMessageType, msg) {
+		return errConnectionTooSlow
+	}
+	return nil
+}
+
+// pushOrQueue sends the msg to the connection with `connId` or, if the connection recently disconnected,
+// queues it. It reports whether the message was queued.
+func (wsconn *wsConnections) pushOrQueue(ctx context.Context, msg string, connId connectionID) (bool, error) {
+	errPush := wsconn.push(ctx, msg, connId)
+	if errPush != ErrConnectionNotFound {
+		return false, errPush
+	}
+	errQueue := wsconn.queueForConnection(connId, msg)
+	if errQueue == errNotQueued {
+		return false, ErrConnectionNotFound
+	}
+	return errQueue == nil, errQueue
 }
 
-// publish publishes the msg to all subscribers.
-// It never blocks and so messages to slow subscribers
-// are dropped.
-func (wsconn *wsConnections) push(msg string, connId connectionID) error {
+// throttle waits for the push rate limiter to allow for another push. Pushes, which would have to wait
+// longer than maxThrottleWait, are rejected right away.
+func (wsconn *wsConnections) throttle(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, maxThrottleWait)
+	defer cancel()
+
+	if err := wsconn.publishLimiter.Wait(ctx); err != nil {
+		wsconn.metrics.rateLimiterRejection.WithLabelValues(wsconn.appName).Inc()
+		return errRateLimited
+	}
+	return nil
+}
+
+// sendTo sends the message to the connection or, if the connection is too slow to keep up with the messages,
+// closes it and drops the message. It reports whether the message was sent.
+func (wsconn *wsConnections) sendTo(ctx context.Context, conn *connection, msgType string, msg string) bool {
+	if !conn.send(msgType, msg, trace.SpanContextFromContext(ctx)) {
+		conn.logger.Info().Str("push_request_id", requestIDFromContext(ctx)).Msg("connection too slow, closing it")
+		wsconn.metrics.droppedMessages.WithLabelValues(wsconn.appName, tooSlowDropReason).Inc()
+		go conn.closeSlow()
+		return false
+	}
+	wsconn.metrics.outboundQueueDepth.WithLabelValues(wsconn.appName).Observe(float64(len(conn.fromBackend)))
+	return true
+}
+
+// queueForConnection queues msg for the recently disconnected connection with `connId`
+func (wsconn *wsConnections) queueForConnection(connId connectionID, msg string) error {
+	err := wsconn.offline.put(offlineKey{connId: connId}, directMessageType, msg)
+	if err == errOfflineQueueFull {
+		wsconn.metrics.droppedMessages.WithLabelValues(wsconn.appName, offlineQueueFullDropReason).Inc()
+	}
+	return err
+}
+
+// close asks for the connection with `connId` to be closed on behalf of `caller`. Held connections are closed right away.
+func (wsconn *wsConnections) close(connId connectionID, caller *backendCaller) error {
+	wsconn.connectionsMu.Lock()
+	conn, ok := wsconn.wsMap[connId]
+	wsconn.connectionsMu.Unlock()
+	if !ok {
+		return ErrConnectionNotFound
+	}
+	conn.closedBy.CompareAndSwap(nil, caller)
+
+	if held := wsconn.claimHeld(conn.resumeToken); held != nil {
+		wsconn.connectionGone(conn, errClosedByBackend, held.onGone)
+		return nil
+	}
+
+	select {
+	case conn.closeRequested <- struct{}{}:
+	default: // already requested
+	}
+	return nil
+}
+
+// broadcast sends msg to all connections and returns the number of connections it was sent to.
+// Connections too slow to keep up with the messages are closed.
+func (wsconn *wsConnections) broadcast(ctx context.Context, msg string) (int, error) {
+	if err := wsconn.throttle(ctx); err != nil {
+		return 0, err
+	}
+
 	wsconn.connectionsMu.Lock()
 	defer wsconn.connectionsMu.Unlock()
 
-	wsconn.publishLimiter.Wait(context.Background())
+	sent := 0
+	for _, conn := range wsconn.wsMap {
+		if wsconn.sendTo(ctx, conn, broadcastMessageType, msg) {
+			sent++
+		}
+	}
+
+	return sent, nil
+}
+
+// pushToUser sends msg to the connections of the user owned by this node and returns the number of them.
+// If the user has no connections at all but recently disconnected from this node, msg is queued instead.
+func (wsconn *wsConnections) pushToUser(ctx context.Context, userID string, msg string) (int, bool, error) {
+	connIds, err := wsconn.registry.UserConnections(ctx, wsconn.appName, userID)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(connIds) == 0 {
+		queueErr := wsconn.offline.put(offlineKey{userID: userID}, userMessageType, msg)
+		if queueErr == errOfflineQueueFull {
+			wsconn.metrics.droppedMessages.WithLabelValues(wsconn.appName, offlineQueueFullDropReason).Inc()
+			wsconn.logger.Info().Str("user_id", userID).Msg("offline queue full, message rejected")
+		}
+		return 0, queueErr == nil, nil
+	}
+	sent, err := wsconn.deliver(ctx, connIds, userMessageType, msg)
+	return sent, false, err
+}
+
+// publishToTopic sends msg to the members of the topic owned by this node and returns the number of them
+func (wsconn *wsConnections) publishToTopic(ctx context.Context, topic string, msg string) (int, error) {
+	connIds, err := wsconn.registry.TopicMembers(ctx, wsconn.appName, topic)
+	if err != nil {
+		return 0, err
+	}
+	return wsconn.deliver(ctx, connIds, topicMessageType, msg)
+}
+
+// deliver sends msg to those of the connections with `connIds` that are owned by this node.
+// Connections too slow to keep up with the messages are closed.
+func (wsconn *wsConnections) deliver(ctx context.Context, connIds []string, msgType string, msg string) (int, error) {
+	if err := wsconn.throttle(ctx); err != nil {
+		return 0, err
+	}
 
-	for id := range wsconn.wsMap {
-		if id == connId {
-			conn := wsconn.wsMap[id]
-			conn.fromBackend <- string(msg)
-			return nil
+	wsconn.connectionsMu.Lock()
+	defer wsconn.connectionsMu.Unlock()
+
+	sent := 0
+	for _, connId := range connIds {
+		conn, ok := wsconn.wsMap[connectionID(connId)]
+		if !ok {
+			continue
+		}
+		if wsconn.sendTo(ctx, conn, msgType, msg) {
+			sent++
 		}
 	}
 
-	return errConnectionNotFound
+	return sent, nil
+}
+
+// joinTopic adds the connection owned by this node to the topic
+func (wsconn *wsConnections) joinTopic(ctx context.Context, connId connectionID, topic string) error {
+	if !wsconn.owns(connId) {
+		return ErrConnectionNotFound
+	}
+	return wsconn.registry.JoinTopic(ctx, wsconn.appName, topic, string(connId))
+}
+
+// leaveTopic removes the connection owned by this node from the topic
+func (wsconn *wsConnections) leaveTopic(ctx context.Context, connId connectionID, topic string) error {
+	if !wsconn.owns(connId) {
+		return ErrConnectionNotFound
+	}
+	return wsconn.registry.LeaveTopic(ctx, wsconn.appName, topic, string(connId))
+}
+
+func (wsconn *wsConnections) owns(connId connectionID) bool {
+	wsconn.connectionsMu.Lock()
+	defer wsconn.connectionsMu.Unlock()
+
+	_, ok := wsconn.wsMap[connId]
+	return ok
+}
+
+// count returns the number of connections
+func (wsconn *wsConnections) count() int {
+	wsconn.connectionsMu.Lock()
+	defer wsconn.connectionsMu.Unlock()
+
+	return len(wsconn.wsMap)
+}
+
+// reserveSlot reserves a slot for a connection being accepted unless there are `maxConnections` connections,
+// including those being accepted, already. 0 means no limit. The returned function releases the slot
+// and may be called several times, e.g. once the connection is added and when the handshake ends.
+func (wsconn *wsConnections) reserveSlot(maxConnections int) (func(), bool) {
+	if maxConnections <= 0 {
+		return func() {}, true
+	}
+
+	wsconn.connectionsMu.Lock()
+	defer wsconn.connectionsMu.Unlock()
+
+	if len(wsconn.wsMap)+wsconn.reservedSlots >= maxConnections {
+		return nil, false
+	}
+	wsconn.reservedSlots++
+	var release sync.Once
+	return func() {
+		release.Do(func() {
+			wsconn.connectionsMu.Lock()
+			wsconn.reservedSlots--
+			wsconn.connectionsMu.Unlock()
+		})
+	}, true
 }
 
 func writeTimeout(ctx context.Context, timeout time.Duration, sIo wsIO, msg string) error {
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const unixSocketWsgwPort = 8081
+
+type unixSocketAppTestSuite struct {
+	suite.Suite
+	socketDir string
+	mockApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestUnixSocketAppTestSuite(t *testing.T) {
+	suite.Run(t, &unixSocketAppTestSuite{
+		logger: logging.Get().With().Str("unit", "TestUnixSocketAppTestSuite").Logger(),
+	})
+}
+
+func (s *unixSocketAppTestSuite) SetupSuite() {
+	socketDir, tempDirErr := os.MkdirTemp("", "wsgw-test")
+	if tempDirErr != nil {
+		panic(tempDirErr)
+	}
+	s.socketDir = socketDir
+	socketPath := filepath.Join(socketDir, "app.sock")
+
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", unixSocketWsgwPort))
+	mockAppStartErr := s.mockApp.startOn("unix", socketPath)
+	if mockAppStartErr != nil {
+		panic(mockAppStartErr)
+	}
+
+	server := wsgw.CreateServer(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: unixSocketWsgwPort,
+			AppBaseUrl: "http://sidecar-app",
+			AppTransport: wsgw.AppTransportConfig{
+				UnixSocket:  socketPath,
+				EnableHTTP2: true,
+			},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+	s.wsGateway = server
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go server.SetupAndStart(func(port int, stop func()) {
+		wg.Done()
+	})
+	wg.Wait()
+}
+
+func (s *unixSocketAppTestSuite) TearDownSuite() {
+	if s.mockApp != nil {
+		s.mockApp.stop()
+	}
+	if s.wsGateway != nil {
+		s.wsGateway.Stop()
+	}
+	os.RemoveAll(s.socketDir)
+}
+
+func (s *unixSocketAppTestSuite) TestCallbacksOverUnixSocket() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _, err := connectToWs(ctx, unixSocketWsgwPort, defaultDialOptions)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	defer c.Close(websocket.StatusNormalClosure, "we're done")
+
+	err = c.Write(ctx, websocket.MessageText, []byte("hello over the socket"))
+	s.NoError(err)
+
+	s.Eventually(func() bool {
+		return len(s.mockApp.getMessagesReceived()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	messages := s.mockApp.getMessagesReceived()
+	if len(messages) == 1 {
+		s.Equal("hello over the socket", messages[0][1])
+	}
+
+	metricsResponse, metricsErr := http.Get(fmt.Sprintf("http://localhost:%d/metrics", unixSocketWsgwPort))
+	s.NoError(metricsErr)
+	if metricsErr != nil {
+		return
+	}
+	defer metricsResponse.Body.Close()
+	metricsBody, _ := io.ReadAll(metricsResponse.Body)
+	s.True(strings.Contains(string(metricsBody), `wsgw_app_callback_duration_seconds_count{app="default",endpoint="connecting",status="200"} 1`))
+	s.True(strings.Contains(string(metricsBody), `wsgw_app_callback_duration_seconds_count{app="default",endpoint="message-received",status="200"} 1`))
+}
@@ -0,0 +1,179 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const auditWsgwPort = 8098
+
+type auditTestSuite struct {
+	suite.Suite
+	auditFile string
+	mockApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestAuditTestSuite(t *testing.T) {
+	suite.Run(t, &auditTestSuite{
+		logger: logging.Get().With().Str("unit", "TestAuditTestSuite").Logger(),
+	})
+}
+
+func (s *auditTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", auditWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	s.auditFile = filepath.Join(s.T().TempDir(), "audit.log")
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: auditWsgwPort,
+			AppBaseUrl: fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+			Audit: wsgw.AuditConfig{
+				Outputs: []string{logging.FileOutput},
+				File:    logging.FileConfig{Path: s.auditFile},
+			},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+}
+
+func (s *auditTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+}
+
+func (s *auditTestSuite) connect(ctx context.Context, credential string, requestID string) (*websocket.Conn, error) {
+	c, _, err := connectToWs(ctx, auditWsgwPort, &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization":         []string{credential},
+			wsgw.RequestIDHeaderKey: []string{requestID},
+		},
+	})
+	return c, err
+}
+
+// records returns the audit records of the connection opened by the request with `requestID` by event
+func (s *auditTestSuite) records(requestID string) map[string]map[string]any {
+	file, openErr := os.Open(s.auditFile)
+	s.Require().NoError(openErr)
+	defer file.Close()
+
+	records := map[string]map[string]any{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record map[string]any
+		s.Require().NoError(json.Unmarshal(scanner.Bytes(), &record))
+		if record["request_id"] == requestID {
+			records[record["event"].(string)] = record
+		}
+	}
+	return records
+}
+
+// closedRecord waits for the connection opened by the request with `requestID` to be recorded as closed
+func (s *auditTestSuite) closedRecord(requestID string) map[string]any {
+	var closed map[string]any
+	s.Eventually(func() bool {
+		closed = s.records(requestID)["closed"]
+		return closed != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	return closed
+}
+
+func (s *auditTestSuite) TestConnectionClosedByBackend() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, err := s.connect(ctx, userCredentialPrefix+"alice", "audit-backend-close")
+	s.Require().NoError(err)
+	defer c.Close(websocket.StatusNormalClosure, "")
+	s.Eventually(func() bool {
+		return s.records("audit-backend-close")["upgraded"] != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	connId := s.records("audit-backend-close")["upgraded"]["connection_id"].(string)
+
+	request, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://localhost:%d/connections/%s", auditWsgwPort, connId), nil)
+	request.Header.Set("Authorization", "Bearer backend-key")
+	request.Header.Set(wsgw.RequestIDHeaderKey, "audit-close-request")
+	response, err := http.DefaultClient.Do(request)
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+
+	closed := s.closedRecord("audit-backend-close")
+	s.Equal("backend", closed["closed_by"])
+	s.EqualValues(websocket.StatusNormalClosure, closed["close_code"])
+	caller := closed["backend_caller"].(map[string]any)
+	s.Equal("audit-close-request", caller["request_id"])
+	s.NotEmpty(caller["remote_addr"])
+	s.Len(caller["api_key_id"], 8)
+	s.NotContains(caller, "backend-key")
+}
+
+func (s *auditTestSuite) TestConnectionLifecycle() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, err := s.connect(ctx, userCredentialPrefix+"bob", "audit-lifecycle")
+	s.Require().NoError(err)
+
+	s.NoError(c.Write(ctx, websocket.MessageText, []byte("hello")))
+	s.Eventually(func() bool {
+		return len(s.mockApp.getMessagesReceived()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	s.Require().NoError(c.Close(websocket.StatusNormalClosure, "bye"))
+
+	closed := s.closedRecord("audit-lifecycle")
+	records := s.records("audit-lifecycle")
+	s.Contains(records, "connect_attempted")
+	s.Equal(true, records["app_decision"]["accepted"])
+	s.Equal("bob", records["app_decision"]["user_id"])
+	s.Equal("accepted", records["upgraded"]["outcome"])
+
+	connId := records["upgraded"]["connection_id"]
+	s.NotEmpty(connId)
+	s.Equal(connId, closed["connection_id"])
+	s.Equal("bob", closed["user_id"])
+	s.Equal("client", closed["closed_by"])
+	s.EqualValues(websocket.StatusNormalClosure, closed["close_code"])
+	s.Equal("bye", closed["close_reason"])
+	s.EqualValues(1, closed["messages_received"])
+	s.EqualValues(len("hello"), closed["bytes_received"])
+	s.EqualValues(0, closed["messages_sent"])
+	s.Contains(closed, "duration_ms")
+	s.NotContains(closed, "backend_caller")
+}
+
+func (s *auditTestSuite) TestRejectedConnection() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := s.connect(ctx, badCredential, "audit-rejected")
+	s.Error(err)
+
+	s.Eventually(func() bool {
+		return s.records("audit-rejected")["app_decision"] != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	records := s.records("audit-rejected")
+	s.Contains(records, "connect_attempted")
+	s.Equal(false, records["app_decision"]["accepted"])
+	s.EqualValues(http.StatusUnauthorized, records["app_decision"]["status_code"])
+	s.NotContains(records, "upgraded")
+}
@@ -0,0 +1,217 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const batchWsgwPort = 8106
+
+// The batches of batchedAppName are delivered once full, those of delayedAppName after their delay
+const (
+	batchedAppName     = "batched"
+	batchedMaxMessages = 5
+	delayedAppName     = "delayed"
+)
+
+type batchTestSuite struct {
+	suite.Suite
+	mockApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestBatchTestSuite(t *testing.T) {
+	suite.Run(t, &batchTestSuite{
+		logger: logging.Get().With().Str("unit", "TestBatchTestSuite").Logger(),
+	})
+}
+
+func (s *batchTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", batchWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	mockAppUrl := fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String())
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: batchWsgwPort,
+			Apps: []wsgw.AppConfig{
+				{
+					Name:            batchedAppName,
+					BaseUrl:         mockAppUrl,
+					MessageBatching: wsgw.MessageBatchingConfig{MaxMessages: batchedMaxMessages, MaxDelay: time.Minute},
+				},
+				{
+					Name:            delayedAppName,
+					BaseUrl:         mockAppUrl,
+					MessageBatching: wsgw.MessageBatchingConfig{MaxMessages: 100, MaxDelay: 50 * time.Millisecond},
+				},
+			},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+}
+
+func (s *batchTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+}
+
+func (s *batchTestSuite) connect(ctx context.Context, app string) *websocket.Conn {
+	c, _, err := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/%s", batchWsgwPort, app), defaultDialOptions)
+	s.Require().NoError(err)
+	return c
+}
+
+func (s *batchTestSuite) send(ctx context.Context, c *websocket.Conn, messages ...string) {
+	for _, msg := range messages {
+		s.Require().NoError(c.Write(ctx, websocket.MessageText, []byte(msg)))
+	}
+}
+
+// received returns the messages received by the mock app with the `prefix` as [connId, body, msgId]
+func (s *batchTestSuite) received(prefix string) [][]string {
+	var received [][]string
+	for _, msg := range s.mockApp.getMessagesReceived() {
+		if strings.HasPrefix(msg[1], prefix) {
+			received = append(received, msg)
+		}
+	}
+	return received
+}
+
+func (s *batchTestSuite) TestBatchIsDeliveredAfterMaxDelay() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := s.connect(ctx, delayedAppName)
+	defer c.Close(websocket.StatusNormalClosure, "")
+
+	batchesBefore := len(s.mockApp.getMessageBatchSizes())
+	s.send(ctx, c, "delayed-1", "delayed-2")
+
+	s.Eventually(func() bool { return len(s.received("delayed-")) == 2 }, 5*time.Second, 10*time.Millisecond)
+	received := s.received("delayed-")
+	s.Equal("delayed-1", received[0][1])
+	s.Equal("delayed-2", received[1][1])
+	s.Equal(received[0][0], received[1][0])
+	s.NotEqual(received[0][2], received[1][2])
+	s.Equal([]int{2}, s.mockApp.getMessageBatchSizes()[batchesBefore:])
+}
+
+func (s *batchTestSuite) TestBatchIsDeliveredOnceFull() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := s.connect(ctx, batchedAppName)
+	defer c.Close(websocket.StatusNormalClosure, "")
+
+	batchesBefore := len(s.mockApp.getMessageBatchSizes())
+	s.send(ctx, c, "full-1", "full-2", "full-3", "full-4")
+	s.Never(func() bool { return len(s.received("full-")) > 0 }, 200*time.Millisecond, 10*time.Millisecond)
+
+	s.send(ctx, c, "full-5")
+	s.Eventually(func() bool { return len(s.received("full-")) == batchedMaxMessages }, 5*time.Second, 10*time.Millisecond)
+	s.Equal([]int{batchedMaxMessages}, s.mockApp.getMessageBatchSizes()[batchesBefore:])
+}
+
+func (s *batchTestSuite) TestDeliveryFailuresAreMetered() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := s.connect(ctx, delayedAppName)
+	defer c.Close(websocket.StatusNormalClosure, "")
+	s.send(ctx, c, rejectedMessagePrefix+"batch")
+
+	s.Eventually(func() bool {
+		response, err := http.Get(fmt.Sprintf("http://localhost:%d/metrics", batchWsgwPort))
+		s.Require().NoError(err)
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		return strings.Contains(string(body), `wsgw_app_callback_failures_total{app="delayed",endpoint="message-received"} 1`)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (s *batchTestSuite) TestDisconnectionIsNotifiedAfterTheMessages() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _, err := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/%s", batchWsgwPort, delayedAppName), &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization":         []string{"some credentials"},
+			wsgw.RequestIDHeaderKey: []string{"batch-disconnect"},
+		},
+	})
+	s.Require().NoError(err)
+	s.send(ctx, c, "before-disconnect")
+	c.Close(websocket.StatusNormalClosure, "")
+
+	s.Eventually(func() bool {
+		for _, callback := range s.mockApp.getRequestIDs() {
+			if callback[0] == "disconnected" && callback[1] == "batch-disconnect" {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+	s.Len(s.received("before-disconnect"), 1)
+}
+
+func (s *batchTestSuite) TestMessagesOfEachConnectionStayInOrder() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	const clients = 3
+	const messagesPerClient = 20
+	batchesBefore := len(s.mockApp.getMessageBatchSizes())
+	var wg sync.WaitGroup
+	for i := range clients {
+		c := s.connect(ctx, batchedAppName)
+		defer c.Close(websocket.StatusNormalClosure, "")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range messagesPerClient {
+				s.NoError(c.Write(ctx, websocket.MessageText, []byte(fmt.Sprintf("ordered-%d-%d", i, j))))
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.Eventually(func() bool { return len(s.received("ordered-")) == clients*messagesPerClient }, 5*time.Second, 10*time.Millisecond)
+	next := map[string]int{}
+	connIds := map[string]string{}
+	for _, msg := range s.received("ordered-") {
+		var client, seq int
+		_, scanErr := fmt.Sscanf(msg[1], "ordered-%d-%d", &client, &seq)
+		s.Require().NoError(scanErr)
+		key := fmt.Sprint(client)
+		s.Equal(next[key], seq, "message %s out of order", msg[1])
+		next[key] = seq + 1
+		if connId, seen := connIds[key]; seen {
+			s.Equal(connId, msg[0])
+		}
+		connIds[key] = msg[0]
+	}
+
+	// The messages of the connections were mixed in full batches
+	for _, size := range s.mockApp.getMessageBatchSizes()[batchesBefore:] {
+		s.Equal(batchedMaxMessages, size)
+	}
+	s.Len(s.mockApp.getMessageBatchSizes()[batchesBefore:], clients*messagesPerClient/batchedMaxMessages)
+}
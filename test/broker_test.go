@@ -0,0 +1,313 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const (
+	brokerWsgwPort = 8104
+	// replacingBrokerWsgwPort is that of the gateway, whose events replace the callbacks
+	replacingBrokerWsgwPort = 8105
+	// stoppingBrokerWsgwPort is that of the gateway stopped while consuming commands
+	stoppingBrokerWsgwPort = 8111
+)
+
+type brokerTestSuite struct {
+	suite.Suite
+	natsServer         *natsserver.Server
+	nc                 *nats.Conn
+	mockApp            *mockApplication
+	wsGateway          *wsgw.Server
+	replacingWsGateway *wsgw.Server
+	logger             zerolog.Logger
+}
+
+func TestBrokerTestSuite(t *testing.T) {
+	suite.Run(t, &brokerTestSuite{
+		logger: logging.Get().With().Str("unit", "TestBrokerTestSuite").Logger(),
+	})
+}
+
+// brokerEvent is the JSON of the events published by the gateway
+type brokerEvent struct {
+	Type         string  `json:"type"`
+	App          string  `json:"app"`
+	ConnectionID string  `json:"connectionId"`
+	UserID       string  `json:"userId"`
+	RequestID    string  `json:"requestId"`
+	MessageID    string  `json:"messageId"`
+	Message      *string `json:"message"`
+}
+
+type brokerReply struct {
+	Queued bool   `json:"queued"`
+	Error  string `json:"error"`
+}
+
+func (s *brokerTestSuite) SetupSuite() {
+	natsServer, natsErr := natsserver.NewServer(&natsserver.Options{Host: "127.0.0.1", Port: natsserver.RANDOM_PORT, NoLog: true, NoSigs: true})
+	s.Require().NoError(natsErr)
+	go natsServer.Start()
+	s.Require().True(natsServer.ReadyForConnections(5 * time.Second))
+	s.natsServer = natsServer
+
+	nc, connErr := nats.Connect(natsServer.ClientURL())
+	s.Require().NoError(connErr)
+	s.nc = nc
+
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", brokerWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	mockAppUrl := fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String())
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: brokerWsgwPort,
+			AppBaseUrl: mockAppUrl,
+			Cluster:    wsgw.ClusterConfig{NodeID: "broker"},
+			Broker:     wsgw.BrokerConfig{Type: wsgw.NATSBrokerType, URL: natsServer.ClientURL()},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+	s.replacingWsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: replacingBrokerWsgwPort,
+			AppBaseUrl: mockAppUrl,
+			Cluster:    wsgw.ClusterConfig{NodeID: "replacing"},
+			Broker:     wsgw.BrokerConfig{Type: wsgw.NATSBrokerType, URL: natsServer.ClientURL(), SubjectPrefix: "replacing", ReplaceCallbacks: true},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway-replacing").Logger(),
+	)
+}
+
+func (s *brokerTestSuite) TearDownSuite() {
+	s.wsGateway.Stop()
+	s.replacingWsGateway.Stop()
+	s.mockApp.stop()
+	s.nc.Close()
+	s.natsServer.Shutdown()
+}
+
+func (s *brokerTestSuite) subscribe(subject string) *nats.Subscription {
+	sub, err := s.nc.SubscribeSync(subject)
+	s.Require().NoError(err)
+	s.Require().NoError(s.nc.Flush())
+	return sub
+}
+
+// nextEvent returns the next event of the given type, which `matches`, skipping the others
+func (s *brokerTestSuite) nextEvent(sub *nats.Subscription, eventType string, matches func(brokerEvent) bool) brokerEvent {
+	for {
+		msg, err := sub.NextMsg(5 * time.Second)
+		s.Require().NoError(err)
+		var event brokerEvent
+		s.Require().NoError(json.Unmarshal(msg.Data, &event))
+		s.True(strings.HasSuffix(msg.Subject, "."+event.Type), msg.Subject)
+		if event.Type == eventType && matches(event) {
+			return event
+		}
+	}
+}
+
+// connect connects a client as `userID` to the gateway at `port` and returns it along with its connection ID
+// taken from the `connected` event
+func (s *brokerTestSuite) connect(ctx context.Context, port int, prefix string, userID string, requestID string) (*websocket.Conn, string) {
+	sub := s.subscribe(prefix + ".default.connected")
+	defer sub.Unsubscribe()
+
+	c, _, err := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect", port), &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization":         []string{userCredentialPrefix + userID},
+			wsgw.RequestIDHeaderKey: []string{requestID},
+		},
+	})
+	s.Require().NoError(err)
+
+	connected := s.nextEvent(sub, "connected", func(e brokerEvent) bool { return e.UserID == userID })
+	s.Equal(wsgw.DefaultAppName, connected.App)
+	s.Equal(requestID, connected.RequestID)
+	s.NotEmpty(connected.ConnectionID)
+	return c, connected.ConnectionID
+}
+
+func (s *brokerTestSuite) command(command map[string]string) brokerReply {
+	data, _ := json.Marshal(command)
+	msg, err := s.nc.Request("wsgw.default.commands", data, 5*time.Second)
+	s.Require().NoError(err)
+	var reply brokerReply
+	s.Require().NoError(json.Unmarshal(msg.Data, &reply))
+	return reply
+}
+
+func (s *brokerTestSuite) read(ctx context.Context, c *websocket.Conn) string {
+	_, msg, err := c.Read(ctx)
+	s.Require().NoError(err)
+	return string(msg)
+}
+
+func (s *brokerTestSuite) TestBroadcastCommand() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	alice, _ := s.connect(ctx, brokerWsgwPort, "wsgw", "broker-broadcast-alice", "broker-broadcast-alice")
+	defer alice.Close(websocket.StatusNormalClosure, "")
+	bob, _ := s.connect(ctx, brokerWsgwPort, "wsgw", "broker-broadcast-bob", "broker-broadcast-bob")
+	defer bob.Close(websocket.StatusNormalClosure, "")
+
+	data, _ := json.Marshal(map[string]string{"type": "broadcast", "message": "hello everyone"})
+	s.Require().NoError(s.nc.Publish("wsgw.default.commands", data))
+	s.Equal("hello everyone", s.read(ctx, alice))
+	s.Equal("hello everyone", s.read(ctx, bob))
+}
+
+func (s *brokerTestSuite) TestCloseCommand() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, connId := s.connect(ctx, brokerWsgwPort, "wsgw", "broker-close-alice", "broker-close")
+	defer c.Close(websocket.StatusNormalClosure, "")
+
+	s.Empty(s.command(map[string]string{"type": "close", "connectionId": connId}).Error)
+	_, _, readErr := c.Read(ctx)
+	s.Equal(websocket.StatusNormalClosure, websocket.CloseStatus(readErr))
+}
+
+func (s *brokerTestSuite) TestConnectionEvents() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	sub := s.subscribe("wsgw.default.>")
+	defer sub.Unsubscribe()
+
+	c, connId := s.connect(ctx, brokerWsgwPort, "wsgw", "broker-events-alice", "broker-events")
+	ofConnection := func(e brokerEvent) bool { return e.ConnectionID == connId }
+
+	s.Require().NoError(c.Write(ctx, websocket.MessageText, []byte("hello broker")))
+	received := s.nextEvent(sub, "message-received", ofConnection)
+	s.Equal("broker-events", received.RequestID)
+	s.NotEmpty(received.MessageID)
+	s.Require().NotNil(received.Message)
+	s.Equal("hello broker", *received.Message)
+
+	c.Close(websocket.StatusNormalClosure, "")
+	disconnected := s.nextEvent(sub, "disconnected", ofConnection)
+	s.Equal("broker-events", disconnected.RequestID)
+
+	// The callbacks are sent besides
+	s.Eventually(func() bool {
+		endpoints := map[string]bool{}
+		for _, callback := range s.mockApp.getRequestIDs() {
+			if callback[1] == "broker-events" {
+				endpoints[callback[0]] = true
+			}
+		}
+		return len(endpoints) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (s *brokerTestSuite) TestEventsReplaceCallbacks() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	sub := s.subscribe("replacing.default.>")
+	defer sub.Unsubscribe()
+
+	c, connId := s.connect(ctx, replacingBrokerWsgwPort, "replacing", "broker-replacing-alice", "broker-replacing")
+	ofConnection := func(e brokerEvent) bool { return e.ConnectionID == connId }
+
+	s.Require().NoError(c.Write(ctx, websocket.MessageText, []byte("hello broker")))
+	s.nextEvent(sub, "message-received", ofConnection)
+	c.Close(websocket.StatusNormalClosure, "")
+	s.nextEvent(sub, "disconnected", ofConnection)
+
+	// Only the connecting callback was sent
+	var endpoints []string
+	for _, callback := range s.mockApp.getRequestIDs() {
+		if callback[1] == "broker-replacing" {
+			endpoints = append(endpoints, callback[0])
+		}
+	}
+	s.Equal([]string{"connecting"}, endpoints)
+}
+
+func (s *brokerTestSuite) TestPushCommand() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, connId := s.connect(ctx, brokerWsgwPort, "wsgw", "broker-push-alice", "broker-push")
+	defer c.Close(websocket.StatusNormalClosure, "")
+
+	reply := s.command(map[string]string{"type": "push", "connectionId": connId, "message": "hello alice"})
+	s.Empty(reply.Error)
+	s.False(reply.Queued)
+	s.Equal("hello alice", s.read(ctx, c))
+
+	s.Equal("connection not found", s.command(map[string]string{"type": "push", "connectionId": "unknown", "message": "hello"}).Error)
+	s.Equal("unknown command", s.command(map[string]string{"type": "shout", "message": "hello"}).Error)
+
+	// The commands addressing the connections of other nodes are left to them
+	data, _ := json.Marshal(map[string]string{"type": "push", "connectionId": "unknown.other", "message": "hello"})
+	_, requestErr := s.nc.Request("wsgw.default.commands", data, 200*time.Millisecond)
+	s.ErrorIs(requestErr, nats.ErrTimeout)
+}
+
+func (s *brokerTestSuite) TestStopAppliesTheConsumedCommands() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// The pushes are throttled for the commands to be still queued when the gateway is stopped
+	const commands = 200
+	mockAppUrl := fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String())
+	gateway := startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: stoppingBrokerWsgwPort,
+			Apps:       []wsgw.AppConfig{{Name: wsgw.DefaultAppName, BaseUrl: mockAppUrl, MessageBufferSize: commands, PushRateLimit: 400, PushBurst: 1}},
+			Cluster:    wsgw.ClusterConfig{NodeID: "stopping"},
+			Broker:     wsgw.BrokerConfig{Type: wsgw.NATSBrokerType, URL: s.natsServer.ClientURL(), SubjectPrefix: "stopping"},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway-stopping").Logger(),
+	)
+	c, connId := s.connect(ctx, stoppingBrokerWsgwPort, "stopping", "broker-stopping-alice", "broker-stopping")
+	defer c.Close(websocket.StatusNormalClosure, "")
+
+	for i := range commands {
+		data, _ := json.Marshal(map[string]string{"type": "push", "connectionId": connId, "message": fmt.Sprintf("message %d", i)})
+		s.Require().NoError(s.nc.Publish("stopping.default.commands", data))
+	}
+	s.Require().NoError(s.nc.Flush())
+	gateway.Stop()
+
+	for i := range commands {
+		s.Equal(fmt.Sprintf("message %d", i), s.read(ctx, c))
+	}
+}
+
+func (s *brokerTestSuite) TestPushToUserCommand() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _ := s.connect(ctx, brokerWsgwPort, "wsgw", "broker-user-alice", "broker-user")
+	defer c.Close(websocket.StatusNormalClosure, "")
+
+	data, _ := json.Marshal(map[string]string{"type": "push-to-user", "userId": "broker-user-alice", "message": "hello user"})
+	s.Require().NoError(s.nc.Publish("wsgw.default.commands", data))
+	s.Equal("hello user", s.read(ctx, c))
+}
@@ -0,0 +1,244 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const callbackPoolWsgwPort = 8107
+
+// The applications differ by the policy applied to the messages of the connections with a full callback queue
+const (
+	pausingAppName  = "pausing"
+	droppingAppName = "dropping"
+	closingAppName  = "closing"
+)
+
+type callbackPoolTestSuite struct {
+	suite.Suite
+	mockApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestCallbackPoolTestSuite(t *testing.T) {
+	suite.Run(t, &callbackPoolTestSuite{
+		logger: logging.Get().With().Str("unit", "TestCallbackPoolTestSuite").Logger(),
+	})
+}
+
+func (s *callbackPoolTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", callbackPoolWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	mockAppUrl := fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String())
+	app := func(name string, dispatch wsgw.CallbackDispatchConfig) wsgw.AppConfig {
+		return wsgw.AppConfig{Name: name, BaseUrl: mockAppUrl, CallbackDispatch: dispatch}
+	}
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: callbackPoolWsgwPort,
+			Apps: []wsgw.AppConfig{
+				app(pausingAppName, wsgw.CallbackDispatchConfig{Workers: 4, QueueSize: 2}),
+				app(droppingAppName, wsgw.CallbackDispatchConfig{Workers: 1, QueueSize: 1, WhenFull: wsgw.DropOnFullQueue}),
+				app(closingAppName, wsgw.CallbackDispatchConfig{Workers: 1, QueueSize: 1, WhenFull: wsgw.CloseOnFullQueue}),
+			},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+}
+
+func (s *callbackPoolTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+}
+
+// connect connects a client of `app` as `userID` with `requestID`
+func (s *callbackPoolTestSuite) connect(ctx context.Context, app string, userID string, requestID string) *websocket.Conn {
+	c, _, err := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/%s", callbackPoolWsgwPort, app), &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization":         []string{userCredentialPrefix + userID},
+			wsgw.RequestIDHeaderKey: []string{requestID},
+		},
+	})
+	s.Require().NoError(err)
+	return c
+}
+
+func (s *callbackPoolTestSuite) send(ctx context.Context, c *websocket.Conn, messages ...string) {
+	for _, msg := range messages {
+		s.Require().NoError(c.Write(ctx, websocket.MessageText, []byte(msg)))
+	}
+}
+
+// received returns the bodies of the messages received by the mock app, which contain `marker`, in order
+func (s *callbackPoolTestSuite) received(marker string) []string {
+	var received []string
+	for _, msg := range s.mockApp.getMessagesReceived() {
+		if strings.Contains(msg[1], marker) {
+			received = append(received, msg[1])
+		}
+	}
+	return received
+}
+
+// callbacks returns the endpoints called back for the connection opened with `requestID` in order
+func (s *callbackPoolTestSuite) callbacks(requestID string) []string {
+	var endpoints []string
+	for _, callback := range s.mockApp.getRequestIDs() {
+		if callback[1] == requestID {
+			endpoints = append(endpoints, callback[0])
+		}
+	}
+	return endpoints
+}
+
+// awaitSlowCallback waits for the callback for the slow message `msg` to be in flight
+func (s *callbackPoolTestSuite) awaitSlowCallback(msg string) {
+	s.Eventually(func() bool {
+		return slices.Contains(s.mockApp.getSlowCallbacks(), msg)
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+// inboundMessages returns the number of messages read from the clients of `app`
+func (s *callbackPoolTestSuite) inboundMessages(app string) int {
+	response, err := http.Get(fmt.Sprintf("http://localhost:%d/metrics", callbackPoolWsgwPort))
+	s.Require().NoError(err)
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	sample := fmt.Sprintf(`wsgw_messages_total{app="%s",direction="inbound"} `, app)
+	for _, line := range strings.Split(string(body), "\n") {
+		if value, found := strings.CutPrefix(line, sample); found {
+			count, _ := strconv.Atoi(value)
+			return count
+		}
+	}
+	return 0
+}
+
+// expectPush pushes a message to `userID` of `app` and expects it to reach the client before the slow
+// callback in flight is over
+func (s *callbackPoolTestSuite) expectPush(ctx context.Context, c *websocket.Conn, app string, userID string) {
+	response, pushErr := pushMessage(callbackPoolWsgwPort, "/apps/"+app+"/users/"+userID+"/message", "", "hello "+userID)
+	s.Require().NoError(pushErr)
+	s.Equal(http.StatusOK, response.StatusCode)
+
+	readCtx, cancelRead := context.WithTimeout(ctx, slowCallbackDelay/2)
+	defer cancelRead()
+	_, msg, readErr := c.Read(readCtx)
+	s.Require().NoError(readErr)
+	s.Equal("hello "+userID, string(msg))
+}
+
+func (s *callbackPoolTestSuite) TestFullQueueClosesConnection() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := s.connect(ctx, closingAppName, "closing-alice", "closing")
+	defer c.Close(websocket.StatusNormalClosure, "")
+
+	s.send(ctx, c, slowMessagePrefix+"closing-1")
+	// The first message is in flight, the second one waits, the third one overflows the queue
+	s.awaitSlowCallback(slowMessagePrefix + "closing-1")
+	s.send(ctx, c, "closing-2", "closing-3")
+
+	_, _, readErr := c.Read(ctx)
+	s.Equal(websocket.StatusTryAgainLater, websocket.CloseStatus(readErr))
+
+	// The messages queued are delivered before the disconnection
+	s.Eventually(func() bool {
+		return len(s.callbacks("closing")) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	s.Equal([]string{"connecting", "message-received", "message-received", "disconnected"}, s.callbacks("closing"))
+	s.Equal([]string{slowMessagePrefix + "closing-1", "closing-2"}, s.received("closing-"))
+}
+
+func (s *callbackPoolTestSuite) TestFullQueueDropsMessages() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := s.connect(ctx, droppingAppName, "dropping-alice", "dropping")
+	defer c.Close(websocket.StatusNormalClosure, "")
+
+	s.send(ctx, c, slowMessagePrefix+"dropping-1")
+	s.awaitSlowCallback(slowMessagePrefix + "dropping-1")
+	s.send(ctx, c, "dropping-2", "dropping-3", "dropping-4")
+
+	s.Eventually(func() bool { return len(s.received("dropping-")) == 2 }, 5*time.Second, 10*time.Millisecond)
+	s.Never(func() bool { return len(s.received("dropping-")) > 2 }, 200*time.Millisecond, 10*time.Millisecond)
+	s.Equal([]string{slowMessagePrefix + "dropping-1", "dropping-2"}, s.received("dropping-"))
+
+	// The connection is still served
+	s.send(ctx, c, "dropping-5")
+	s.Eventually(func() bool { return len(s.received("dropping-")) == 3 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func (s *callbackPoolTestSuite) TestFullQueuePausesReading() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := s.connect(ctx, pausingAppName, "pausing-alice", "pausing")
+	read := s.inboundMessages(pausingAppName)
+
+	messages := []string{slowMessagePrefix + "pausing-1", slowMessagePrefix + "pausing-2", "pausing-3", "pausing-4", "pausing-5"}
+	s.send(ctx, c, messages...)
+	s.awaitSlowCallback(messages[0])
+
+	// While the first message is in flight, the next two are queued and the fourth one is held back,
+	// the fifth one being left unread
+	s.Eventually(func() bool { return s.inboundMessages(pausingAppName) == read+4 }, slowCallbackDelay/2, 5*time.Millisecond)
+	s.Empty(s.received("pausing-"))
+	// The pushes flow nonetheless
+	s.expectPush(ctx, c, pausingAppName, "pausing-alice")
+	// Reading resumes only once the first callback is done
+	paused := true
+	s.Eventually(func() bool {
+		inbound := s.inboundMessages(pausingAppName)
+		if len(s.received("pausing-")) > 0 {
+			return true
+		}
+		paused = paused && inbound == read+4
+		return false
+	}, 5*time.Second, 5*time.Millisecond)
+	s.True(paused, "the fifth message was read while the queue was full")
+	c.Close(websocket.StatusNormalClosure, "")
+
+	// All messages are delivered in order, then the disconnection
+	s.Eventually(func() bool {
+		return len(s.callbacks("pausing")) == len(messages)+2
+	}, 5*time.Second, 10*time.Millisecond)
+	s.Equal(messages, s.received("pausing-"))
+	s.Equal("disconnected", s.callbacks("pausing")[len(messages)+1])
+}
+
+func (s *callbackPoolTestSuite) TestPushesFlowWhileCallbacksAreInFlight() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := s.connect(ctx, pausingAppName, "in-flight-alice", "in-flight")
+	defer c.Close(websocket.StatusNormalClosure, "")
+
+	s.send(ctx, c, slowMessagePrefix+"in-flight")
+	s.awaitSlowCallback(slowMessagePrefix + "in-flight")
+
+	s.expectPush(ctx, c, pausingAppName, "in-flight-alice")
+	s.Empty(s.received("in-flight"))
+
+	s.Eventually(func() bool { return len(s.received("in-flight")) == 1 }, 5*time.Second, 10*time.Millisecond)
+}
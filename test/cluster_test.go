@@ -0,0 +1,171 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const (
+	nodeAPort = 8083
+	nodeBPort = 8084
+)
+
+type clusterTestSuite struct {
+	suite.Suite
+	mockApp *mockApplication
+	nodeA   *wsgw.Server
+	nodeB   *wsgw.Server
+	logger  zerolog.Logger
+}
+
+func TestClusterTestSuite(t *testing.T) {
+	suite.Run(t, &clusterTestSuite{
+		logger: logging.Get().With().Str("unit", "TestClusterTestSuite").Logger(),
+	})
+}
+
+func (s *clusterTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", nodeAPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	peers := map[string]string{
+		"node-a": fmt.Sprintf("http://localhost:%d", nodeAPort),
+		"node-b": fmt.Sprintf("http://localhost:%d", nodeBPort),
+	}
+	nodeConfig := func(nodeID string, port int) wsgw.Config {
+		return wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: port,
+			AppBaseUrl: fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+			Cluster: wsgw.ClusterConfig{
+				NodeID:    nodeID,
+				Peers:     peers,
+				SharedKey: "cluster-key",
+			},
+		}
+	}
+
+	s.nodeA = startWsGateway(nodeConfig("node-a", nodeAPort), s.logger.With().Str("node", "node-a").Logger())
+	s.nodeB = startWsGateway(nodeConfig("node-b", nodeBPort), s.logger.With().Str("node", "node-b").Logger())
+}
+
+func (s *clusterTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.nodeA.Stop()
+	s.nodeB.Stop()
+}
+
+func (s *clusterTestSuite) connectToNodeA(ctx context.Context) (*websocket.Conn, string, error) {
+	c, _, err := connectToWs(ctx, nodeAPort, defaultDialOptions)
+	if err != nil {
+		return nil, "", err
+	}
+	return c, s.mockApp.getDataReceived()[0][2], nil
+}
+
+func (s *clusterTestSuite) TestPushThroughOtherNode() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, connId, err := s.connectToNodeA(ctx)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	defer c.Close(websocket.StatusNormalClosure, "we're done")
+
+	s.True(strings.HasSuffix(connId, ".node-a"))
+
+	response, err := pushMessage(nodeBPort, "/message/"+connId, "", "hello via node-b")
+	s.NoError(err)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+
+	_, msg, readErr := c.Read(ctx)
+	s.NoError(readErr)
+	s.Equal("hello via node-b", string(msg))
+}
+
+func (s *clusterTestSuite) TestCloseThroughOtherNode() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, connId, err := s.connectToNodeA(ctx)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+
+	request, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://localhost:%d/connections/%s", nodeBPort, connId), nil)
+	response, err := http.DefaultClient.Do(request)
+	s.NoError(err)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+
+	_, _, readErr := c.Read(ctx)
+	s.Equal(websocket.StatusNormalClosure, websocket.CloseStatus(readErr))
+}
+
+func (s *clusterTestSuite) TestBroadcastReachesAllNodes() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _, err := s.connectToNodeA(ctx)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	defer c.Close(websocket.StatusNormalClosure, "we're done")
+
+	response, err := pushMessage(nodeBPort, "/broadcast", "", "hello everyone")
+	s.NoError(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+	var result struct {
+		Recipients int `json:"recipients"`
+	}
+	s.NoError(json.NewDecoder(response.Body).Decode(&result))
+	s.Equal(1, result.Recipients)
+
+	_, msg, readErr := c.Read(ctx)
+	s.NoError(readErr)
+	s.Equal("hello everyone", string(msg))
+}
+
+func (s *clusterTestSuite) TestForgedForwardedHeaderIsIgnored() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _, err := s.connectToNodeA(ctx)
+	s.Require().NoError(err)
+	defer c.Close(websocket.StatusNormalClosure, "we're done")
+
+	// A broadcast passed off as forwarded by another node is still forwarded to the peers
+	request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:%d/broadcast", nodeBPort), strings.NewReader(`"hello again"`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(wsgw.ForwardedByHeaderKey, "node-a")
+	request.Header.Set(wsgw.ClusterKeyHeaderKey, "guessed-key")
+	response, err := http.DefaultClient.Do(request)
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+
+	_, msg, readErr := c.Read(ctx)
+	s.NoError(readErr)
+	s.Equal("hello again", string(msg))
+}
+
+func (s *clusterTestSuite) TestPushToUnknownNode() {
+	response, err := pushMessage(nodeBPort, "/message/cn0ljd4lsl9k8ug6n2ng.node-x", "", "nobody home")
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, response.StatusCode)
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// exportedSpan is what the tests check of the spans exported to the collector stub
+type exportedSpan struct {
+	name         string
+	traceID      string
+	spanID       string
+	parentSpanID string
+}
+
+// collectorStub accepts the spans exported over OTLP/HTTP in the protobuf encoding
+type collectorStub struct {
+	listener net.Listener
+	spansMu  sync.Mutex
+	spans    []exportedSpan
+}
+
+func startCollectorStub() (*collectorStub, error) {
+	listener, listenErr := net.Listen("tcp", "localhost:0")
+	if listenErr != nil {
+		return nil, listenErr
+	}
+	collector := &collectorStub{listener: listener}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/traces", collector.export)
+	go http.Serve(listener, mux)
+
+	return collector, nil
+}
+
+func (c *collectorStub) endpoint() string {
+	return "http://" + c.listener.Addr().String()
+}
+
+func (c *collectorStub) stop() {
+	c.listener.Close()
+}
+
+func (c *collectorStub) export(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, gzipErr := gzip.NewReader(r.Body)
+		if gzipErr != nil {
+			http.Error(w, gzipErr.Error(), http.StatusBadRequest)
+			return
+		}
+		body = gzipReader
+	}
+	encoded, readErr := io.ReadAll(body)
+	if readErr != nil {
+		http.Error(w, readErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request collectortrace.ExportTraceServiceRequest
+	if unmarshalErr := proto.Unmarshal(encoded, &request); unmarshalErr != nil {
+		http.Error(w, unmarshalErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.spansMu.Lock()
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				c.spans = append(c.spans, exportedSpan{
+					name:         span.Name,
+					traceID:      hex.EncodeToString(span.TraceId),
+					spanID:       hex.EncodeToString(span.SpanId),
+					parentSpanID: hex.EncodeToString(span.ParentSpanId),
+				})
+			}
+		}
+	}
+	c.spansMu.Unlock()
+
+	response, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(response)
+}
+
+// span returns the first span exported with `name` in the trace, if any
+func (c *collectorStub) span(traceID string, name string) (exportedSpan, bool) {
+	c.spansMu.Lock()
+	defer c.spansMu.Unlock()
+
+	for _, span := range c.spans {
+		if span.traceID == traceID && span.name == name {
+			return span, true
+		}
+	}
+	return exportedSpan{}, false
+}
@@ -0,0 +1,193 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/config"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type configTestSuite struct {
+	suite.Suite
+}
+
+func TestConfigTestSuite(t *testing.T) {
+	suite.Run(t, &configTestSuite{})
+}
+
+func (s *configTestSuite) writeFile(name string, content string) string {
+	path := filepath.Join(s.T().TempDir(), name)
+	s.Require().NoError(os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+const yamlConfig = `
+serverHost: localhost
+appBaseUrl: http://localhost:9000
+apps:
+  - name: chat
+    baseUrl: https://chat.example.com
+    backendApiKeys: [key-1, key-2]
+    disconnect_grace_period: 30s
+    offlineQueue:
+      ttl: 2m
+      maxMessages: 50
+cluster:
+  nodeID: node1
+  peers:
+    node2: http://node2:8080
+registry:
+  type: redis
+  redisAddress: localhost:6379
+`
+
+const tomlConfig = `
+ServerHost = "localhost"
+AppBaseUrl = "http://localhost:9000"
+
+[[Apps]]
+Name = "chat"
+BaseUrl = "https://chat.example.com"
+BackendAPIKeys = ["key-1", "key-2"]
+DisconnectGracePeriod = "30s"
+OfflineQueue = { TTL = "2m", MaxMessages = 50 }
+
+[Cluster]
+NodeID = "node1"
+Peers = { node2 = "http://node2:8080" }
+
+[Registry]
+Type = "redis"
+RedisAddress = "localhost:6379"
+`
+
+func (s *configTestSuite) assertFileConfig(conf wsgw.Config) {
+	s.Equal("localhost", conf.ServerHost)
+	s.Equal(config.DefaultServerPort, conf.ServerPort)
+	s.Equal("http://localhost:9000", conf.AppBaseUrl)
+	s.Require().Len(conf.Apps, 1)
+	s.Equal("chat", conf.Apps[0].Name)
+	s.Equal([]string{"key-1", "key-2"}, conf.Apps[0].BackendAPIKeys)
+	s.Equal(30*time.Second, conf.Apps[0].DisconnectGracePeriod)
+	s.Equal(2*time.Minute, conf.Apps[0].OfflineQueue.TTL)
+	s.Equal(50, conf.Apps[0].OfflineQueue.MaxMessages)
+	s.Equal(map[string]string{"node2": "http://node2:8080"}, conf.Cluster.Peers)
+	s.Equal(wsgw.RedisRegistryType, conf.Registry.Type)
+}
+
+func (s *configTestSuite) TestDefaults() {
+	conf, err := config.Load(config.Sources{})
+	s.Require().NoError(err)
+	s.Equal(config.Defaults(), conf)
+}
+
+func (s *configTestSuite) TestEnvironmentOverridesFile() {
+	conf, err := config.Load(config.Sources{
+		File: s.writeFile("config.yaml", yamlConfig),
+		Environ: []string{
+			"HOME=/root",
+			"WSGW_SERVER_PORT=9090",
+			"WSGW_APPS__0__BACKEND_API_KEYS=key-3",
+			"WSGW_APPS__1__NAME=admin",
+			"WSGW_APPS__1__BASE_URL=http://admin",
+			"WSGW_REGISTRY__REDIS_PASSWORD=secret",
+		},
+	})
+	s.Require().NoError(err)
+	s.Equal(9090, conf.ServerPort)
+	s.Equal([]string{"key-3"}, conf.Apps[0].BackendAPIKeys)
+	s.Equal(30*time.Second, conf.Apps[0].DisconnectGracePeriod)
+	s.Require().Len(conf.Apps, 2)
+	s.Equal("admin", conf.Apps[1].Name)
+	s.Equal("secret", conf.Registry.RedisPassword)
+}
+
+func (s *configTestSuite) TestOverridesTakePrecedence() {
+	conf, err := config.Load(config.Sources{
+		File:      s.writeFile("config.toml", tomlConfig),
+		Environ:   []string{"WSGW_SERVER_PORT=9090", "WSGW_APPS__0__PUSH_RATE_LIMIT=2.5"},
+		Overrides: []string{"ServerPort=9191", "Apps.0.PushBurst=4", "Cluster.Peers.node3=http://node3:8080"},
+	})
+	s.Require().NoError(err)
+	s.Equal(9191, conf.ServerPort)
+	s.Equal(2.5, conf.Apps[0].PushRateLimit)
+	s.Equal(4, conf.Apps[0].PushBurst)
+	s.Equal("http://node3:8080", conf.Cluster.Peers["node3"])
+}
+
+func (s *configTestSuite) TestRejectsInvalidConfiguration() {
+	_, err := config.Load(config.Sources{Overrides: []string{"AppBaseUrl=localhost:9000"}})
+	s.ErrorContains(err, "AppBaseUrl")
+
+	_, err = config.Load(config.Sources{Environ: []string{"WSGW_SERVER_PORT=http"}})
+	s.ErrorContains(err, "WSGW_SERVER_PORT")
+
+	_, err = config.Load(config.Sources{Overrides: []string{"Apps.0.BaseUrl=http://app", "Apps.0.MessageFormat=xml"}})
+	s.ErrorContains(err, "MessageFormat")
+
+	_, err = config.Load(config.Sources{Overrides: []string{"Apps.0.BaseUrl=http://app", "Apps.0.Name=sse"}})
+	s.ErrorContains(err, `Apps[0].Name: "sse" is reserved`)
+	_, err = config.Load(config.Sources{Overrides: []string{"Apps.0.BaseUrl=http://app", "Apps.0.Name=poll"}})
+	s.ErrorContains(err, `Apps[0].Name: "poll" is reserved`)
+
+	_, err = config.Load(config.Sources{Overrides: []string{"Broker.Type=nats"}})
+	s.ErrorContains(err, "Cluster.NodeID")
+
+	_, err = config.Load(config.Sources{Overrides: []string{"Registry.Type=redis", "Registry.RedisAddress=localhost:6379"}})
+	s.ErrorContains(err, "Cluster.NodeID is required by the redis registry")
+
+	grpcWithAPIKeys := []string{"GRPC.ServerPort=9090", "Apps.0.BaseUrl=http://app", "Apps.0.BackendAPIKeys.0=secret"}
+	_, err = config.Load(config.Sources{Overrides: grpcWithAPIKeys})
+	s.ErrorContains(err, "GRPC.CertFile")
+	_, err = config.Load(config.Sources{Overrides: append(grpcWithAPIKeys, "GRPC.ServerHost=127.0.0.1")})
+	s.NoError(err)
+
+	_, err = config.Load(config.Sources{Overrides: []string{"GRPC.ServerPort=9090", "GRPC.CertFile=cert.pem"}})
+	s.ErrorContains(err, "GRPC.CertFile and GRPC.KeyFile must be set together")
+
+	_, err = config.Load(config.Sources{File: s.writeFile("config.yaml", "apps:\n  - name: chat\n    baseUrl: http://app\n    gracePeriod: 1s\n")})
+	s.ErrorContains(err, "unknown option: apps.0.gracePeriod")
+
+	_, err = config.Load(config.Sources{File: s.writeFile("config.yaml", "apps:\n  - name: chat\n    baseUrl: http://app\n    resumeWindow: 60\n")})
+	s.ErrorContains(err, "expected a duration")
+
+	_, err = config.Load(config.Sources{File: s.writeFile("config.json", "{}")})
+	s.ErrorContains(err, "unknown configuration file format")
+}
+
+func (s *configTestSuite) TestTOMLFile() {
+	conf, err := config.Load(config.Sources{File: s.writeFile("config.toml", tomlConfig)})
+	s.Require().NoError(err)
+	s.assertFileConfig(conf)
+}
+
+func (s *configTestSuite) TestYAMLFile() {
+	conf, err := config.Load(config.Sources{File: s.writeFile("config.yaml", yamlConfig)})
+	s.Require().NoError(err)
+	s.assertFileConfig(conf)
+}
+
+func (s *configTestSuite) TestWatchFile() {
+	path := s.writeFile("config.yaml", yamlConfig)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var changes atomic.Int32
+	s.Require().NoError(config.Watch(ctx, path, func() { changes.Add(1) }))
+
+	s.Require().NoError(os.WriteFile(path, []byte(yamlConfig), 0o600))
+	s.Require().NoError(os.WriteFile(path, []byte(yamlConfig+"serverPort: 9090\n"), 0o600))
+	s.Eventually(func() bool { return changes.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// Files replaced by renaming are followed
+	replacement := filepath.Join(filepath.Dir(path), "config.yaml.new")
+	s.Require().NoError(os.WriteFile(replacement, []byte(yamlConfig+"serverPort: 9191\n"), 0o600))
+	s.Require().NoError(os.Rename(replacement, path))
+	s.Eventually(func() bool { return changes.Load() == 2 }, 5*time.Second, 10*time.Millisecond)
+}
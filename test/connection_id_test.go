@@ -0,0 +1,100 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const signedIDsWsgwPort = 8087
+
+type signedConnectionIDTestSuite struct {
+	suite.Suite
+	mockApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestSignedConnectionIDTestSuite(t *testing.T) {
+	suite.Run(t, &signedConnectionIDTestSuite{
+		logger: logging.Get().With().Str("unit", "TestSignedConnectionIDTestSuite").Logger(),
+	})
+}
+
+func (s *signedConnectionIDTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", signedIDsWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	appBaseUrl := fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String())
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: signedIDsWsgwPort,
+			Apps: []wsgw.AppConfig{
+				{Name: "alpha", BaseUrl: appBaseUrl},
+				{Name: "beta", BaseUrl: appBaseUrl},
+			},
+			ConnectionIDs: wsgw.ConnectionIDConfig{
+				Generator:   wsgw.ULIDGenerator,
+				SigningKeys: []string{"current-key", "previous-key"},
+			},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+}
+
+func (s *signedConnectionIDTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+}
+
+func (s *signedConnectionIDTestSuite) TestOnlyGenuineIDsAreAccepted() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _, err := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/alpha", signedIDsWsgwPort), defaultDialOptions)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	defer c.Close(websocket.StatusNormalClosure, "we're done")
+	connId := s.mockApp.getDataReceived()[0][2]
+
+	parts := strings.Split(connId, ".")
+	if !s.Len(parts, 3) {
+		return
+	}
+	_, ulidErr := ulid.ParseStrict(parts[0])
+	s.NoError(ulidErr)
+	s.Empty(parts[1])
+
+	forgedId := ulid.Make().String() + "." + parts[1] + "." + parts[2]
+	response, err := pushMessage(signedIDsWsgwPort, "/apps/alpha/message/"+forgedId, "", "forged")
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, response.StatusCode)
+
+	response, err = pushMessage(signedIDsWsgwPort, "/apps/beta/message/"+connId, "", "other tenant")
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, response.StatusCode)
+
+	s.Eventually(func() bool {
+		response, err = pushMessage(signedIDsWsgwPort, "/apps/alpha/message/"+connId, "", "genuine")
+		return err == nil && response.StatusCode == http.StatusNoContent
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, msg, readErr := c.Read(ctx)
+	s.NoError(readErr)
+	s.Equal("genuine", string(msg))
+}
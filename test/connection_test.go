@@ -76,7 +76,7 @@ func (s *connectingTestSuite) TearDownSuite() {
 }
 
 func (s *connectingTestSuite) GetReceivedConnectionId(callIndex int) string {
-	testDataReceived := s.mockApp.dataReceived
+	testDataReceived := s.mockApp.getDataReceived()
 	if len(testDataReceived) <= callIndex {
 		return ""
 	}
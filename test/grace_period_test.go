@@ -0,0 +1,159 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+const gracePeriodWsgwPort = 8089
+
+const testGracePeriod = time.Second
+
+type gracePeriodTestSuite struct {
+	suite.Suite
+	mockApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestGracePeriodTestSuite(t *testing.T) {
+	suite.Run(t, &gracePeriodTestSuite{
+		logger: logging.Get().With().Str("unit", "TestGracePeriodTestSuite").Logger(),
+	})
+}
+
+func (s *gracePeriodTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", gracePeriodWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: gracePeriodWsgwPort,
+			Apps: []wsgw.AppConfig{
+				{
+					Name:                  wsgw.DefaultAppName,
+					BaseUrl:               fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+					MessageFormat:         wsgw.JSONEnvelopeMessageFormat,
+					DisconnectGracePeriod: testGracePeriod,
+				},
+			},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+}
+
+func (s *gracePeriodTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+}
+
+func (s *gracePeriodTestSuite) read(ctx context.Context, c *websocket.Conn) sessionEnvelope {
+	var envelope sessionEnvelope
+	s.NoError(wsjson.Read(ctx, c, &envelope))
+	return envelope
+}
+
+func (s *gracePeriodTestSuite) push(connId string, message string) int {
+	response, err := pushMessage(gracePeriodWsgwPort, "/message/"+connId, "", message)
+	s.NoError(err)
+	return response.StatusCode
+}
+
+func (s *gracePeriodTestSuite) TestReconnectWithinGracePeriodRebindsConnection() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _, err := connectToWs(ctx, gracePeriodWsgwPort, defaultDialOptions)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	session := s.read(ctx, c)
+	s.NotEmpty(session.ResumeToken)
+
+	c.Close(websocket.StatusGoingAway, "switching networks")
+	// The connection is held, so messages pushed in the meantime are queued
+	s.Eventually(func() bool {
+		return s.push(session.ConnectionID, "while away") == http.StatusNoContent
+	}, testGracePeriod/2, 10*time.Millisecond)
+
+	rebound, _, err := websocket.Dial(
+		ctx,
+		fmt.Sprintf("ws://localhost:%d/connect?resume=%s", gracePeriodWsgwPort, session.ResumeToken),
+		defaultDialOptions,
+	)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	defer rebound.Close(websocket.StatusNormalClosure, "we're done")
+
+	reboundSession := s.read(ctx, rebound)
+	s.True(reboundSession.Resumed)
+	s.Equal(session.ConnectionID, reboundSession.ConnectionID)
+	s.Equal("while away", s.read(ctx, rebound).Data)
+
+	// The application is not involved in rebinding
+	s.Never(func() bool {
+		return len(s.mockApp.getDataReceived()) > 1
+	}, testGracePeriod+200*time.Millisecond, 10*time.Millisecond)
+	s.Equal([][]string{{"POST /ws/connecting", wsgw.ConnectionIDHeaderKey, session.ConnectionID}}, s.mockApp.getDataReceived())
+
+	s.Equal(http.StatusNoContent, s.push(session.ConnectionID, "back"))
+	s.Equal("back", s.read(ctx, rebound).Data)
+}
+
+func (s *gracePeriodTestSuite) TestAppIsNotifiedAfterGracePeriod() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _, err := connectToWs(ctx, gracePeriodWsgwPort, defaultDialOptions)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	session := s.read(ctx, c)
+	lostAt := time.Now()
+	c.Close(websocket.StatusGoingAway, "gone for good")
+
+	s.Eventually(func() bool {
+		return len(s.mockApp.getDataReceived()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	s.GreaterOrEqual(time.Since(lostAt), testGracePeriod)
+	s.Equal([]string{"POST /ws/disconnected", wsgw.ConnectionIDHeaderKey, session.ConnectionID}, s.mockApp.getDataReceived()[1])
+
+	s.Equal(http.StatusNotFound, s.push(session.ConnectionID, "too late"))
+}
+
+func (s *gracePeriodTestSuite) TestNormalClosureIsNotHeld() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _, err := connectToWs(ctx, gracePeriodWsgwPort, defaultDialOptions)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	session := s.read(ctx, c)
+	closedAt := time.Now()
+	c.Close(websocket.StatusNormalClosure, "bye")
+
+	s.Eventually(func() bool {
+		return len(s.mockApp.getDataReceived()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	s.Less(time.Since(closedAt), testGracePeriod)
+	s.Equal(session.ConnectionID, s.mockApp.getDataReceived()[1][2])
+}
@@ -0,0 +1,379 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/grpcapi"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"nhooyr.io/websocket"
+)
+
+const (
+	grpcWsgwPort    = 8102
+	grpcPort        = 8103
+	grpcTLSWsgwPort = 8109
+	grpcTLSPort     = 8110
+)
+
+// grpcAppName is the application, whose backends authenticate with grpcAPIKey
+const (
+	grpcAppName = "chat"
+	grpcAPIKey  = "grpc-secret"
+)
+
+type grpcTestSuite struct {
+	suite.Suite
+	mockApp    *mockApplication
+	wsGateway  *wsgw.Server
+	clientConn *grpc.ClientConn
+	client     grpcapi.GatewayClient
+	logger     zerolog.Logger
+}
+
+func TestGRPCTestSuite(t *testing.T) {
+	suite.Run(t, &grpcTestSuite{
+		logger: logging.Get().With().Str("unit", "TestGRPCTestSuite").Logger(),
+	})
+}
+
+func (s *grpcTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", grpcWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	mockAppUrl := fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String())
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: grpcWsgwPort,
+			AppBaseUrl: mockAppUrl,
+			Apps: []wsgw.AppConfig{
+				{
+					Name:           grpcAppName,
+					BaseUrl:        mockAppUrl,
+					BackendAPIKeys: []string{grpcAPIKey},
+					Transport:      wsgw.AppTransportConfig{RequestTimeout: time.Second},
+				},
+			},
+			GRPC: wsgw.GRPCConfig{ServerHost: "localhost", ServerPort: grpcPort},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+
+	clientConn, dialErr := grpc.NewClient(fmt.Sprintf("localhost:%d", grpcPort), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	s.Require().NoError(dialErr)
+	s.clientConn = clientConn
+	s.client = grpcapi.NewGatewayClient(clientConn)
+}
+
+func (s *grpcTestSuite) TearDownSuite() {
+	s.clientConn.Close()
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+}
+
+// withAPIKey authenticates the calls in the context as a backend of grpcAppName
+func withAPIKey(ctx context.Context, apiKey string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+apiKey)
+}
+
+// connect connects a client of the default application as `userID` and returns it along with its connection ID
+func (s *grpcTestSuite) connect(ctx context.Context, userID string) (*websocket.Conn, string) {
+	c, _, err := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect", grpcWsgwPort), &websocket.DialOptions{
+		HTTPHeader: http.Header{"Authorization": []string{userCredentialPrefix + userID}},
+	})
+	s.Require().NoError(err)
+
+	listed, listErr := s.client.ListConnections(ctx, &grpcapi.ListConnectionsRequest{UserId: userID})
+	s.Require().NoError(listErr)
+	s.Require().Len(listed.Connections, 1)
+	s.Equal(wsgw.DefaultAppName, listed.Connections[0].App)
+	return c, listed.Connections[0].Id
+}
+
+func (s *grpcTestSuite) read(ctx context.Context, c *websocket.Conn) string {
+	_, msg, err := c.Read(ctx)
+	s.Require().NoError(err)
+	return string(msg)
+}
+
+// subscribe opens an event stream for the events of grpcAppName
+func (s *grpcTestSuite) subscribe(ctx context.Context) grpc.BidiStreamingClient[grpcapi.EventsRequest, grpcapi.Event] {
+	stream, err := s.client.Events(withAPIKey(ctx, grpcAPIKey))
+	s.Require().NoError(err)
+	s.Require().NoError(stream.Send(&grpcapi.EventsRequest{Request: &grpcapi.EventsRequest_Subscribe{Subscribe: &grpcapi.Subscribe{App: grpcAppName}}}))
+	return stream
+}
+
+// unsubscribe ends the event stream and waits for the gateway to end it too, so that no events of
+// the following tests go to it
+func (s *grpcTestSuite) unsubscribe(stream grpc.BidiStreamingClient[grpcapi.EventsRequest, grpcapi.Event]) {
+	s.NoError(stream.CloseSend())
+	for {
+		if _, err := stream.Recv(); err != nil {
+			return
+		}
+	}
+}
+
+// writeCertificate writes a self-signed certificate for localhost and its key to PEM files in a temporary
+// directory and returns their paths along with the certificate
+func (s *grpcTestSuite) writeCertificate() (string, string, *x509.Certificate) {
+	key, keyErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.Require().NoError(keyErr)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, certErr := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	s.Require().NoError(certErr)
+	cert, parseErr := x509.ParseCertificate(der)
+	s.Require().NoError(parseErr)
+	keyDer, marshalErr := x509.MarshalECPrivateKey(key)
+	s.Require().NoError(marshalErr)
+
+	dir := s.T().TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	s.Require().NoError(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	s.Require().NoError(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return certFile, keyFile, cert
+}
+
+func (s *grpcTestSuite) TestTLS() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	certFile, keyFile, cert := s.writeCertificate()
+	mockAppUrl := fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String())
+	gateway := startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: grpcTLSWsgwPort,
+			Apps: []wsgw.AppConfig{
+				{Name: grpcAppName, BaseUrl: mockAppUrl, BackendAPIKeys: []string{grpcAPIKey}},
+			},
+			GRPC: wsgw.GRPCConfig{ServerHost: "localhost", ServerPort: grpcTLSPort, CertFile: certFile, KeyFile: keyFile},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway-tls").Logger(),
+	)
+	defer gateway.Stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	tlsConn, dialErr := grpc.NewClient(fmt.Sprintf("localhost:%d", grpcTLSPort), grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(roots, "localhost")))
+	s.Require().NoError(dialErr)
+	defer tlsConn.Close()
+	listed, listErr := grpcapi.NewGatewayClient(tlsConn).ListConnections(withAPIKey(ctx, grpcAPIKey), &grpcapi.ListConnectionsRequest{App: grpcAppName})
+	s.Require().NoError(listErr)
+	s.Empty(listed.Connections)
+
+	plaintextConn, dialErr := grpc.NewClient(fmt.Sprintf("localhost:%d", grpcTLSPort), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	s.Require().NoError(dialErr)
+	defer plaintextConn.Close()
+	_, listErr = grpcapi.NewGatewayClient(plaintextConn).ListConnections(withAPIKey(ctx, grpcAPIKey), &grpcapi.ListConnectionsRequest{App: grpcAppName})
+	s.Equal(codes.Unavailable, status.Code(listErr))
+}
+
+func (s *grpcTestSuite) TestBroadcast() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	alice, _ := s.connect(ctx, "broadcast-alice")
+	defer alice.Close(websocket.StatusNormalClosure, "")
+	bob, _ := s.connect(ctx, "broadcast-bob")
+	defer bob.Close(websocket.StatusNormalClosure, "")
+
+	response, err := s.client.Broadcast(ctx, &grpcapi.BroadcastRequest{Message: "hello everyone"})
+	s.Require().NoError(err)
+	s.Equal(int32(2), response.Recipients)
+	s.Equal("hello everyone", s.read(ctx, alice))
+	s.Equal("hello everyone", s.read(ctx, bob))
+}
+
+func (s *grpcTestSuite) TestCloseConnection() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, connId := s.connect(ctx, "close-alice")
+	defer c.Close(websocket.StatusNormalClosure, "")
+
+	_, err := s.client.CloseConnection(ctx, &grpcapi.CloseConnectionRequest{ConnectionId: connId})
+	s.Require().NoError(err)
+	_, _, readErr := c.Read(ctx)
+	s.Equal(websocket.StatusNormalClosure, websocket.CloseStatus(readErr))
+
+	s.Eventually(func() bool {
+		listed, listErr := s.client.ListConnections(ctx, &grpcapi.ListConnectionsRequest{UserId: "close-alice"})
+		return listErr == nil && len(listed.Connections) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = s.client.CloseConnection(ctx, &grpcapi.CloseConnectionRequest{ConnectionId: connId})
+	s.Equal(codes.NotFound, status.Code(err))
+}
+
+func (s *grpcTestSuite) TestEvents() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	stream := s.subscribe(ctx)
+	defer s.unsubscribe(stream)
+
+	type dialResult struct {
+		conn *websocket.Conn
+		err  error
+	}
+	dialed := make(chan dialResult, 1)
+	go func() {
+		c, _, err := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/%s", grpcWsgwPort, grpcAppName), &websocket.DialOptions{
+			HTTPHeader: http.Header{
+				"Authorization":         []string{"some credentials"},
+				wsgw.RequestIDHeaderKey: []string{"grpc-events"},
+			},
+		})
+		dialed <- dialResult{c, err}
+	}()
+
+	event, recvErr := stream.Recv()
+	s.Require().NoError(recvErr)
+	connecting := event.GetConnecting()
+	s.Require().NotNil(connecting)
+	s.Equal("grpc-events", connecting.RequestId)
+	s.Equal("some credentials", connecting.Headers["Authorization"])
+	s.NotContains(connecting.Headers, "Upgrade")
+	s.NotContains(connecting.Headers, "Sec-Websocket-Key")
+	s.NotContains(connecting.Headers, wsgw.RequestIDHeaderKey)
+	s.NoError(stream.Send(&grpcapi.EventsRequest{Request: &grpcapi.EventsRequest_Decision{Decision: &grpcapi.ConnectingDecision{
+		ConnectionId: connecting.ConnectionId,
+		Accept:       true,
+		UserId:       "events-alice",
+	}}}))
+
+	result := <-dialed
+	s.Require().NoError(result.err)
+
+	listed, listErr := s.client.ListConnections(withAPIKey(ctx, grpcAPIKey), &grpcapi.ListConnectionsRequest{App: grpcAppName, UserId: "events-alice"})
+	s.Require().NoError(listErr)
+	s.Require().Len(listed.Connections, 1)
+	s.Equal(connecting.ConnectionId, listed.Connections[0].Id)
+
+	s.Require().NoError(result.conn.Write(ctx, websocket.MessageText, []byte("hello backend")))
+	event, recvErr = stream.Recv()
+	s.Require().NoError(recvErr)
+	received := event.GetMessageReceived()
+	s.Require().NotNil(received)
+	s.Equal(connecting.ConnectionId, received.ConnectionId)
+	s.Equal("grpc-events", received.RequestId)
+	s.Equal("hello backend", received.Message)
+	s.NotEmpty(received.MessageId)
+
+	result.conn.Close(websocket.StatusNormalClosure, "")
+	event, recvErr = stream.Recv()
+	s.Require().NoError(recvErr)
+	s.Equal(connecting.ConnectionId, event.GetDisconnected().GetConnectionId())
+
+	// The application was not called back
+	for _, callback := range s.mockApp.getRequestIDs() {
+		s.NotEqual("grpc-events", callback[1])
+	}
+}
+
+func (s *grpcTestSuite) TestEventsRejectConnection() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	stream := s.subscribe(ctx)
+	defer s.unsubscribe(stream)
+
+	dialed := make(chan *http.Response, 1)
+	go func() {
+		_, response, _ := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/%s", grpcWsgwPort, grpcAppName), defaultDialOptions)
+		dialed <- response
+	}()
+
+	event, recvErr := stream.Recv()
+	s.Require().NoError(recvErr)
+	s.NoError(stream.Send(&grpcapi.EventsRequest{Request: &grpcapi.EventsRequest_Decision{Decision: &grpcapi.ConnectingDecision{
+		ConnectionId: event.GetConnecting().GetConnectionId(),
+		Accept:       false,
+	}}}))
+
+	response := <-dialed
+	s.Require().NotNil(response)
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+}
+
+func (s *grpcTestSuite) TestEventsRequireSubscription() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	stream, err := s.client.Events(withAPIKey(ctx, grpcAPIKey))
+	s.Require().NoError(err)
+	s.Require().NoError(stream.Send(&grpcapi.EventsRequest{Request: &grpcapi.EventsRequest_Decision{Decision: &grpcapi.ConnectingDecision{}}}))
+	_, recvErr := stream.Recv()
+	s.Equal(codes.InvalidArgument, status.Code(recvErr))
+}
+
+func (s *grpcTestSuite) TestPush() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, connId := s.connect(ctx, "push-alice")
+	defer c.Close(websocket.StatusNormalClosure, "")
+
+	// The message is not a JSON string as for the HTTP API
+	response, err := s.client.Push(ctx, &grpcapi.PushRequest{ConnectionId: connId, Message: `{"greeting": "hello"}`})
+	s.Require().NoError(err)
+	s.False(response.Queued)
+	s.Equal(`{"greeting": "hello"}`, s.read(ctx, c))
+
+	_, err = s.client.Push(ctx, &grpcapi.PushRequest{ConnectionId: "unknown", Message: "hello"})
+	s.Equal(codes.NotFound, status.Code(err))
+	_, err = s.client.Push(ctx, &grpcapi.PushRequest{App: "unknown", ConnectionId: connId, Message: "hello"})
+	s.Equal(codes.NotFound, status.Code(err))
+}
+
+func (s *grpcTestSuite) TestRequiresAPIKey() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := s.client.Broadcast(ctx, &grpcapi.BroadcastRequest{App: grpcAppName, Message: "hello"})
+	s.Equal(codes.Unauthenticated, status.Code(err))
+	_, err = s.client.Broadcast(withAPIKey(ctx, "guessed"), &grpcapi.BroadcastRequest{App: grpcAppName, Message: "hello"})
+	s.Equal(codes.Unauthenticated, status.Code(err))
+	_, err = s.client.Broadcast(withAPIKey(ctx, grpcAPIKey), &grpcapi.BroadcastRequest{App: grpcAppName, Message: "hello"})
+	s.NoError(err)
+
+	var header metadata.MD
+	_, err = s.client.ListConnections(ctx, &grpcapi.ListConnectionsRequest{}, grpc.Header(&header))
+	s.NoError(err)
+	s.NotEmpty(header.Get("x-request-id"))
+}
@@ -0,0 +1,228 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const (
+	healthWsgwPort = 8093
+	// strictHealthWsgwPort is that of the gateway, which reports not ready while a circuit is open
+	strictHealthWsgwPort = 8108
+)
+
+const testCircuitOpenDuration = 500 * time.Millisecond
+
+type healthTestSuite struct {
+	suite.Suite
+	mockApp         *mockApplication
+	wsGateway       *wsgw.Server
+	strictWsGateway *wsgw.Server
+	logger          zerolog.Logger
+}
+
+func TestHealthTestSuite(t *testing.T) {
+	suite.Run(t, &healthTestSuite{
+		logger: logging.Get().With().Str("unit", "TestHealthTestSuite").Logger(),
+	})
+}
+
+func (s *healthTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", healthWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	// Nothing listens at the address of the failing application
+	listener, listenErr := net.Listen("tcp", "localhost:0")
+	if listenErr != nil {
+		panic(listenErr)
+	}
+	unreachableAddr := listener.Addr().String()
+	listener.Close()
+
+	failingApp := wsgw.AppConfig{
+		Name:    "failing",
+		BaseUrl: fmt.Sprintf("http://%s", unreachableAddr),
+		CircuitBreaker: wsgw.CircuitBreakerConfig{
+			FailureThreshold: 1,
+			OpenDuration:     testCircuitOpenDuration,
+		},
+	}
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: healthWsgwPort,
+			Apps: []wsgw.AppConfig{
+				{
+					Name:    "healthy",
+					BaseUrl: fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+				},
+				failingApp,
+			},
+			Health: wsgw.HealthConfig{
+				CapacityThreshold: 1,
+			},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+	s.strictWsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: strictHealthWsgwPort,
+			Apps:       []wsgw.AppConfig{failingApp},
+			Health: wsgw.HealthConfig{
+				FailOnOpenCircuit: true,
+			},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway-strict").Logger(),
+	)
+}
+
+func (s *healthTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+	s.strictWsGateway.Stop()
+}
+
+type readinessCheck struct {
+	Name          string `json:"name"`
+	App           string `json:"app"`
+	OK            bool   `json:"ok"`
+	Message       string `json:"message"`
+	Informational bool   `json:"informational"`
+}
+
+type readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks []readinessCheck `json:"checks"`
+}
+
+func (s *healthTestSuite) readiness(port int) (int, readiness) {
+	response, err := http.Get(fmt.Sprintf("http://localhost:%d/readyz", port))
+	s.Require().NoError(err)
+	defer response.Body.Close()
+	var result readiness
+	s.NoError(json.NewDecoder(response.Body).Decode(&result))
+	return response.StatusCode, result
+}
+
+// callbacksCheck returns the check of the callbacks to `app`
+func (r readiness) callbacksCheck(app string) readinessCheck {
+	for _, check := range r.Checks {
+		if check.Name == "callbacks" && check.App == app {
+			return check
+		}
+	}
+	return readinessCheck{}
+}
+
+// failedChecks returns the names of the failed checks, which decide on the readiness
+func (r readiness) failedChecks() []string {
+	failed := []string{}
+	for _, check := range r.Checks {
+		if !check.OK && !check.Informational {
+			failed = append(failed, check.Name+check.App)
+		}
+	}
+	return failed
+}
+
+func (s *healthTestSuite) TestCapacityThreshold() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _, err := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/healthy", healthWsgwPort), defaultDialOptions)
+	s.Require().NoError(err)
+
+	status, result := s.readiness(healthWsgwPort)
+	s.Equal(http.StatusServiceUnavailable, status)
+	s.False(result.Ready)
+	s.Equal([]string{"capacity"}, result.failedChecks())
+
+	c.Close(websocket.StatusNormalClosure, "we're done")
+	s.Eventually(func() bool {
+		status, _ := s.readiness(healthWsgwPort)
+		return status == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (s *healthTestSuite) TestCircuitOpenWhenCallbacksFail() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, response, _ := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/failing", healthWsgwPort), defaultDialOptions)
+	s.Equal(http.StatusInternalServerError, response.StatusCode)
+
+	// The node still serves the other applications
+	status, result := s.readiness(healthWsgwPort)
+	s.Equal(http.StatusOK, status)
+	s.Empty(result.failedChecks())
+	s.Equal(readinessCheck{Name: "callbacks", App: "failing", Message: "callback circuit open", Informational: true}, result.callbacksCheck("failing"))
+
+	// Callbacks fail fast while the circuit is open
+	_, response, _ = websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/failing", healthWsgwPort), defaultDialOptions)
+	s.Equal(http.StatusServiceUnavailable, response.StatusCode)
+
+	s.Eventually(func() bool {
+		_, result := s.readiness(healthWsgwPort)
+		return result.callbacksCheck("failing").OK
+	}, 5*testCircuitOpenDuration, 10*time.Millisecond)
+}
+
+func (s *healthTestSuite) TestCircuitOpenFailsReadinessIfRequired() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, response, _ := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/failing", strictHealthWsgwPort), defaultDialOptions)
+	s.Equal(http.StatusInternalServerError, response.StatusCode)
+
+	status, result := s.readiness(strictHealthWsgwPort)
+	s.Equal(http.StatusServiceUnavailable, status)
+	s.Equal([]string{"callbacksfailing"}, result.failedChecks())
+
+	s.Eventually(func() bool {
+		status, _ := s.readiness(strictHealthWsgwPort)
+		return status == http.StatusOK
+	}, 5*testCircuitOpenDuration, 10*time.Millisecond)
+}
+
+func (s *healthTestSuite) TestLiveness() {
+	response, err := http.Get(fmt.Sprintf("http://localhost:%d/healthz", healthWsgwPort))
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+}
+
+func (s *healthTestSuite) TestReadiness() {
+	status, result := s.readiness(healthWsgwPort)
+	s.Equal(http.StatusOK, status)
+	s.True(result.Ready)
+	s.Empty(result.failedChecks())
+	s.Len(result.Checks, 4) // draining, callbacks of both applications and capacity
+}
+
+// Draining can't be undone, so this test must be the last one
+func (s *healthTestSuite) TestWhileDrainingNewConnectionsAreRejected() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	s.wsGateway.Drain()
+
+	status, result := s.readiness(healthWsgwPort)
+	s.Equal(http.StatusServiceUnavailable, status)
+	s.Equal([]string{"draining"}, result.failedChecks())
+
+	_, response, _ := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/healthy", healthWsgwPort), defaultDialOptions)
+	s.Equal(http.StatusServiceUnavailable, response.StatusCode)
+}
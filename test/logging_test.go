@@ -0,0 +1,91 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"websocket-gateway/internal/logging"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type loggingTestSuite struct {
+	suite.Suite
+}
+
+func TestLoggingTestSuite(t *testing.T) {
+	suite.Run(t, &loggingTestSuite{})
+}
+
+func (s *loggingTestSuite) TearDownTest() {
+	// The other suites log as they did before
+	s.Require().NoError(logging.Configure(logging.Config{
+		Level:   "info",
+		Outputs: []string{logging.StderrOutput, logging.FileOutput},
+	}))
+	logging.SetSubsystemLevels(nil)
+}
+
+func (s *loggingTestSuite) readLines(path string) []string {
+	content, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	return strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+func (s *loggingTestSuite) TestConsoleFormat() {
+	path := filepath.Join(s.T().TempDir(), "console.log")
+	s.Require().NoError(logging.Configure(logging.Config{
+		Format:  logging.ConsoleFormat,
+		Outputs: []string{logging.FileOutput},
+		File:    logging.FileConfig{Path: path},
+	}))
+
+	logger := logging.Get()
+	logger.Warn().Str(logging.UnitLogger, "LoggingTest").Msg("human readable")
+
+	lines := s.readLines(path)
+	s.Require().Len(lines, 1)
+	s.Contains(lines[0], "WRN human readable")
+	s.Contains(lines[0], "unit=LoggingTest")
+}
+
+func (s *loggingTestSuite) TestInvalidConfiguration() {
+	s.ErrorContains(logging.Configure(logging.Config{Format: "xml"}), "unknown log format")
+	s.ErrorContains(logging.Configure(logging.Config{Outputs: []string{"kafka"}}), "unknown log output")
+	s.ErrorContains(logging.Configure(logging.Config{Level: "verbose"}), "verbose")
+	s.ErrorContains(logging.Configure(logging.Config{Levels: map[string]string{"WsConnections": "loud"}}), "WsConnections")
+}
+
+func (s *loggingTestSuite) TestSubsystemLevels() {
+	path := filepath.Join(s.T().TempDir(), "gateway.log")
+	s.Require().NoError(logging.Configure(logging.Config{
+		Level:   "warn",
+		Levels:  map[string]string{"Verbose": "debug", "Quiet": "error"},
+		Outputs: []string{logging.FileOutput},
+		File:    logging.FileConfig{Path: path},
+	}))
+
+	other := logging.Get().With().Str(logging.UnitLogger, "Other").Logger()
+	other.Info().Msg("dropped info")
+	other.Warn().Msg("kept warning")
+
+	verbose := logging.Get().With().Str(logging.UnitLogger, "Verbose").Logger()
+	verbose.Debug().Msg("kept debug")
+	verbose.Trace().Msg("dropped trace")
+	// The method takes precedence over the unit
+	quiet := verbose.With().Str(logging.MethodLogger, "Quiet").Logger()
+	quiet.Warn().Msg("dropped warning")
+
+	lines := s.readLines(path)
+	s.Require().Len(lines, 2)
+	s.Contains(lines[0], `"message":"kept warning"`)
+	s.Contains(lines[1], `"message":"kept debug"`)
+	s.Contains(lines[1], `"level":"debug"`)
+
+	// The base level can be changed at runtime without affecting the subsystems
+	logging.SetLevel(logging.Level() - 1)
+	other.Info().Msg("kept info")
+	verbose.Debug().Msg("kept debug again")
+	s.Len(s.readLines(path), 4)
+}
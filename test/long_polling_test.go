@@ -0,0 +1,260 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+const longPollingWsgwPort = 8101
+
+const (
+	longPollingWait    = 200 * time.Millisecond
+	longPollingTimeout = time.Second
+)
+
+type longPollingTestSuite struct {
+	suite.Suite
+	mockApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestLongPollingTestSuite(t *testing.T) {
+	suite.Run(t, &longPollingTestSuite{
+		logger: logging.Get().With().Str("unit", "TestLongPollingTestSuite").Logger(),
+	})
+}
+
+func (s *longPollingTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", longPollingWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost:  "localhost",
+			ServerPort:  longPollingWsgwPort,
+			AppBaseUrl:  fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+			LongPolling: wsgw.LongPollingConfig{Wait: longPollingWait, Timeout: longPollingTimeout},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+}
+
+func (s *longPollingTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+}
+
+// pollSession is the client side of a long-polling connection
+type pollSession struct {
+	ConnectionID string `json:"connectionId"`
+	Token        string `json:"token"`
+}
+
+func (s *longPollingTestSuite) connect(credential string, requestID string) (*pollSession, *http.Response) {
+	request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%d/connect/poll", longPollingWsgwPort), nil)
+	request.Header.Set("Authorization", credential)
+	request.Header.Set(wsgw.RequestIDHeaderKey, requestID)
+	response, err := http.DefaultClient.Do(request)
+	s.Require().NoError(err)
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, response
+	}
+
+	var session pollSession
+	s.Require().NoError(json.NewDecoder(response.Body).Decode(&session))
+	s.Equal(session.ConnectionID, response.Header.Get(wsgw.ConnectionIDHeaderKey))
+	s.Equal(session.Token, response.Header.Get(wsgw.ConnectionTokenHeaderKey))
+	return &session, response
+}
+
+func (s *longPollingTestSuite) request(method string, session *pollSession, token string, body string) *http.Response {
+	request, _ := http.NewRequest(method, fmt.Sprintf("http://localhost:%d/connect/poll/%s", longPollingWsgwPort, session.ConnectionID), strings.NewReader(body))
+	request.Header.Set(wsgw.ConnectionTokenHeaderKey, token)
+	response, err := http.DefaultClient.Do(request)
+	s.Require().NoError(err)
+	return response
+}
+
+// poll returns the status of the poll and the messages it got
+func (s *longPollingTestSuite) poll(session *pollSession) (int, []string) {
+	response := s.request(http.MethodGet, session, session.Token, "")
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return response.StatusCode, nil
+	}
+	var polled struct {
+		Messages []string `json:"messages"`
+	}
+	s.Require().NoError(json.NewDecoder(response.Body).Decode(&polled))
+	return response.StatusCode, polled.Messages
+}
+
+// pollAcknowledging polls acknowledging the messages up to `cursor` and returns those it got along with their cursor
+func (s *longPollingTestSuite) pollAcknowledging(session *pollSession, cursor uint64) ([]string, uint64) {
+	request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%d/connect/poll/%s?cursor=%d", longPollingWsgwPort, session.ConnectionID, cursor), nil)
+	request.Header.Set(wsgw.ConnectionTokenHeaderKey, session.Token)
+	response, err := http.DefaultClient.Do(request)
+	s.Require().NoError(err)
+	defer response.Body.Close()
+	s.Require().Equal(http.StatusOK, response.StatusCode)
+	var polled struct {
+		Messages []string `json:"messages"`
+		Cursor   uint64   `json:"cursor"`
+	}
+	s.Require().NoError(json.NewDecoder(response.Body).Decode(&polled))
+	return polled.Messages, polled.Cursor
+}
+
+// callbacks returns the callback endpoints the mock application was called at for the request with `requestID`
+func (s *longPollingTestSuite) callbacks(requestID string) []string {
+	var endpoints []string
+	for _, callback := range s.mockApp.getRequestIDs() {
+		if callback[1] == requestID {
+			endpoints = append(endpoints, callback[0])
+		}
+	}
+	return endpoints
+}
+
+func (s *longPollingTestSuite) TestClosedByBackend() {
+	session, _ := s.connect(userCredentialPrefix+"alice", "poll-backend-close")
+
+	request, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://localhost:%d/connections/%s", longPollingWsgwPort, session.ConnectionID), nil)
+	response, err := http.DefaultClient.Do(request)
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+
+	s.Eventually(func() bool {
+		return slices.Contains(s.callbacks("poll-backend-close"), "disconnected")
+	}, 5*time.Second, 10*time.Millisecond)
+	// The session is gone once the connection is, until then it is answered with 410 Gone
+	s.Eventually(func() bool {
+		status, _ := s.poll(session)
+		return status == http.StatusNotFound
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (s *longPollingTestSuite) TestClosedByClient() {
+	session, _ := s.connect(userCredentialPrefix+"alice", "poll-client-close")
+
+	s.Equal(http.StatusNoContent, s.request(http.MethodDelete, session, session.Token, "").StatusCode)
+	s.Eventually(func() bool {
+		return slices.Contains(s.callbacks("poll-client-close"), "disconnected")
+	}, 5*time.Second, 10*time.Millisecond)
+	s.Eventually(func() bool {
+		return s.request(http.MethodPost, session, session.Token, "too late").StatusCode == http.StatusNotFound
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (s *longPollingTestSuite) TestMessagesBothWays() {
+	session, _ := s.connect(userCredentialPrefix+"alice", "poll-messages")
+	s.Equal([]string{"connecting"}, s.callbacks("poll-messages"))
+
+	s.Equal(http.StatusNoContent, s.request(http.MethodPost, session, session.Token, "hello upstream").StatusCode)
+	s.Eventually(func() bool {
+		return slices.ContainsFunc(s.mockApp.getMessagesReceived(), func(received []string) bool {
+			return received[0] == session.ConnectionID && received[1] == "hello upstream"
+		})
+	}, 5*time.Second, 10*time.Millisecond)
+	s.Equal([]string{"connecting", "message-received"}, s.callbacks("poll-messages"))
+
+	for _, msg := range []string{"first", "second"} {
+		response, err := pushMessage(longPollingWsgwPort, "/message/"+session.ConnectionID, "", msg)
+		s.Require().NoError(err)
+		s.Equal(http.StatusNoContent, response.StatusCode)
+	}
+	status, messages := s.poll(session)
+	s.Equal(http.StatusOK, status)
+	s.Equal([]string{"first", "second"}, messages)
+
+	// Polls without messages are answered once the wait is over
+	status, messages = s.poll(session)
+	s.Equal(http.StatusOK, status)
+	s.Empty(messages)
+}
+
+func (s *longPollingTestSuite) TestUnacknowledgedMessagesArePolledAgain() {
+	session, _ := s.connect(userCredentialPrefix+"alice", "poll-unacknowledged")
+	push := func(msg string) {
+		response, err := pushMessage(longPollingWsgwPort, "/message/"+session.ConnectionID, "", msg)
+		s.Require().NoError(err)
+		s.Equal(http.StatusNoContent, response.StatusCode)
+	}
+
+	push("first")
+	push("second")
+	messages, cursor := s.pollAcknowledging(session, 0)
+	s.Equal([]string{"first", "second"}, messages)
+	s.Equal(uint64(1), cursor)
+
+	// The response got lost, so the client polls acknowledging the previous cursor again
+	push("third")
+	messages, cursor = s.pollAcknowledging(session, 0)
+	s.Equal([]string{"first", "second"}, messages)
+	s.Equal(uint64(1), cursor)
+
+	messages, cursor = s.pollAcknowledging(session, 1)
+	s.Equal([]string{"third"}, messages)
+	s.Equal(uint64(2), cursor)
+
+	messages, cursor = s.pollAcknowledging(session, 2)
+	s.Empty(messages)
+	s.Equal(uint64(2), cursor)
+
+	request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%d/connect/poll/%s?cursor=last", longPollingWsgwPort, session.ConnectionID), nil)
+	request.Header.Set(wsgw.ConnectionTokenHeaderKey, session.Token)
+	response, err := http.DefaultClient.Do(request)
+	s.Require().NoError(err)
+	response.Body.Close()
+	s.Equal(http.StatusBadRequest, response.StatusCode)
+}
+
+func (s *longPollingTestSuite) TestPollsKeepConnectionAlive() {
+	session, _ := s.connect(userCredentialPrefix+"alice", "poll-alive")
+
+	for deadline := time.Now().Add(2 * longPollingTimeout); time.Now().Before(deadline); {
+		status, _ := s.poll(session)
+		s.Require().Equal(http.StatusOK, status)
+	}
+	s.NotContains(s.callbacks("poll-alive"), "disconnected")
+}
+
+func (s *longPollingTestSuite) TestRejectedByApp() {
+	session, response := s.connect(badCredential, "poll-rejected")
+	s.Nil(session)
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+}
+
+func (s *longPollingTestSuite) TestRequestsRequireToken() {
+	session, _ := s.connect(userCredentialPrefix+"alice", "poll-token")
+
+	s.Equal(http.StatusForbidden, s.request(http.MethodGet, session, "guessed", "").StatusCode)
+	s.Equal(http.StatusForbidden, s.request(http.MethodPost, session, "", "hello").StatusCode)
+	s.Equal(http.StatusForbidden, s.request(http.MethodDelete, session, "guessed", "").StatusCode)
+}
+
+func (s *longPollingTestSuite) TestTimesOutWithoutPolls() {
+	session, _ := s.connect(userCredentialPrefix+"alice", "poll-timeout")
+
+	s.Eventually(func() bool {
+		return slices.Contains(s.callbacks("poll-timeout"), "disconnected")
+	}, 5*time.Second, 10*time.Millisecond)
+	s.Eventually(func() bool {
+		status, _ := s.poll(session)
+		return status == http.StatusNotFound
+	}, 5*time.Second, 10*time.Millisecond)
+}
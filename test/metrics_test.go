@@ -0,0 +1,153 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const metricsWsgwPort = 8091
+
+type metricsTestSuite struct {
+	suite.Suite
+	mockApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestMetricsTestSuite(t *testing.T) {
+	suite.Run(t, &metricsTestSuite{
+		logger: logging.Get().With().Str("unit", "TestMetricsTestSuite").Logger(),
+	})
+}
+
+func (s *metricsTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", metricsWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+	appBaseUrl := fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String())
+
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: metricsWsgwPort,
+			Apps: []wsgw.AppConfig{
+				{
+					Name:    "metered",
+					BaseUrl: appBaseUrl,
+				},
+				{
+					Name:          "throttled",
+					BaseUrl:       appBaseUrl,
+					PushRateLimit: 0.01,
+					PushBurst:     1,
+				},
+			},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+}
+
+func (s *metricsTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+}
+
+func (s *metricsTestSuite) scrape() string {
+	response, err := http.Get(fmt.Sprintf("http://localhost:%d/metrics", metricsWsgwPort))
+	s.Require().NoError(err)
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	return string(body)
+}
+
+// eventuallyExposes waits for the metrics to contain all the `samples`
+func (s *metricsTestSuite) eventuallyExposes(samples ...string) {
+	var exposed string
+	ok := s.Eventually(func() bool {
+		exposed = s.scrape()
+		for _, sample := range samples {
+			if !strings.Contains(exposed, sample) {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	if !ok {
+		s.T().Log(exposed)
+	}
+}
+
+func (s *metricsTestSuite) TestConnectionLifecycleIsMetered() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _, err := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/metered", metricsWsgwPort), defaultDialOptions)
+	s.Require().NoError(err)
+	connId := s.mockApp.getDataReceived()[0][2]
+	s.eventuallyExposes(`wsgw_connections{app="metered"} 1`)
+
+	s.NoError(c.Write(ctx, websocket.MessageText, []byte("hi")))
+	response, err := pushMessage(metricsWsgwPort, "/apps/metered/message/"+connId, "", "hello")
+	s.NoError(err)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	_, msg, err := c.Read(ctx)
+	s.NoError(err)
+	s.Equal("hello", string(msg))
+
+	c.Close(websocket.StatusNormalClosure, "we're done")
+
+	s.eventuallyExposes(
+		`wsgw_connections{app="metered"} 0`,
+		`wsgw_connects_total{app="metered",outcome="accepted"} 1`,
+		`wsgw_disconnects_total{app="metered",reason="client_closed"} 1`,
+		`wsgw_messages_total{app="metered",direction="inbound"} 1`,
+		`wsgw_message_bytes_total{app="metered",direction="inbound"} 2`,
+		`wsgw_messages_total{app="metered",direction="outbound"} 1`,
+		`wsgw_message_bytes_total{app="metered",direction="outbound"} 5`,
+		`wsgw_push_duration_seconds_count{app="metered",status="204"} 1`,
+		`wsgw_outbound_queue_depth_count{app="metered"} 1`,
+		`wsgw_app_callback_duration_seconds_count{app="metered",endpoint="message-received",status="200"} 1`,
+		`wsgw_app_callback_duration_seconds_count{app="metered",endpoint="disconnected",status="200"} 1`,
+	)
+}
+
+func (s *metricsTestSuite) TestRejectedConnectionIsMetered() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, response, _ := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/metered", metricsWsgwPort), &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization": []string{badCredential},
+		},
+	})
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+
+	s.eventuallyExposes(`wsgw_connects_total{app="metered",outcome="unauthorized"} 1`)
+}
+
+func (s *metricsTestSuite) TestRateLimiterRejectionsAreMetered() {
+	response, err := pushMessage(metricsWsgwPort, "/apps/throttled/message/unknown", "", "first")
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, response.StatusCode)
+
+	response, err = pushMessage(metricsWsgwPort, "/apps/throttled/message/unknown", "", "second")
+	s.NoError(err)
+	s.Equal(http.StatusTooManyRequests, response.StatusCode)
+
+	s.eventuallyExposes(
+		`wsgw_rate_limiter_rejections_total{app="throttled"} 1`,
+		`wsgw_push_duration_seconds_count{app="throttled",status="429"} 1`,
+	)
+}
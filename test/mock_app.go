@@ -1,10 +1,15 @@
 package test
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 	wsgw "websocket-gateway/internal"
 
 	"github.com/gin-gonic/gin"
@@ -12,11 +17,34 @@ import (
 
 const badCredential = "bad-credential"
 
+// userCredentialPrefix prefixes the user ID in credentials the mock app identifies the user by
+const userCredentialPrefix = "user:"
+
+// The mock app takes slowCallbackDelay to answer the message-received callbacks for messages with slowMessagePrefix
+const (
+	slowMessagePrefix = "slow:"
+	slowCallbackDelay = 500 * time.Millisecond
+)
+
+// The mock app fails the message-received callbacks for messages with rejectedMessagePrefix
+const rejectedMessagePrefix = "reject:"
+
 type mockApplication struct {
-	wsgwUrl      string
-	listener     net.Listener
-	stop         func()
-	dataReceived [][]string
+	wsgwUrl  string
+	listener net.Listener
+	stop     func()
+	// messagesMu guards dataReceived, messagesReceived, messageBatchSizes and slowCallbacks
+	messagesMu       sync.Mutex
+	dataReceived     [][]string
+	messagesReceived [][]string
+	// slowCallbacks are the bodies of the slow message-received callbacks started
+	slowCallbacks []string
+	// messageBatchSizes are the numbers of messages of the batched message-received callbacks
+	messageBatchSizes []int
+	// traceparents are the W3C trace contexts of the callbacks as [endpoint, traceparent]
+	traceparents [][]string
+	// requestIDs are the request IDs of the callbacks as [endpoint, request ID]
+	requestIDs [][]string
 }
 
 func newMockApp(wsgwUrl string) *mockApplication {
@@ -26,8 +54,11 @@ func newMockApp(wsgwUrl string) *mockApplication {
 }
 
 func (m *mockApplication) start() error {
-	address := fmt.Sprintf(":%d", 0)
-	listener, listenErr := net.Listen("tcp", address)
+	return m.startOn("tcp", fmt.Sprintf(":%d", 0))
+}
+
+func (m *mockApplication) startOn(network string, address string) error {
+	listener, listenErr := net.Listen(network, address)
 	if listenErr != nil {
 		return fmt.Errorf("failed to listen on %s: %w", address, listenErr)
 	}
@@ -38,8 +69,15 @@ func (m *mockApplication) start() error {
 		return fmt.Errorf("failed to create mockApp request handler: %w", creHandlerErr)
 	}
 
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	server := &http.Server{
+		Handler:   handler,
+		Protocols: protocols,
+	}
 	go func() {
-		http.Serve(listener, handler)
+		server.Serve(listener)
 	}()
 	m.stop = func() {
 		listener.Close()
@@ -67,7 +105,19 @@ func (m *mockApplication) createMockAppRequestHandler() (http.Handler, error) {
 
 		connHeaderKey := wsgw.ConnectionIDHeaderKey
 		if connId := req.Header.Get(connHeaderKey); connId != "" {
+			m.messagesMu.Lock()
 			m.dataReceived = [][]string{{"POST /ws/connecting", connHeaderKey, connId}}
+			m.messagesMu.Unlock()
+		}
+		m.recordTraceparent("connecting", req.Header)
+		m.recordRequestID("connecting", req.Header)
+
+		if userID, isUserCred := strings.CutPrefix(cred[0], userCredentialPrefix); isUserCred {
+			res.Header(wsgw.UserIDHeaderKey, userID)
+		}
+		// Clients ask for their payloads to be logged, which real applications would decide on themselves
+		if sampleRate := req.Header.Get(wsgw.PayloadSampleRateHeaderKey); sampleRate != "" {
+			res.Header(wsgw.PayloadSampleRateHeaderKey, sampleRate)
 		}
 
 		res.Status(200)
@@ -78,11 +128,112 @@ func (m *mockApplication) createMockAppRequestHandler() (http.Handler, error) {
 
 		connHeaderKey := wsgw.ConnectionIDHeaderKey
 		if connId := req.Header.Get(connHeaderKey); connId != "" {
+			m.messagesMu.Lock()
 			m.dataReceived = append(m.dataReceived, []string{"POST /ws/disconnected", connHeaderKey, connId})
+			m.messagesMu.Unlock()
 		}
+		m.recordRequestID("disconnected", req.Header)
 	})
 
-	ws.POST("/message-received")
+	ws.POST("/message-received", func(g *gin.Context) {
+		body, readErr := io.ReadAll(g.Request.Body)
+		if readErr != nil {
+			g.AbortWithError(500, readErr)
+			return
+		}
+
+		if strings.HasPrefix(string(body), slowMessagePrefix) {
+			m.messagesMu.Lock()
+			m.slowCallbacks = append(m.slowCallbacks, string(body))
+			m.messagesMu.Unlock()
+			time.Sleep(slowCallbackDelay)
+		}
+
+		m.recordTraceparent("message-received", g.Request.Header)
+		m.recordRequestID("message-received", g.Request.Header)
+
+		m.messagesMu.Lock()
+		defer m.messagesMu.Unlock()
+		if g.ContentType() == "application/json" {
+			var batch []struct {
+				ConnectionID string `json:"connectionId"`
+				MessageID    string `json:"messageId"`
+				Message      string `json:"message"`
+			}
+			if decodeErr := json.Unmarshal(body, &batch); decodeErr != nil {
+				g.AbortWithError(400, decodeErr)
+				return
+			}
+			for _, msg := range batch {
+				if strings.HasPrefix(msg.Message, rejectedMessagePrefix) {
+					g.AbortWithStatus(500)
+					return
+				}
+			}
+			for _, msg := range batch {
+				m.messagesReceived = append(m.messagesReceived, []string{msg.ConnectionID, msg.Message, msg.MessageID})
+			}
+			m.messageBatchSizes = append(m.messageBatchSizes, len(batch))
+			return
+		}
+		m.messagesReceived = append(m.messagesReceived, []string{
+			g.Request.Header.Get(wsgw.ConnectionIDHeaderKey),
+			string(body),
+			g.Request.Header.Get(wsgw.MessageIDHeaderKey),
+		})
+	})
 
 	return rootEngine, nil
 }
+
+// getDataReceived returns the connecting and disconnected callbacks as [callback, header name, connection ID]
+func (m *mockApplication) getDataReceived() [][]string {
+	m.messagesMu.Lock()
+	defer m.messagesMu.Unlock()
+	return append([][]string{}, m.dataReceived...)
+}
+
+func (m *mockApplication) getMessagesReceived() [][]string {
+	m.messagesMu.Lock()
+	defer m.messagesMu.Unlock()
+	return append([][]string{}, m.messagesReceived...)
+}
+
+// getSlowCallbacks returns the bodies of the slow message-received callbacks started so far
+func (m *mockApplication) getSlowCallbacks() []string {
+	m.messagesMu.Lock()
+	defer m.messagesMu.Unlock()
+	return append([]string{}, m.slowCallbacks...)
+}
+
+func (m *mockApplication) getMessageBatchSizes() []int {
+	m.messagesMu.Lock()
+	defer m.messagesMu.Unlock()
+	return append([]int{}, m.messageBatchSizes...)
+}
+
+func (m *mockApplication) recordTraceparent(endpoint string, header http.Header) {
+	if traceparent := header.Get("traceparent"); traceparent != "" {
+		m.messagesMu.Lock()
+		defer m.messagesMu.Unlock()
+		m.traceparents = append(m.traceparents, []string{endpoint, traceparent})
+	}
+}
+
+func (m *mockApplication) recordRequestID(endpoint string, header http.Header) {
+	m.messagesMu.Lock()
+	defer m.messagesMu.Unlock()
+	m.requestIDs = append(m.requestIDs, []string{endpoint, header.Get(wsgw.RequestIDHeaderKey)})
+}
+
+func (m *mockApplication) getRequestIDs() [][]string {
+	m.messagesMu.Lock()
+	defer m.messagesMu.Unlock()
+	return append([][]string{}, m.requestIDs...)
+}
+
+func (m *mockApplication) getTraceparents() [][]string {
+	m.messagesMu.Lock()
+	defer m.messagesMu.Unlock()
+	return append([][]string{}, m.traceparents...)
+}
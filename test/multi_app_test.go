@@ -0,0 +1,268 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+const multiAppWsgwPort = 8082
+
+const limitedAppMaxConnections = 2
+
+type multiAppTestSuite struct {
+	suite.Suite
+	alphaApp  *mockApplication
+	betaApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestMultiAppTestSuite(t *testing.T) {
+	suite.Run(t, &multiAppTestSuite{
+		logger: logging.Get().With().Str("unit", "TestMultiAppTestSuite").Logger(),
+	})
+}
+
+func (s *multiAppTestSuite) SetupSuite() {
+	wsgwUrl := fmt.Sprintf("http://localhost:%d", multiAppWsgwPort)
+	s.alphaApp = newMockApp(wsgwUrl)
+	if err := s.alphaApp.start(); err != nil {
+		panic(err)
+	}
+	s.betaApp = newMockApp(wsgwUrl)
+	if err := s.betaApp.start(); err != nil {
+		panic(err)
+	}
+
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: multiAppWsgwPort,
+			Apps: []wsgw.AppConfig{
+				{
+					Name:           "alpha",
+					BaseUrl:        fmt.Sprintf("http://%s", s.alphaApp.listener.Addr().String()),
+					BackendAPIKeys: []string{"alpha-key"},
+				},
+				{
+					Name:          "beta",
+					BaseUrl:       fmt.Sprintf("http://%s", s.betaApp.listener.Addr().String()),
+					MessageFormat: wsgw.JSONEnvelopeMessageFormat,
+				},
+				{
+					Name:           "limited",
+					BaseUrl:        fmt.Sprintf("http://%s", s.alphaApp.listener.Addr().String()),
+					MaxConnections: limitedAppMaxConnections,
+				},
+			},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+}
+
+func (s *multiAppTestSuite) TearDownSuite() {
+	s.alphaApp.stop()
+	s.betaApp.stop()
+	s.wsGateway.Stop()
+}
+
+func (s *multiAppTestSuite) connect(ctx context.Context, app string) (*websocket.Conn, error) {
+	c, _, err := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/%s", multiAppWsgwPort, app), defaultDialOptions)
+	return c, err
+}
+
+func (s *multiAppTestSuite) TestConnectionLimitHoldsForConcurrentClients() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	const clients = 10
+	statuses := make(chan int, clients)
+	var wg sync.WaitGroup
+	for range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, response, err := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/limited", multiAppWsgwPort), defaultDialOptions)
+			if err == nil {
+				defer c.Close(websocket.StatusNormalClosure, "we're done")
+			}
+			statuses <- response.StatusCode
+			// The connections are held until all clients tried
+			<-ctx.Done()
+		}()
+	}
+
+	accepted := 0
+	for range clients {
+		status := <-statuses
+		if status == http.StatusSwitchingProtocols {
+			accepted++
+		} else {
+			s.Equal(http.StatusServiceUnavailable, status)
+		}
+	}
+	cancel()
+	wg.Wait()
+	s.Equal(limitedAppMaxConnections, accepted)
+}
+
+func (s *multiAppTestSuite) TestNoDefaultApp() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, response, err := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect", multiAppWsgwPort), defaultDialOptions)
+	s.Error(err)
+	s.Equal(http.StatusNotFound, response.StatusCode)
+
+	pushResponse, pushErr := pushMessage(multiAppWsgwPort, "/broadcast", "", "hello")
+	s.Require().NoError(pushErr)
+	s.Equal(http.StatusNotFound, pushResponse.StatusCode)
+}
+
+func (s *multiAppTestSuite) TestPushIsScopedPerApp() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, err := s.connect(ctx, "alpha")
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	defer c.Close(websocket.StatusNormalClosure, "we're done")
+
+	s.Len(s.alphaApp.getDataReceived(), 1)
+	connId := s.alphaApp.getDataReceived()[0][2]
+
+	response, err := pushMessage(multiAppWsgwPort, "/apps/alpha/message/"+connId, "", "no key")
+	s.NoError(err)
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+
+	response, err = pushMessage(multiAppWsgwPort, "/apps/beta/message/"+connId, "", "wrong app")
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, response.StatusCode)
+
+	response, err = pushMessage(multiAppWsgwPort, "/apps/alpha/message/"+connId, "alpha-key", "hello alpha")
+	s.NoError(err)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+
+	_, msg, readErr := c.Read(ctx)
+	s.NoError(readErr)
+	s.Equal("hello alpha", string(msg))
+}
+
+func (s *multiAppTestSuite) TestBroadcast() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, err := s.connect(ctx, "beta")
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	defer c.Close(websocket.StatusNormalClosure, "we're done")
+
+	response, err := pushMessage(multiAppWsgwPort, "/apps/beta/broadcast", "", "hello beta")
+	s.NoError(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+
+	envelope := s.readEnvelope(ctx, c)
+	s.Equal("broadcast", envelope.Type)
+	s.Equal("hello beta", envelope.Data)
+}
+
+type messageEnvelope struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Seq       uint64    `json:"seq"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      string    `json:"data"`
+}
+
+func (s *multiAppTestSuite) readEnvelope(ctx context.Context, c *websocket.Conn) messageEnvelope {
+	var envelope messageEnvelope
+	s.NoError(wsjson.Read(ctx, c, &envelope))
+	return envelope
+}
+
+func (s *multiAppTestSuite) TestMessageEnvelope() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, err := s.connect(ctx, "beta")
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	defer c.Close(websocket.StatusNormalClosure, "we're done")
+	connId := s.betaApp.getDataReceived()[0][2]
+
+	s.Eventually(func() bool {
+		response, err := pushMessage(multiAppWsgwPort, "/apps/beta/message/"+connId, "", "first")
+		return err == nil && response.StatusCode == http.StatusNoContent
+	}, 5*time.Second, 10*time.Millisecond)
+	response, err := pushMessage(multiAppWsgwPort, "/apps/beta/message/"+connId, "", "second")
+	s.NoError(err)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+
+	first := s.readEnvelope(ctx, c)
+	second := s.readEnvelope(ctx, c)
+	s.Equal("message", first.Type)
+	s.Equal("first", first.Data)
+	s.Equal(uint64(1), first.Seq)
+	s.Equal("second", second.Data)
+	s.Equal(uint64(2), second.Seq)
+	s.NotEqual(first.ID, second.ID)
+	s.WithinDuration(time.Now(), second.Timestamp, time.Minute)
+
+	s.NoError(c.Write(ctx, websocket.MessageText, []byte("from client")))
+	s.Eventually(func() bool {
+		return len(s.betaApp.getMessagesReceived()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	if messages := s.betaApp.getMessagesReceived(); len(messages) == 1 {
+		s.Equal(connId, messages[0][0])
+		s.Equal("from client", messages[0][1])
+		s.NotEmpty(messages[0][2])
+	}
+}
+
+func (s *multiAppTestSuite) TestEmptyMessageEnvelopeHasData() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, err := s.connect(ctx, "beta")
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	defer c.Close(websocket.StatusNormalClosure, "we're done")
+	dataReceived := s.betaApp.getDataReceived()
+	connId := dataReceived[len(dataReceived)-1][2]
+
+	s.Eventually(func() bool {
+		response, err := pushMessage(multiAppWsgwPort, "/apps/beta/message/"+connId, "", "")
+		return err == nil && response.StatusCode == http.StatusNoContent
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, msg, err := c.Read(ctx)
+	s.NoError(err)
+	s.Contains(string(msg), `"data":""`)
+}
+
+func (s *multiAppTestSuite) TestUnknownApp() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, response, _ := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/gamma", multiAppWsgwPort), defaultDialOptions)
+	s.Equal(http.StatusNotFound, response.StatusCode)
+}
@@ -0,0 +1,205 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+const offlineQueueWsgwPort = 8090
+
+const testOfflineQueueTTL = 2 * time.Second
+
+// unresumableAppName is that of the application queueing messages without replay
+const unresumableAppName = "unresumable"
+
+type offlineQueueTestSuite struct {
+	suite.Suite
+	mockApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestOfflineQueueTestSuite(t *testing.T) {
+	suite.Run(t, &offlineQueueTestSuite{
+		logger: logging.Get().With().Str("unit", "TestOfflineQueueTestSuite").Logger(),
+	})
+}
+
+func (s *offlineQueueTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", offlineQueueWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: offlineQueueWsgwPort,
+			Apps: []wsgw.AppConfig{
+				{
+					Name:             wsgw.DefaultAppName,
+					BaseUrl:          fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+					MessageFormat:    wsgw.JSONEnvelopeMessageFormat,
+					ReplayBufferSize: 8,
+					OfflineQueue: wsgw.OfflineQueueConfig{
+						TTL:         testOfflineQueueTTL,
+						MaxMessages: 2,
+					},
+				},
+				{
+					Name:         unresumableAppName,
+					BaseUrl:      fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+					OfflineQueue: wsgw.OfflineQueueConfig{TTL: testOfflineQueueTTL},
+				},
+			},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+}
+
+func (s *offlineQueueTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+}
+
+func (s *offlineQueueTestSuite) read(ctx context.Context, c *websocket.Conn) sessionEnvelope {
+	var envelope sessionEnvelope
+	s.NoError(wsjson.Read(ctx, c, &envelope))
+	return envelope
+}
+
+// connectAndLeave connects as `credential` and closes the connection with `status` once the app was notified of it
+func (s *offlineQueueTestSuite) connectAndLeave(ctx context.Context, credential string, status websocket.StatusCode) sessionEnvelope {
+	c, _, err := connectToWs(ctx, offlineQueueWsgwPort, userDialOptions(credential))
+	s.Require().NoError(err)
+	session := s.read(ctx, c)
+
+	c.Close(status, "leaving")
+	s.Eventually(func() bool {
+		return len(s.mockApp.getDataReceived()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	return session
+}
+
+type userPushResult struct {
+	Recipients int `json:"recipients"`
+	Queued     int `json:"queued"`
+}
+
+func (s *offlineQueueTestSuite) pushToUser(userID string, message string) userPushResult {
+	response, err := pushMessage(offlineQueueWsgwPort, "/users/"+userID+"/message", "", message)
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+	var result userPushResult
+	s.NoError(json.NewDecoder(response.Body).Decode(&result))
+	return result
+}
+
+func userDialOptions(credential string) *websocket.DialOptions {
+	return &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization": []string{credential},
+		},
+	}
+}
+
+func (s *offlineQueueTestSuite) TestMessagesToOfflineUserAreDeliveredOnReconnection() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	s.connectAndLeave(ctx, userCredentialPrefix+"ann", websocket.StatusNormalClosure)
+
+	s.Equal(userPushResult{Recipients: 0, Queued: 1}, s.pushToUser("ann", "one"))
+	s.Equal(userPushResult{Recipients: 0, Queued: 1}, s.pushToUser("ann", "two"))
+	s.Equal(userPushResult{Recipients: 0, Queued: 1}, s.pushToUser("ann", "three"))
+
+	c, _, err := connectToWs(ctx, offlineQueueWsgwPort, userDialOptions(userCredentialPrefix+"ann"))
+	s.Require().NoError(err)
+	defer c.Close(websocket.StatusNormalClosure, "we're done")
+
+	s.Equal("session", s.read(ctx, c).Type)
+	// The oldest message was evicted from the full queue
+	s.Equal("two", s.read(ctx, c).Data)
+	s.Equal("three", s.read(ctx, c).Data)
+
+	s.Equal(userPushResult{Recipients: 1, Queued: 0}, s.pushToUser("ann", "four"))
+	s.Equal("four", s.read(ctx, c).Data)
+}
+
+func (s *offlineQueueTestSuite) TestMessagesToOfflineConnectionAreDeliveredOnResumption() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	session := s.connectAndLeave(ctx, "some credentials", websocket.StatusGoingAway)
+
+	response, err := pushMessage(offlineQueueWsgwPort, "/message/"+session.ConnectionID, "", "while offline")
+	s.NoError(err)
+	s.Equal(http.StatusAccepted, response.StatusCode)
+
+	resumed, _, err := websocket.Dial(
+		ctx,
+		fmt.Sprintf("ws://localhost:%d/connect?resume=%s&lastSeq=%d", offlineQueueWsgwPort, session.ResumeToken, session.Seq),
+		defaultDialOptions,
+	)
+	s.Require().NoError(err)
+	defer resumed.Close(websocket.StatusNormalClosure, "we're done")
+
+	s.True(s.read(ctx, resumed).Resumed)
+	queued := s.read(ctx, resumed)
+	s.Equal("while offline", queued.Data)
+	s.Equal(session.Seq+1, queued.Seq)
+}
+
+func (s *offlineQueueTestSuite) TestOnlyUsersAreQueuedForWithoutReplay() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _, err := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/%s", offlineQueueWsgwPort, unresumableAppName), userDialOptions(userCredentialPrefix+"cid"))
+	s.Require().NoError(err)
+	connId := s.mockApp.getDataReceived()[0][2]
+	c.Close(websocket.StatusGoingAway, "leaving")
+	s.Eventually(func() bool {
+		return len(s.mockApp.getDataReceived()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The connection can't be resumed to receive the messages
+	response, err := pushMessage(offlineQueueWsgwPort, "/apps/"+unresumableAppName+"/message/"+connId, "", "lost")
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, response.StatusCode)
+
+	response, err = pushMessage(offlineQueueWsgwPort, "/apps/"+unresumableAppName+"/users/cid/message", "", "queued")
+	s.Require().NoError(err)
+	var result userPushResult
+	s.NoError(json.NewDecoder(response.Body).Decode(&result))
+	s.Equal(userPushResult{Recipients: 0, Queued: 1}, result)
+}
+
+func (s *offlineQueueTestSuite) TestRecipientsAreForgottenAfterTTL() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	session := s.connectAndLeave(ctx, userCredentialPrefix+"bob", websocket.StatusGoingAway)
+	time.Sleep(testOfflineQueueTTL + 100*time.Millisecond)
+
+	s.Equal(userPushResult{Recipients: 0, Queued: 0}, s.pushToUser("bob", "too late"))
+	response, err := pushMessage(offlineQueueWsgwPort, "/message/"+session.ConnectionID, "", "too late")
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, response.StatusCode)
+}
+
+func (s *offlineQueueTestSuite) TestUnknownConnectionIsNotQueued() {
+	response, err := pushMessage(offlineQueueWsgwPort, "/message/unknown", "", "lost")
+	s.NoError(err)
+	s.Equal(http.StatusNotFound, response.StatusCode)
+}
@@ -0,0 +1,179 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const payloadLogWsgwPort = 8099
+
+type payloadLogTestSuite struct {
+	suite.Suite
+	logFile   string
+	mockApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestPayloadLogTestSuite(t *testing.T) {
+	suite.Run(t, &payloadLogTestSuite{
+		logger: logging.Get().With().Str("unit", "TestPayloadLogTestSuite").Logger(),
+	})
+}
+
+func (s *payloadLogTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", payloadLogWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	// The loggers of the connections are derived from the logger at the time the gateway is started
+	s.logFile = filepath.Join(s.T().TempDir(), "gateway.log")
+	s.Require().NoError(logging.Configure(logging.Config{
+		Outputs: []string{logging.FileOutput},
+		File:    logging.FileConfig{Path: s.logFile},
+	}))
+
+	appBaseUrl := fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String())
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: payloadLogWsgwPort,
+			Apps: []wsgw.AppConfig{
+				{
+					Name:    "logged",
+					BaseUrl: appBaseUrl,
+					PayloadLogging: wsgw.PayloadLoggingConfig{
+						SampleRate:     1,
+						RedactPaths:    []string{"password", "items.*.token"},
+						RedactPatterns: []string{`Bearer [\w.~+/-]+`},
+						RedactHeaders:  []string{"X-Api-Key"},
+					},
+				},
+				{
+					Name:    "unlogged",
+					BaseUrl: appBaseUrl,
+				},
+			},
+		},
+		logging.Get().With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+}
+
+func (s *payloadLogTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+	s.Require().NoError(logging.Configure(logging.Config{
+		Outputs: []string{logging.StderrOutput, logging.FileOutput},
+	}))
+}
+
+func (s *payloadLogTestSuite) connect(ctx context.Context, app string, header http.Header) (*websocket.Conn, error) {
+	header.Set("Authorization", userCredentialPrefix+"alice")
+	c, _, err := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/%s", payloadLogWsgwPort, app), &websocket.DialOptions{
+		HTTPHeader: header,
+	})
+	return c, err
+}
+
+// send sends msg over the connection and returns the ID of the connection once the application received it
+func (s *payloadLogTestSuite) send(ctx context.Context, c *websocket.Conn, msg string) string {
+	s.Require().NoError(c.Write(ctx, websocket.MessageText, []byte(msg)))
+	var connId string
+	s.Eventually(func() bool {
+		for _, received := range s.mockApp.getMessagesReceived() {
+			if received[1] == msg {
+				connId = received[0]
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+	return connId
+}
+
+// payloadLogs returns the payload logs of the connection
+func (s *payloadLogTestSuite) payloadLogs(connId string) []string {
+	content, readErr := os.ReadFile(s.logFile)
+	s.Require().NoError(readErr)
+
+	var logs []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.Contains(line, `"method":"logPayload"`) && strings.Contains(line, connId) {
+			logs = append(logs, line)
+		}
+	}
+	return logs
+}
+
+func (s *payloadLogTestSuite) TestPayloadsAreRedacted() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, err := s.connect(ctx, "logged", http.Header{
+		"Cookie":    []string{"session=secret-cookie"},
+		"X-Api-Key": []string{"secret-key"},
+	})
+	s.Require().NoError(err)
+	defer c.Close(websocket.StatusNormalClosure, "")
+
+	connId := s.send(ctx, c, `{"password":"secret-password","items":[{"token":"secret-token","id":1}],"note":"Bearer secret-bearer"}`)
+	response, pushErr := pushMessage(payloadLogWsgwPort, "/apps/logged/message/"+connId, "", `{"password":"secret-pushed"}`)
+	s.Require().NoError(pushErr)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	_, pushed, readErr := c.Read(ctx)
+	s.Require().NoError(readErr)
+	s.Equal(`{"password":"secret-pushed"}`, string(pushed))
+
+	var logs []string
+	s.Eventually(func() bool {
+		logs = s.payloadLogs(connId)
+		return len(logs) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	s.Contains(logs[0], `"message":"connection request"`)
+	s.Contains(logs[0], `"Authorization":["REDACTED"]`)
+	s.Contains(logs[0], `"Cookie":["REDACTED"]`)
+	s.Contains(logs[0], `"X-Api-Key":["REDACTED"]`)
+	s.Contains(logs[1], `"direction":"inbound"`)
+	s.Contains(logs[1], `"payload":"{\"items\":[{\"id\":1,\"token\":\"REDACTED\"}],\"note\":\"REDACTED\",\"password\":\"REDACTED\"}"`)
+	s.Contains(logs[2], `"direction":"outbound"`)
+	s.Contains(logs[2], `"payload":"{\"password\":\"REDACTED\"}"`)
+	for _, line := range logs {
+		s.NotContains(line, "secret")
+		s.NotContains(line, "alice\"]")
+	}
+}
+
+func (s *payloadLogTestSuite) TestSampleRatePerConnection() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	unlogged, err := s.connect(ctx, "unlogged", http.Header{})
+	s.Require().NoError(err)
+	defer unlogged.Close(websocket.StatusNormalClosure, "")
+	unloggedConnId := s.send(ctx, unlogged, "not logged")
+
+	logged, err := s.connect(ctx, "unlogged", http.Header{wsgw.PayloadSampleRateHeaderKey: []string{"1"}})
+	s.Require().NoError(err)
+	defer logged.Close(websocket.StatusNormalClosure, "")
+	loggedConnId := s.send(ctx, logged, "logged")
+
+	s.Eventually(func() bool {
+		return len(s.payloadLogs(loggedConnId)) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	s.Contains(s.payloadLogs(loggedConnId)[1], `"payload":"logged"`)
+	s.Empty(s.payloadLogs(unloggedConnId))
+}
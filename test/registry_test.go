@@ -0,0 +1,227 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const (
+	redisNodeAPort = 8085
+	redisNodeBPort = 8086
+	// redisRestartedNodePort is that of the node restarted within the node TTL
+	redisRestartedNodePort = 8112
+)
+
+type redisRegistryTestSuite struct {
+	suite.Suite
+	redis   *miniredis.Miniredis
+	mockApp *mockApplication
+	nodeA   *wsgw.Server
+	nodeB   *wsgw.Server
+	logger  zerolog.Logger
+}
+
+func TestRedisRegistryTestSuite(t *testing.T) {
+	suite.Run(t, &redisRegistryTestSuite{
+		logger: logging.Get().With().Str("unit", "TestRedisRegistryTestSuite").Logger(),
+	})
+}
+
+func (s *redisRegistryTestSuite) SetupSuite() {
+	s.redis = miniredis.NewMiniRedis()
+	if err := s.redis.Start(); err != nil {
+		panic(err)
+	}
+
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", redisNodeAPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	peers := map[string]string{
+		"node-a": fmt.Sprintf("http://localhost:%d", redisNodeAPort),
+		"node-b": fmt.Sprintf("http://localhost:%d", redisNodeBPort),
+	}
+	nodeConfig := func(nodeID string, port int) wsgw.Config {
+		return wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: port,
+			AppBaseUrl: fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+			Cluster: wsgw.ClusterConfig{
+				NodeID:    nodeID,
+				Peers:     peers,
+				SharedKey: "cluster-key",
+			},
+			Registry: wsgw.RegistryConfig{
+				Type:         wsgw.RedisRegistryType,
+				RedisAddress: s.redis.Addr(),
+				NodeTTL:      300 * time.Millisecond,
+			},
+		}
+	}
+
+	s.nodeA = startWsGateway(nodeConfig("node-a", redisNodeAPort), s.logger.With().Str("node", "node-a").Logger())
+	s.nodeB = startWsGateway(nodeConfig("node-b", redisNodeBPort), s.logger.With().Str("node", "node-b").Logger())
+}
+
+func (s *redisRegistryTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.nodeA.Stop()
+	s.nodeB.Stop()
+	s.redis.Close()
+}
+
+func (s *redisRegistryTestSuite) TestConnectionsOfLapsedNodesAreRemoved() {
+	// node-z registered a connection, then died without refreshing its heartbeat
+	s.redis.HSet("wsgw:default:conn:ghost.node-z", "node", "node-z", "user_id", "ghost")
+	s.redis.SAdd("wsgw:default:conns", "ghost.node-z")
+	s.redis.SAdd("wsgw:default:user:ghost", "ghost.node-z")
+	s.redis.SAdd("wsgw:node:node-z:conns", "default:ghost.node-z")
+	s.redis.SAdd("wsgw:nodes", "node-z")
+
+	s.Eventually(func() bool {
+		return !s.redis.Exists("wsgw:default:conn:ghost.node-z") && !s.redis.Exists("wsgw:default:user:ghost") &&
+			!s.redis.Exists("wsgw:node:node-z:conns")
+	}, 5*time.Second, 10*time.Millisecond)
+	nodes, _ := s.redis.SMembers("wsgw:nodes")
+	s.NotContains(nodes, "node-z")
+
+	// The live nodes keep their heartbeat
+	s.True(s.redis.Exists("wsgw:node:node-a:alive"))
+	s.True(s.redis.Exists("wsgw:node:node-b:alive"))
+}
+
+func (s *redisRegistryTestSuite) TestRestartedNodeRemovesItsStaleConnections() {
+	// node-c registered a connection and crashed, its heartbeat not having expired yet when it restarts
+	s.redis.HSet("wsgw:default:conn:ghost.node-c", "node", "node-c", "user_id", "ghost-c")
+	s.redis.SAdd("wsgw:default:conns", "ghost.node-c")
+	s.redis.SAdd("wsgw:default:user:ghost-c", "ghost.node-c")
+	s.redis.SAdd("wsgw:node:node-c:conns", "default:ghost.node-c")
+	s.redis.SAdd("wsgw:nodes", "node-c")
+	s.redis.Set("wsgw:node:node-c:alive", time.Now().UTC().Format(time.RFC3339Nano))
+	s.redis.SetTTL("wsgw:node:node-c:alive", time.Minute)
+
+	nodeC := startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: redisRestartedNodePort,
+			AppBaseUrl: fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+			Cluster:    wsgw.ClusterConfig{NodeID: "node-c"},
+			Registry:   wsgw.RegistryConfig{Type: wsgw.RedisRegistryType, RedisAddress: s.redis.Addr()},
+		},
+		s.logger.With().Str("node", "node-c").Logger(),
+	)
+	defer nodeC.Stop()
+
+	s.False(s.redis.Exists("wsgw:default:conn:ghost.node-c"))
+	s.False(s.redis.Exists("wsgw:default:user:ghost-c"))
+	s.False(s.redis.Exists("wsgw:node:node-c:conns"))
+	conns, _ := s.redis.SMembers("wsgw:default:conns")
+	s.NotContains(conns, "ghost.node-c")
+}
+
+func (s *redisRegistryTestSuite) TestDeregisterRacingJoinTopicLeavesNoMembership() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	registry := wsgw.NewRedisRegistry(redis.NewClient(&redis.Options{Addr: s.redis.Addr()}), "racing")
+	defer registry.Close()
+
+	for i := range 50 {
+		connId := fmt.Sprintf("conn-%d", i)
+		s.Require().NoError(registry.Register(ctx, wsgw.ConnectionEntry{ID: connId, App: "chat", Node: "node-r", ConnectedAt: time.Now()}))
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			joinErr := registry.JoinTopic(ctx, "chat", "news", connId)
+			if joinErr != nil {
+				s.ErrorIs(joinErr, wsgw.ErrConnectionNotFound)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			s.NoError(registry.Deregister(ctx, "chat", connId))
+		}()
+		wg.Wait()
+	}
+
+	members, err := registry.TopicMembers(ctx, "chat", "news")
+	s.Require().NoError(err)
+	s.Empty(members)
+	s.False(s.redis.Exists("racing:node:node-r:conns"))
+}
+
+func (s *redisRegistryTestSuite) TestMembershipsAreSharedByNodes() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _, err := connectToWs(ctx, redisNodeAPort, &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization": []string{userCredentialPrefix + "joe"},
+		},
+	})
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	defer c.Close(websocket.StatusNormalClosure, "we're done")
+	connId := s.mockApp.getDataReceived()[0][2]
+
+	s.Eventually(func() bool {
+		userConns, _ := s.redis.SMembers("wsgw:default:user:joe")
+		return len(userConns) == 1 && userConns[0] == connId
+	}, 5*time.Second, 10*time.Millisecond)
+
+	listResponse, err := http.Get(fmt.Sprintf("http://localhost:%d/connections?user=joe", redisNodeBPort))
+	s.NoError(err)
+	var entries []wsgw.ConnectionEntry
+	s.NoError(json.NewDecoder(listResponse.Body).Decode(&entries))
+	if s.Len(entries, 1) {
+		s.Equal(connId, entries[0].ID)
+		s.Equal("node-a", entries[0].Node)
+	}
+
+	request, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://localhost:%d/connections/%s/topics/news", redisNodeBPort, connId), nil)
+	joinResponse, err := http.DefaultClient.Do(request)
+	s.NoError(err)
+	s.Equal(http.StatusNoContent, joinResponse.StatusCode)
+
+	s.expectDelivery(ctx, c, "/topics/news/message", "breaking news")
+	s.expectDelivery(ctx, c, "/users/joe/message", "hi joe")
+
+	c.Close(websocket.StatusNormalClosure, "we're done")
+	s.Eventually(func() bool {
+		return !s.redis.Exists("wsgw:default:topic:news") && !s.redis.Exists("wsgw:default:user:joe")
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// expectDelivery pushes the message via node B and expects it to reach the client exactly once
+func (s *redisRegistryTestSuite) expectDelivery(ctx context.Context, c *websocket.Conn, path string, message string) {
+	response, err := pushMessage(redisNodeBPort, path, "", message)
+	s.NoError(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+	var result struct {
+		Recipients int `json:"recipients"`
+	}
+	s.NoError(json.NewDecoder(response.Body).Decode(&result))
+	s.Equal(1, result.Recipients)
+
+	_, msg, readErr := c.Read(ctx)
+	s.NoError(readErr)
+	s.Equal(message, string(msg))
+}
@@ -0,0 +1,176 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const reloadWsgwPort = 8096
+
+type reloadTestSuite struct {
+	suite.Suite
+	mockApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestReloadTestSuite(t *testing.T) {
+	suite.Run(t, &reloadTestSuite{
+		logger: logging.Get().With().Str("unit", "TestReloadTestSuite").Logger(),
+	})
+}
+
+func (s *reloadTestSuite) config() wsgw.Config {
+	return wsgw.Config{
+		ServerHost: "localhost",
+		ServerPort: reloadWsgwPort,
+		Apps: []wsgw.AppConfig{
+			{
+				Name:           "reloaded",
+				BaseUrl:        fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+				BackendAPIKeys: []string{"old-key"},
+			},
+			{
+				Name:      "h2c",
+				BaseUrl:   fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+				Transport: wsgw.AppTransportConfig{EnableHTTP2: true},
+			},
+		},
+	}
+}
+
+func (s *reloadTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", reloadWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	s.wsGateway = startWsGateway(s.config(), s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger())
+}
+
+func (s *reloadTestSuite) SetupTest() {
+	_, err := s.wsGateway.Reload(s.config())
+	s.Require().NoError(err)
+}
+
+func (s *reloadTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+}
+
+func (s *reloadTestSuite) connect(ctx context.Context) (*websocket.Conn, *http.Response, error) {
+	return websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect/reloaded", reloadWsgwPort), defaultDialOptions)
+}
+
+func (s *reloadTestSuite) TestCallbackURLs() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	conf := s.config()
+	conf.Apps[0].ConnectingPath = "/ws/unknown"
+	report, err := s.wsGateway.Reload(conf)
+	s.Require().NoError(err)
+	s.Equal([]string{"Apps[reloaded].ConnectingPath"}, report.Applied)
+
+	_, response, _ := s.connect(ctx)
+	s.Equal(http.StatusInternalServerError, response.StatusCode)
+
+	_, err = s.wsGateway.Reload(s.config())
+	s.Require().NoError(err)
+
+	c, _, err := s.connect(ctx)
+	s.Require().NoError(err)
+	c.Close(websocket.StatusNormalClosure, "we're done")
+}
+
+func (s *reloadTestSuite) TestInvalidReloadKeepsConfiguration() {
+	conf := s.config()
+	conf.Apps[0].BackendAPIKeys = []string{"new-key"}
+	conf.Apps[0].MessageBufferSize = -1
+	_, err := s.wsGateway.Reload(conf)
+	s.ErrorContains(err, "must not be negative")
+
+	response, err := pushMessage(reloadWsgwPort, "/apps/reloaded/broadcast", "old-key", "hello")
+	s.NoError(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+}
+
+func (s *reloadTestSuite) TestLogLevel() {
+	previous := logging.Level()
+	defer logging.SetLevel(previous)
+
+	conf := s.config()
+	conf.Logging.Level = "error"
+	conf.Logging.Levels = map[string]string{"WsConnections": "debug"}
+	conf.Logging.Format = logging.ConsoleFormat
+	report, err := s.wsGateway.Reload(conf)
+	s.Require().NoError(err)
+	s.Equal([]string{"Logging.Level", "Logging.Levels"}, report.Applied)
+	s.Equal([]string{"Logging"}, report.RequiresRestart)
+	s.Equal(zerolog.ErrorLevel, logging.Level())
+}
+
+func (s *reloadTestSuite) TestReloadKeepsConnections() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _, err := s.connect(ctx)
+	s.Require().NoError(err)
+	defer c.Close(websocket.StatusNormalClosure, "we're done")
+
+	conf := s.config()
+	conf.Apps[0].BackendAPIKeys = []string{"new-key"}
+	conf.Apps[0].PushRateLimit = 100
+	conf.Apps[0].PushBurst = 10
+	report, err := s.wsGateway.Reload(conf)
+	s.Require().NoError(err)
+	s.ElementsMatch([]string{"Apps[reloaded].BackendAPIKeys", "Apps[reloaded].PushRateLimit", "Apps[reloaded].PushBurst"}, report.Applied)
+	s.Empty(report.RequiresRestart)
+
+	response, err := pushMessage(reloadWsgwPort, "/apps/reloaded/broadcast", "old-key", "hello")
+	s.NoError(err)
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+
+	response, err = pushMessage(reloadWsgwPort, "/apps/reloaded/broadcast", "new-key", "hello")
+	s.NoError(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+
+	_, msg, readErr := c.Read(ctx)
+	s.NoError(readErr)
+	s.Equal("hello", string(msg))
+}
+
+func (s *reloadTestSuite) TestBaseUrlSchemeWithHTTP2RequiresRestart() {
+	conf := s.config()
+	conf.Apps[0].BaseUrl = fmt.Sprintf("https://%s", s.mockApp.listener.Addr().String())
+	conf.Apps[1].BaseUrl = fmt.Sprintf("https://%s", s.mockApp.listener.Addr().String())
+	report, err := s.wsGateway.Reload(conf)
+	s.Require().NoError(err)
+	s.Equal([]string{"Apps[reloaded].BaseUrl"}, report.Applied)
+	s.Equal([]string{"Apps[h2c].BaseUrl"}, report.RequiresRestart)
+}
+
+func (s *reloadTestSuite) TestSettingsRequiringRestart() {
+	conf := s.config()
+	conf.ServerPort = reloadWsgwPort + 100
+	conf.Apps[0].MessageFormat = wsgw.JSONEnvelopeMessageFormat
+	conf.Apps = append(conf.Apps, wsgw.AppConfig{Name: "added", BaseUrl: "http://localhost"})
+	report, err := s.wsGateway.Reload(conf)
+	s.Require().NoError(err)
+	s.Empty(report.Applied)
+	s.ElementsMatch([]string{"ServerPort", "Apps[reloaded].MessageFormat", "Apps[added]"}, report.RequiresRestart)
+
+	// The gateway keeps serving with the current settings
+	response, err := pushMessage(reloadWsgwPort, "/apps/reloaded/broadcast", "old-key", "hello")
+	s.NoError(err)
+	s.Equal(http.StatusOK, response.StatusCode)
+}
@@ -0,0 +1,150 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+const replayWsgwPort = 8088
+
+type replayTestSuite struct {
+	suite.Suite
+	mockApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestReplayTestSuite(t *testing.T) {
+	suite.Run(t, &replayTestSuite{
+		logger: logging.Get().With().Str("unit", "TestReplayTestSuite").Logger(),
+	})
+}
+
+func (s *replayTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", replayWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: replayWsgwPort,
+			Apps: []wsgw.AppConfig{
+				{
+					Name:             wsgw.DefaultAppName,
+					BaseUrl:          fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+					MessageFormat:    wsgw.JSONEnvelopeMessageFormat,
+					ReplayBufferSize: 8,
+				},
+			},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+}
+
+func (s *replayTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+}
+
+type sessionEnvelope struct {
+	Type         string `json:"type"`
+	Seq          uint64 `json:"seq"`
+	Data         string `json:"data"`
+	ConnectionID string `json:"connectionId"`
+	ResumeToken  string `json:"resumeToken"`
+	Resumed      bool   `json:"resumed"`
+}
+
+func (s *replayTestSuite) read(ctx context.Context, c *websocket.Conn) sessionEnvelope {
+	var envelope sessionEnvelope
+	s.NoError(wsjson.Read(ctx, c, &envelope))
+	return envelope
+}
+
+func (s *replayTestSuite) push(connId string, message string) {
+	response, err := pushMessage(replayWsgwPort, "/message/"+connId, "", message)
+	s.NoError(err)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+}
+
+func (s *replayTestSuite) TestResumeReplaysMissedMessages() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, response, err := connectToWs(ctx, replayWsgwPort, defaultDialOptions)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	session := s.read(ctx, c)
+	s.Equal("session", session.Type)
+	s.Equal(uint64(0), session.Seq)
+	s.False(session.Resumed)
+	s.Equal(response.Header.Get(wsgw.ResumeTokenHeaderKey), session.ResumeToken)
+
+	s.push(session.ConnectionID, "one")
+	s.Equal("one", s.read(ctx, c).Data)
+	s.push(session.ConnectionID, "two")
+	s.push(session.ConnectionID, "three")
+
+	c.Close(websocket.StatusGoingAway, "switching networks")
+	s.Eventually(func() bool {
+		return len(s.mockApp.getDataReceived()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	resumed, _, err := websocket.Dial(
+		ctx,
+		fmt.Sprintf("ws://localhost:%d/connect?resume=%s&lastSeq=1", replayWsgwPort, session.ResumeToken),
+		defaultDialOptions,
+	)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	defer resumed.Close(websocket.StatusNormalClosure, "we're done")
+
+	resumedSession := s.read(ctx, resumed)
+	s.True(resumedSession.Resumed)
+	s.Equal(session.ConnectionID, resumedSession.ConnectionID)
+	s.Equal(uint64(3), resumedSession.Seq)
+
+	two := s.read(ctx, resumed)
+	s.Equal("two", two.Data)
+	s.Equal(uint64(2), two.Seq)
+	three := s.read(ctx, resumed)
+	s.Equal("three", three.Data)
+	s.Equal(uint64(3), three.Seq)
+
+	s.push(session.ConnectionID, "four")
+	four := s.read(ctx, resumed)
+	s.Equal("four", four.Data)
+	s.Equal(uint64(4), four.Seq)
+}
+
+func (s *replayTestSuite) TestUnknownResumeTokenStartsNewSession() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _, err := websocket.Dial(ctx, fmt.Sprintf("ws://localhost:%d/connect?resume=bogus", replayWsgwPort), defaultDialOptions)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+	defer c.Close(websocket.StatusNormalClosure, "we're done")
+
+	session := s.read(ctx, c)
+	s.False(session.Resumed)
+	s.NotEmpty(session.ConnectionID)
+}
@@ -0,0 +1,174 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const requestIDWsgwPort = 8097
+
+type requestIDTestSuite struct {
+	suite.Suite
+	mockApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestRequestIDTestSuite(t *testing.T) {
+	suite.Run(t, &requestIDTestSuite{
+		logger: logging.Get().With().Str("unit", "TestRequestIDTestSuite").Logger(),
+	})
+}
+
+func (s *requestIDTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", requestIDWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: requestIDWsgwPort,
+			AppBaseUrl: fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+}
+
+func (s *requestIDTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+}
+
+func (s *requestIDTestSuite) connect(ctx context.Context, requestID string) (*websocket.Conn, *http.Response, error) {
+	header := http.Header{"Authorization": []string{userCredentialPrefix + "alice"}}
+	if requestID != "" {
+		header.Set(wsgw.RequestIDHeaderKey, requestID)
+	}
+	return connectToWs(ctx, requestIDWsgwPort, &websocket.DialOptions{HTTPHeader: header})
+}
+
+// callbackRequestIDs returns the request IDs of the callbacks received since `since` callbacks
+func (s *requestIDTestSuite) callbackRequestIDs(since int) map[string]string {
+	requestIDs := map[string]string{}
+	for _, callback := range s.mockApp.getRequestIDs()[since:] {
+		requestIDs[callback[0]] = callback[1]
+	}
+	return requestIDs
+}
+
+func (s *requestIDTestSuite) TestGeneratedRequestID() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	since := len(s.mockApp.getRequestIDs())
+	c, response, err := s.connect(ctx, "")
+	s.Require().NoError(err)
+	c.Close(websocket.StatusNormalClosure, "we're done")
+
+	requestID := response.Header.Get(wsgw.RequestIDHeaderKey)
+	s.NotEmpty(requestID)
+	s.Equal(requestID, s.callbackRequestIDs(since)["connecting"])
+}
+
+func (s *requestIDTestSuite) TestInvalidRequestIDIsReplaced() {
+	response, err := pushMessage(requestIDWsgwPort, "/broadcast", "", "hello")
+	s.Require().NoError(err)
+	generated := response.Header.Get(wsgw.RequestIDHeaderKey)
+	s.NotEmpty(generated)
+
+	request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%d/connections", requestIDWsgwPort), nil)
+	request.Header.Set(wsgw.RequestIDHeaderKey, strings.Repeat("x", 200))
+	response, err = http.DefaultClient.Do(request)
+	s.Require().NoError(err)
+	s.Len(response.Header.Get(wsgw.RequestIDHeaderKey), len(generated))
+}
+
+func (s *requestIDTestSuite) TestRequestIDIsRelayedToCallbacks() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	since := len(s.mockApp.getRequestIDs())
+	c, response, err := s.connect(ctx, "client-request-1")
+	s.Require().NoError(err)
+	s.Equal("client-request-1", response.Header.Get(wsgw.RequestIDHeaderKey))
+
+	s.NoError(c.Write(ctx, websocket.MessageText, []byte("hello")))
+	s.Eventually(func() bool {
+		return s.callbackRequestIDs(since)["message-received"] != ""
+	}, 5*time.Second, 10*time.Millisecond)
+	c.Close(websocket.StatusNormalClosure, "we're done")
+
+	s.Eventually(func() bool {
+		return s.callbackRequestIDs(since)["disconnected"] != ""
+	}, 5*time.Second, 10*time.Millisecond)
+	s.Equal(map[string]string{
+		"connecting":       "client-request-1",
+		"message-received": "client-request-1",
+		"disconnected":     "client-request-1",
+	}, s.callbackRequestIDs(since))
+}
+
+func (s *requestIDTestSuite) TestConnectionLogger() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	path := filepath.Join(s.T().TempDir(), "gateway.log")
+	s.Require().NoError(logging.Configure(logging.Config{
+		Levels:  map[string]string{"processMessages": "debug"},
+		Outputs: []string{logging.FileOutput},
+		File:    logging.FileConfig{Path: path},
+	}))
+	defer func() {
+		s.Require().NoError(logging.Configure(logging.Config{
+			Outputs: []string{logging.StderrOutput, logging.FileOutput},
+		}))
+	}()
+
+	// The loggers of the applications are created with the gateway
+	gateway := startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: requestIDWsgwPort + 100,
+			AppBaseUrl: fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+		},
+		logging.Get(),
+	)
+	defer gateway.Stop()
+
+	header := http.Header{"Authorization": []string{userCredentialPrefix + "bob"}}
+	header.Set(wsgw.RequestIDHeaderKey, "client-request-2")
+	c, _, err := connectToWs(ctx, requestIDWsgwPort+100, &websocket.DialOptions{HTTPHeader: header})
+	s.Require().NoError(err)
+	c.Close(websocket.StatusNormalClosure, "we're done")
+
+	var connectionLogs []string
+	s.Eventually(func() bool {
+		content, _ := os.ReadFile(path)
+		connectionLogs = nil
+		for _, line := range strings.Split(string(content), "\n") {
+			if strings.Contains(line, `"method":"processMessages"`) {
+				connectionLogs = append(connectionLogs, line)
+			}
+		}
+		return len(connectionLogs) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	for _, line := range connectionLogs {
+		s.Contains(line, `"connection_id":"`)
+		s.Contains(line, `"user_id":"bob"`)
+		s.Contains(line, `"request_id":"client-request-2"`)
+	}
+}
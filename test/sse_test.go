@@ -0,0 +1,216 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+const sseWsgwPort = 8100
+
+type sseTestSuite struct {
+	suite.Suite
+	mockApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestSSETestSuite(t *testing.T) {
+	suite.Run(t, &sseTestSuite{
+		logger: logging.Get().With().Str("unit", "TestSSETestSuite").Logger(),
+	})
+}
+
+func (s *sseTestSuite) SetupSuite() {
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", sseWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: sseWsgwPort,
+			AppBaseUrl: fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+}
+
+func (s *sseTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+}
+
+type sseEvent struct {
+	event string
+	data  string
+}
+
+// sseStream reads the events of an SSE connection
+type sseStream struct {
+	response     *http.Response
+	events       chan sseEvent
+	connectionId string
+	token        string
+}
+
+func (s *sseTestSuite) connect(ctx context.Context, credential string, requestID string) (*sseStream, *http.Response) {
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://localhost:%d/connect/sse", sseWsgwPort), nil)
+	request.Header.Set("Authorization", credential)
+	request.Header.Set("Accept", "text/event-stream")
+	request.Header.Set(wsgw.RequestIDHeaderKey, requestID)
+	response, err := http.DefaultClient.Do(request)
+	s.Require().NoError(err)
+	if response.StatusCode != http.StatusOK {
+		return nil, response
+	}
+
+	stream := &sseStream{response: response, events: make(chan sseEvent, 16)}
+	go func() {
+		defer close(stream.events)
+		scanner := bufio.NewScanner(response.Body)
+		var event sseEvent
+		var data []string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				event.data = strings.Join(data, "\n")
+				stream.events <- event
+				event, data = sseEvent{}, nil
+			case strings.HasPrefix(line, "event: "):
+				event.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = append(data, strings.TrimPrefix(line, "data: "))
+			}
+		}
+	}()
+
+	connection := s.next(stream)
+	s.Require().Equal("connection", connection.event)
+	var connectionData map[string]string
+	s.Require().NoError(json.Unmarshal([]byte(connection.data), &connectionData))
+	stream.connectionId, stream.token = connectionData["connectionId"], connectionData["token"]
+	s.Equal(stream.connectionId, response.Header.Get(wsgw.ConnectionIDHeaderKey))
+	s.Equal(stream.token, response.Header.Get(wsgw.ConnectionTokenHeaderKey))
+	return stream, response
+}
+
+func (s *sseTestSuite) next(stream *sseStream) sseEvent {
+	select {
+	case event, ok := <-stream.events:
+		s.Require().True(ok, "stream ended")
+		return event
+	case <-time.After(5 * time.Second):
+		s.FailNow("no event received")
+		return sseEvent{}
+	}
+}
+
+func (s *sseTestSuite) sendUpstream(stream *sseStream, token string, msg string) *http.Response {
+	request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:%d/connect/sse/%s", sseWsgwPort, stream.connectionId), strings.NewReader(msg))
+	request.Header.Set(wsgw.ConnectionTokenHeaderKey, token)
+	response, err := http.DefaultClient.Do(request)
+	s.Require().NoError(err)
+	return response
+}
+
+// callbacks returns the callback endpoints the mock application was called at for the request with `requestID`
+func (s *sseTestSuite) callbacks(requestID string) []string {
+	var endpoints []string
+	for _, callback := range s.mockApp.getRequestIDs() {
+		if callback[1] == requestID {
+			endpoints = append(endpoints, callback[0])
+		}
+	}
+	return endpoints
+}
+
+func (s *sseTestSuite) TestClosedByBackend() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	stream, _ := s.connect(ctx, userCredentialPrefix+"alice", "sse-backend-close")
+	defer stream.response.Body.Close()
+
+	request, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://localhost:%d/connections/%s", sseWsgwPort, stream.connectionId), nil)
+	response, err := http.DefaultClient.Do(request)
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+
+	s.Equal("close", s.next(stream).event)
+	_, open := <-stream.events
+	s.False(open)
+	s.Eventually(func() bool {
+		return slices.Contains(s.callbacks("sse-backend-close"), "disconnected")
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (s *sseTestSuite) TestClientDisconnects() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	streamCtx, closeStream := context.WithCancel(ctx)
+	stream, _ := s.connect(streamCtx, userCredentialPrefix+"alice", "sse-client-close")
+	closeStream()
+	stream.response.Body.Close()
+
+	s.Eventually(func() bool {
+		return slices.Contains(s.callbacks("sse-client-close"), "disconnected")
+	}, 5*time.Second, 10*time.Millisecond)
+	s.Equal(http.StatusNotFound, s.sendUpstream(stream, stream.token, "too late").StatusCode)
+}
+
+func (s *sseTestSuite) TestMessagesBothWays() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	stream, _ := s.connect(ctx, userCredentialPrefix+"alice", "sse-messages")
+	defer stream.response.Body.Close()
+	s.Equal([]string{"connecting"}, s.callbacks("sse-messages"))
+
+	s.Equal(http.StatusNoContent, s.sendUpstream(stream, stream.token, "hello upstream").StatusCode)
+	s.Eventually(func() bool {
+		return slices.ContainsFunc(s.mockApp.getMessagesReceived(), func(received []string) bool {
+			return received[0] == stream.connectionId && received[1] == "hello upstream"
+		})
+	}, 5*time.Second, 10*time.Millisecond)
+	s.Equal([]string{"connecting", "message-received"}, s.callbacks("sse-messages"))
+
+	response, err := pushMessage(sseWsgwPort, "/message/"+stream.connectionId, "", "hello\ndownstream")
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	s.Equal(sseEvent{data: "hello\ndownstream"}, s.next(stream))
+}
+
+func (s *sseTestSuite) TestRejectedByApp() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	stream, response := s.connect(ctx, badCredential, "sse-rejected")
+	s.Nil(stream)
+	s.Equal(http.StatusUnauthorized, response.StatusCode)
+}
+
+func (s *sseTestSuite) TestUpstreamRequiresToken() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	stream, _ := s.connect(ctx, userCredentialPrefix+"alice", "sse-token")
+	defer stream.response.Body.Close()
+
+	s.Equal(http.StatusForbidden, s.sendUpstream(stream, "guessed", "hello").StatusCode)
+	s.Equal(http.StatusForbidden, s.sendUpstream(stream, "", "hello").StatusCode)
+}
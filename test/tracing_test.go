@@ -0,0 +1,134 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	wsgw "websocket-gateway/internal"
+	"websocket-gateway/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"nhooyr.io/websocket"
+)
+
+const tracingWsgwPort = 8092
+
+type tracingTestSuite struct {
+	suite.Suite
+	collector *collectorStub
+	mockApp   *mockApplication
+	wsGateway *wsgw.Server
+	logger    zerolog.Logger
+}
+
+func TestTracingTestSuite(t *testing.T) {
+	suite.Run(t, &tracingTestSuite{
+		logger: logging.Get().With().Str("unit", "TestTracingTestSuite").Logger(),
+	})
+}
+
+func (s *tracingTestSuite) SetupSuite() {
+	collector, collectorErr := startCollectorStub()
+	if collectorErr != nil {
+		panic(collectorErr)
+	}
+	s.collector = collector
+
+	s.mockApp = newMockApp(fmt.Sprintf("http://localhost:%d", tracingWsgwPort))
+	if err := s.mockApp.start(); err != nil {
+		panic(err)
+	}
+
+	s.wsGateway = startWsGateway(
+		wsgw.Config{
+			ServerHost: "localhost",
+			ServerPort: tracingWsgwPort,
+			AppBaseUrl: fmt.Sprintf("http://%s", s.mockApp.listener.Addr().String()),
+			Tracing: wsgw.TracingConfig{
+				OTLPEndpoint: s.collector.endpoint(),
+				BatchTimeout: 50 * time.Millisecond,
+			},
+		},
+		s.logger.With().Str(logging.ServiceLogger, "websocket-gateway").Logger(),
+	)
+}
+
+func (s *tracingTestSuite) TearDownSuite() {
+	s.mockApp.stop()
+	s.wsGateway.Stop()
+	s.collector.stop()
+}
+
+// eventuallyExported waits for the span with `name` to be exported in the trace
+func (s *tracingTestSuite) eventuallyExported(traceID string, name string) exportedSpan {
+	var span exportedSpan
+	s.Eventually(func() bool {
+		var ok bool
+		span, ok = s.collector.span(traceID, name)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond, "span %s not exported", name)
+	return span
+}
+
+func (s *tracingTestSuite) TestConnectAndCallbacksAreTraced() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	clientSpanID := "00f067aa0ba902b7"
+	c, _, err := connectToWs(ctx, tracingWsgwPort, &websocket.DialOptions{
+		HTTPHeader: http.Header{
+			"Authorization": []string{"some credentials"},
+			"Traceparent":   []string{fmt.Sprintf("00-%s-%s-01", traceID, clientSpanID)},
+		},
+	})
+	s.Require().NoError(err)
+	defer c.Close(websocket.StatusNormalClosure, "we're done")
+
+	s.NoError(c.Write(ctx, websocket.MessageText, []byte("traced")))
+
+	connectSpan := s.eventuallyExported(traceID, "wsgw.connect")
+	s.Equal(clientSpanID, connectSpan.parentSpanID)
+	connectingSpan := s.eventuallyExported(traceID, "wsgw.callback.connecting")
+	s.Equal(connectSpan.spanID, connectingSpan.parentSpanID)
+	messageReceivedSpan := s.eventuallyExported(traceID, "wsgw.callback.message-received")
+	s.Equal(connectSpan.spanID, messageReceivedSpan.parentSpanID)
+
+	// The application continues the traces of the callbacks
+	s.Contains(s.mockApp.getTraceparents(), []string{"connecting", fmt.Sprintf("00-%s-%s-01", traceID, connectingSpan.spanID)})
+	s.Contains(s.mockApp.getTraceparents(), []string{"message-received", fmt.Sprintf("00-%s-%s-01", traceID, messageReceivedSpan.spanID)})
+}
+
+func (s *tracingTestSuite) TestPushIsTracedToSocketWrite() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, _, err := connectToWs(ctx, tracingWsgwPort, defaultDialOptions)
+	s.Require().NoError(err)
+	defer c.Close(websocket.StatusNormalClosure, "we're done")
+	connId := s.mockApp.getDataReceived()[0][2]
+
+	traceID := "0af7651916cd43dd8448eb211c80319c"
+	backendSpanID := "b7ad6b7169203331"
+	body, _ := json.Marshal("traced push")
+	request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:%d/message/%s", tracingWsgwPort, connId), bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Traceparent", fmt.Sprintf("00-%s-%s-01", traceID, backendSpanID))
+	response, err := http.DefaultClient.Do(request)
+	s.Require().NoError(err)
+	s.Equal(http.StatusNoContent, response.StatusCode)
+
+	_, msg, err := c.Read(ctx)
+	s.NoError(err)
+	s.Equal("traced push", string(msg))
+
+	pushSpan := s.eventuallyExported(traceID, "wsgw.push")
+	s.Equal(backendSpanID, pushSpan.parentSpanID)
+	writeSpan := s.eventuallyExported(traceID, "wsgw.write")
+	s.Equal(pushSpan.spanID, writeSpan.parentSpanID)
+}
@@ -0,0 +1,42 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	wsgw "websocket-gateway/internal"
+
+	"github.com/rs/zerolog"
+)
+
+func startWsGateway(config wsgw.Config, logger zerolog.Logger) *wsgw.Server {
+	server := wsgw.CreateServer(config, logger)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go server.SetupAndStart(func(port int, stop func()) {
+		wg.Done()
+	})
+	wg.Wait()
+
+	return server
+}
+
+// pushMessage calls the backend API at `path` of the gateway listening at `wsgwPort` with `message` as the JSON string body
+func pushMessage(wsgwPort int, path string, apiKey string, message string) (*http.Response, error) {
+	body, marshalErr := json.Marshal(message)
+	if marshalErr != nil {
+		return nil, marshalErr
+	}
+	request, createErr := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:%d%s", wsgwPort, path), bytes.NewReader(body))
+	if createErr != nil {
+		return nil, createErr
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		request.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	return http.DefaultClient.Do(request)
+}